@@ -28,6 +28,12 @@ enum ProtocolFeature
   FeatureEditMessagesWithinFifteenMins = (1 << 3),
   FeatureLimitedReactions = (1 << 4),
   FeatureMarkReadEveryView = (1 << 5),
+  FeatureStatusVisibleChats = (1 << 6),
+  FeatureProfileSettings = (1 << 7),
+  FeatureProfilePictures = (1 << 8),
+  FeatureUserDetails = (1 << 9),
+  FeatureResolveLinks = (1 << 10),
+  FeatureForwardMessages = (1 << 11),
 };
 
 class Protocol
@@ -87,6 +93,11 @@ enum MessageType
   GetUnreadReactionsRequestType,
   ReinitRequestType,
   FindMessageRequestType,
+  GetProfileSettingsRequestType,
+  SetProfileSettingRequestType,
+  GetProfilePictureRequestType,
+  ResolveLinksRequestType,
+  ForwardMessageRequestType,
   // Service messages
   ServiceMessageType,
   NewContactsNotifyType,
@@ -111,6 +122,13 @@ enum MessageType
   AvailableReactionsNotifyType,
   FindMessageNotifyType,
   UpdatePinNotifyType,
+  ConnErrorNotifyType,
+  ProfileSettingNotifyType,
+  ErrorNotifyType,
+  NewProfilePictureNotifyType,
+  UserDetailsNotifyType,
+  ResolveLinksNotifyType,
+  NewMessageEditNotifyType,
 };
 
 struct ContactInfo
@@ -119,6 +137,7 @@ struct ContactInfo
   std::string name;
   std::string phone;
   bool isSelf = false;
+  bool isBlocked = false; // only required for wmchat, not db cached
 };
 
 struct ChatInfo
@@ -146,6 +165,9 @@ struct FileInfo
   std::string fileId;
   std::string filePath;
   std::string fileType;
+  std::string thumbPath; // only required for wmchat, preview of not downloaded media
+  bool isVoiceNote = false; // only required for wmchat
+  int32_t durationSec = -1; // only required for wmchat, audio duration if known
 };
 
 // ensure CacheUtil and Serialization are up-to-date after modifying Reactions
@@ -188,6 +210,8 @@ struct ChatMessage
   bool isOutgoing = true;
   bool isRead = false;
   bool hasMention = false; // only required for tgchat, not db cached
+  int64_t timeEdited = -1; // only required for wmchat, not db cached
+  std::vector<std::string> editHistory; // only required for wmchat, not db cached
 };
 
 enum DownloadFileAction
@@ -197,6 +221,22 @@ enum DownloadFileAction
   DownloadFileActionSave = 2,
 };
 
+enum ProfileSettingType
+{
+  ProfileSettingTypeText = 0,
+  ProfileSettingTypeOption = 1,
+  ProfileSettingTypeFile = 2,
+};
+
+struct ProfileSetting
+{
+  std::string key;
+  std::string label;
+  std::string value;
+  ProfileSettingType type = ProfileSettingTypeText;
+  std::vector<std::string> options; // only required for ProfileSettingTypeOption
+};
+
 // Request messages
 class RequestMessage
 {
@@ -292,6 +332,7 @@ public:
   virtual MessageType GetMessageType() const { return SendTypingRequestType; }
   std::string chatId;
   bool isTyping = false;
+  bool isRecordingAudio = false; // only required for wmchat
 };
 
 class SetStatusRequest : public RequestMessage
@@ -337,6 +378,8 @@ public:
   std::string chatId;
   std::string msgId;
   std::string fileId;
+  std::string senderId; // only required for wmchat, media retry of older file ids
+  bool isOutgoing = false; // only required for wmchat, media retry of older file ids
   DownloadFileAction downloadFileAction = DownloadFileActionNone;
 };
 
@@ -408,6 +451,44 @@ public:
   std::string findMsgId;
 };
 
+class GetProfileSettingsRequest : public RequestMessage
+{
+public:
+  virtual MessageType GetMessageType() const { return GetProfileSettingsRequestType; }
+};
+
+class SetProfileSettingRequest : public RequestMessage
+{
+public:
+  virtual MessageType GetMessageType() const { return SetProfileSettingRequestType; }
+  std::string key;
+  std::string value;
+};
+
+class GetProfilePictureRequest : public RequestMessage
+{
+public:
+  virtual MessageType GetMessageType() const { return GetProfilePictureRequestType; }
+  std::string chatId;
+};
+
+class ResolveLinksRequest : public RequestMessage
+{
+public:
+  virtual MessageType GetMessageType() const { return ResolveLinksRequestType; }
+  std::string text;
+};
+
+class ForwardMessageRequest : public RequestMessage
+{
+public:
+  virtual MessageType GetMessageType() const { return ForwardMessageRequestType; }
+  std::string chatId;
+  std::string msgId;
+  ChatMessage chatMessage; // original message
+  std::vector<std::string> toChatIds;
+};
+
 // Service messages
 class ServiceMessage
 {
@@ -523,6 +604,8 @@ public:
   virtual MessageType GetMessageType() const { return CreateChatNotifyType; }
   bool success;
   ChatInfo chatInfo;
+  std::string entryText; // optional pre-filled message entry
+  std::string verifiedName; // only required for wmchat, optional business name
 };
 
 class ReceiveTypingNotify : public ServiceMessage
@@ -534,6 +617,7 @@ public:
   std::string chatId;
   std::string userId;
   bool isTyping;
+  bool isRecordingAudio = false;
 };
 
 enum TimeSeen
@@ -660,3 +744,73 @@ public:
   bool isPinned;
   int64_t timePinned = -1;
 };
+
+class ConnErrorNotify : public ServiceMessage
+{
+public:
+  explicit ConnErrorNotify(const std::string& p_ProfileId) :
+    ServiceMessage(p_ProfileId) { }
+  virtual MessageType GetMessageType() const { return ConnErrorNotifyType; }
+  std::string message;
+  bool isReconnectable = false;
+};
+
+class ProfileSettingNotify : public ServiceMessage
+{
+public:
+  explicit ProfileSettingNotify(const std::string& p_ProfileId) :
+    ServiceMessage(p_ProfileId) { }
+  virtual MessageType GetMessageType() const { return ProfileSettingNotifyType; }
+  ProfileSetting profileSetting;
+};
+
+class ErrorNotify : public ServiceMessage
+{
+public:
+  explicit ErrorNotify(const std::string& p_ProfileId) :
+    ServiceMessage(p_ProfileId) { }
+  virtual MessageType GetMessageType() const { return ErrorNotifyType; }
+  std::string message;
+};
+
+class NewProfilePictureNotify : public ServiceMessage
+{
+public:
+  explicit NewProfilePictureNotify(const std::string& p_ProfileId) :
+    ServiceMessage(p_ProfileId) { }
+  virtual MessageType GetMessageType() const { return NewProfilePictureNotifyType; }
+  std::string chatId;
+  std::string filePath; // empty if no picture is available
+};
+
+class UserDetailsNotify : public ServiceMessage
+{
+public:
+  explicit UserDetailsNotify(const std::string& p_ProfileId) :
+    ServiceMessage(p_ProfileId) { }
+  virtual MessageType GetMessageType() const { return UserDetailsNotifyType; }
+  std::string userId;
+  std::vector<std::pair<std::string, std::string>> details; // label and value
+};
+
+class ResolveLinksNotify : public ServiceMessage
+{
+public:
+  explicit ResolveLinksNotify(const std::string& p_ProfileId) :
+    ServiceMessage(p_ProfileId) { }
+  virtual MessageType GetMessageType() const { return ResolveLinksNotifyType; }
+  bool success;
+  std::string text;
+};
+
+class NewMessageEditNotify : public ServiceMessage
+{
+public:
+  explicit NewMessageEditNotify(const std::string& p_ProfileId) :
+    ServiceMessage(p_ProfileId) { }
+  virtual MessageType GetMessageType() const { return NewMessageEditNotifyType; }
+  std::string chatId;
+  std::string msgId;
+  int64_t timeEdited = -1;
+  std::string priorText; // text before edit, empty if not known
+};
@@ -29,6 +29,7 @@ void AppConfig::Init()
     { "proxy_host", "" },
     { "proxy_pass", "" },
     { "proxy_port", "" },
+    { "proxy_type", "socks5" },
     { "proxy_user", "" },
     { "timestamp_iso", "0" },
   };
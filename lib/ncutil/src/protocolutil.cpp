@@ -47,7 +47,26 @@ FileInfo ProtocolUtil::FileInfoFromHex(const std::string& p_Str)
     return FileInfo();
   }
 
-  fileInfo.fileType = StrUtil::StrFromHex(tmp);
+  // optional thumbnail path and audio info, not present in older cached data
+  std::vector<std::string> fields;
+  std::istringstream fieldss(tmp);
+  std::string field;
+  while (std::getline(fieldss, field, ','))
+  {
+    fields.push_back(field);
+  }
+
+  fileInfo.fileType = !fields.empty() ? StrUtil::StrFromHex(fields.at(0)) : "";
+  if (fields.size() > 1)
+  {
+    fileInfo.thumbPath = StrUtil::StrFromHex(fields.at(1));
+  }
+
+  if (fields.size() > 3)
+  {
+    fileInfo.isVoiceNote = (StrUtil::NumFromHex<int>(fields.at(2)) == 1);
+    fileInfo.durationSec = StrUtil::NumFromHex<int32_t>(fields.at(3));
+  }
 
   return fileInfo;
 }
@@ -58,6 +77,9 @@ std::string ProtocolUtil::FileInfoToHex(const FileInfo& p_FileInfo)
     StrUtil::NumToHex<int>(p_FileInfo.fileStatus) + "," +
     StrUtil::StrToHex(p_FileInfo.fileId) + "," +
     StrUtil::StrToHex(p_FileInfo.filePath) + "," +
-    StrUtil::StrToHex(p_FileInfo.fileType) + "\n";
+    StrUtil::StrToHex(p_FileInfo.fileType) + "," +
+    StrUtil::StrToHex(p_FileInfo.thumbPath) + "," +
+    StrUtil::NumToHex<int>(p_FileInfo.isVoiceNote ? 1 : 0) + "," +
+    StrUtil::NumToHex<int32_t>(p_FileInfo.durationSec) + "\n";
   return hexStr;
 }
@@ -8,6 +8,7 @@
 #include "status.h"
 
 uint32_t Status::m_Flags = 0;
+int32_t Status::m_Progress = -1;
 std::mutex Status::m_Mutex;
 
 uint32_t Status::Get()
@@ -31,10 +32,13 @@ std::string Status::ToString(uint32_t p_Mask)
 {
   std::unique_lock<std::mutex> lock(m_Mutex);
   const uint32_t maskedFlags = m_Flags & p_Mask;
+  const std::string progressStr = (m_Progress >= 0) ? (" " + std::to_string(m_Progress) + "%") : "";
 
+  if (maskedFlags & FlagReconnecting) return "Reconnecting";
+  if (maskedFlags & FlagDegraded) return "Degraded";
   if (maskedFlags & FlagSyncing) return "Syncing";
-  if (maskedFlags & FlagFetching) return "Fetching";
-  if (maskedFlags & FlagSending) return "Sending";
+  if (maskedFlags & FlagFetching) return "Fetching" + progressStr;
+  if (maskedFlags & FlagSending) return "Sending" + progressStr;
   if (maskedFlags & FlagUpdating) return "Updating";
   if (maskedFlags & FlagAway) return "Away";
   if (maskedFlags & FlagOnline) return "Online";
@@ -42,3 +46,14 @@ std::string Status::ToString(uint32_t p_Mask)
 
   return "Offline";
 }
+
+int32_t Status::GetProgress()
+{
+  return m_Progress;
+}
+
+void Status::SetProgress(int32_t p_Percent)
+{
+  std::unique_lock<std::mutex> lock(m_Mutex);
+  m_Progress = p_Percent;
+}
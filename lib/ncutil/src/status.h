@@ -26,14 +26,19 @@ public:
     FlagUpdating = (1 << 5),
     FlagSyncing = (1 << 6),
     FlagAway = (1 << 7),
+    FlagReconnecting = (1 << 8),
+    FlagDegraded = (1 << 9),
   };
 
   static uint32_t Get();
   static void Set(uint32_t p_Flags);
   static void Clear(uint32_t p_Flags);
   static std::string ToString(uint32_t p_Mask);
+  static int32_t GetProgress();
+  static void SetProgress(int32_t p_Percent); // -1 when no transfer is in progress
 
 private:
   static uint32_t m_Flags;
+  static int32_t m_Progress;
   static std::mutex m_Mutex;
 };
@@ -1446,8 +1446,19 @@ void TgChat::Impl::InitProxy()
       const std::string proxyUser = AppConfig::GetStr("proxy_user");
       const std::string proxyPass = AppConfig::GetStr("proxy_pass");
       const bool proxyEnable = true;
-      auto proxyType = (!proxyUser.empty()) ? td::make_tl_object<td::td_api::proxyTypeSocks5>(proxyUser, proxyPass)
-                                            : td::td_api::make_object<td::td_api::proxyTypeSocks5>();
+      const bool proxyHttp = (AppConfig::GetStr("proxy_type") == "http");
+      td::td_api::object_ptr<td::td_api::ProxyType> proxyType;
+      if (proxyHttp)
+      {
+        const bool httpOnly = false; // use http connect
+        proxyType = td::td_api::make_object<td::td_api::proxyTypeHttp>(proxyUser, proxyPass, httpOnly);
+      }
+      else
+      {
+        proxyType = (!proxyUser.empty()) ? td::make_tl_object<td::td_api::proxyTypeSocks5>(proxyUser, proxyPass)
+                                         : td::td_api::make_object<td::td_api::proxyTypeSocks5>();
+      }
+
       SendQuery(td::td_api::make_object<td::td_api::addProxy>(proxyHost, proxyPort, proxyEnable, std::move(proxyType)),
                 [](Object object)
       {
@@ -9,18 +9,32 @@ package main
 
 // #cgo linux LDFLAGS: -Wl,-unresolved-symbols=ignore-all
 // #cgo darwin LDFLAGS: -Wl,-undefined,dynamic_lookup
-// extern void WmNewContactsNotify(int p_ConnId, char* p_ChatId, char* p_Name, char* p_Phone, int p_IsSelf);
+// extern void WmNewContactsNotify(int p_ConnId, char* p_ChatId, char* p_Name, char* p_Phone, int p_IsSelf, int p_IsBlocked);
 // extern void WmNewChatsNotify(int p_ConnId, char* p_ChatId, int p_IsUnread, int p_IsMuted, int p_IsPinned, int p_LastMessageTime);
-// extern void WmNewMessagesNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, char* p_SenderId, char* p_Text, int p_FromMe, char* p_QuotedId, char* p_FileId, char* p_FilePath, int p_FileStatus, int p_TimeSent, int p_IsRead);
+// extern void WmNewMessagesNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, char* p_SenderId, char* p_Text, int p_FromMe, char* p_QuotedId, char* p_FileId, char* p_FilePath, char* p_ThumbPath, int p_FileStatus, int p_IsVoiceNote, int p_DurationSec, int p_TimeSent, int p_IsRead);
 // extern void WmNewStatusNotify(int p_ConnId, char* p_ChatId, char* p_UserId, int p_IsOnline, int p_IsTyping, int p_TimeSeen);
 // extern void WmNewMessageStatusNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, int p_IsRead);
-// extern void WmNewMessageFileNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, char* p_FilePath, int p_FileStatus, int p_Action);
-// extern void WmNewMessageReactionNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, char* p_SenderId, char* p_Text, int p_FromMe);
+// extern void WmNewMessageFileNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, char* p_FileId, char* p_FilePath, char* p_ThumbPath, int p_FileStatus, int p_IsVoiceNote, int p_DurationSec, int p_Action);
+// extern void WmNewMessageFileProgressNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, int p_Percent);
+// extern void WmSendMessageProgressNotify(int p_ConnId, char* p_ChatId, int p_Percent);
+// extern void WmNewMessageEditNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, int p_IsEdited, int p_TimeEdited, char* p_PriorText);
+// extern void WmForwardMessageNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, char* p_ToChatId, int p_IsSuccess);
+// extern void WmNewMessageReactionsNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, char* p_SelfId, char* p_EmojiSenders, char* p_RemovedSenderId);
 // extern void WmDeleteChatNotify(int p_ConnId, char* p_ChatId);
 // extern void WmDeleteMessageNotify(int p_ConnId, char* p_ChatId, char* p_MsgId);
 // extern void WmUpdateMuteNotify(int p_ConnId, char* p_ChatId, int p_IsMuted);
 // extern void WmUpdatePinNotify(int p_ConnId, char* p_ChatId, int p_IsPinned, int p_TimePinned);
+// extern void WmUpdatePrivacySettingNotify(int p_ConnId, char* p_Name, char* p_Value);
+// extern void WmNewProfilePictureNotify(int p_ConnId, char* p_ChatId, char* p_FilePath);
+// extern void WmUpdateSelfProfileNotify(int p_ConnId, char* p_Key, char* p_Value);
+// extern void WmNewUserDetailsNotify(int p_ConnId, char* p_UserId, char* p_About, char* p_VerifiedName, int p_DeviceCount, int p_IsBusiness, char* p_Address, char* p_Email, char* p_Categories, char* p_BusinessHours);
+// extern void WmLookupPhoneNotify(int p_ConnId, char* p_Phone, char* p_UserId, char* p_VerifiedName, int p_IsRegistered);
+// extern void WmNewLinkTargetNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, char* p_Link, char* p_UserId, char* p_Name, char* p_Text);
+// extern void WmNewContactQrLinkNotify(int p_ConnId, char* p_Link);
+// extern void WmNewConnStateNotify(int p_ConnId, int p_State, char* p_Reason);
 // extern void WmReinit(int p_ConnId);
+// extern void WmConnErrorNotify(int p_ConnId, char* p_Message, int p_IsReconnectable);
+// extern void WmErrorNotify(int p_ConnId, char* p_Message);
 // extern void WmSetProtocolUiControl(int p_ConnId, int p_IsTakeControl);
 // extern void WmSetStatus(int p_Flags);
 // extern void WmClearStatus(int p_Flags);
@@ -37,8 +51,8 @@ import (
 )
 
 //export CWmInit
-func CWmInit(path *C.char, proxy *C.char, sendType int) int {
-	return WmInit(C.GoString(path), C.GoString(proxy), sendType)
+func CWmInit(path *C.char, sendType int) int {
+	return WmInit(C.GoString(path), sendType)
 }
 
 //export CWmLogin
@@ -76,6 +90,11 @@ func CWmGetStatus(connId int, userId *C.char) int {
 	return WmGetStatus(connId, C.GoString(userId))
 }
 
+//export CWmSetCurrentChat
+func CWmSetCurrentChat(connId int, chatId *C.char) int {
+	return WmSetCurrentChat(connId, C.GoString(chatId))
+}
+
 //export CWmMarkMessageRead
 func CWmMarkMessageRead(connId int, chatId *C.char, senderId *C.char, msgId *C.char) int {
 	return WmMarkMessageRead(connId, C.GoString(chatId), C.GoString(senderId), C.GoString(msgId))
@@ -102,8 +121,8 @@ func CWmSendStatus(connId int, isOnline int) int {
 }
 
 //export CWmDownloadFile
-func CWmDownloadFile(connId int, chatId *C.char, msgId *C.char, fileId *C.char, action int) int {
-	return WmDownloadFile(connId, C.GoString(chatId), C.GoString(msgId), C.GoString(fileId), action)
+func CWmDownloadFile(connId int, chatId *C.char, msgId *C.char, fileId *C.char, senderId *C.char, isFromMe int, action int) int {
+	return WmDownloadFile(connId, C.GoString(chatId), C.GoString(msgId), C.GoString(fileId), C.GoString(senderId), isFromMe, action)
 }
 
 //export CWmSendReaction
@@ -111,16 +130,97 @@ func CWmSendReaction(connId int, chatId *C.char, senderId *C.char, msgId *C.char
 	return WmSendReaction(connId, C.GoString(chatId), C.GoString(senderId), C.GoString(msgId), C.GoString(emoji))
 }
 
-func CWmNewContactsNotify(connId int, chatId string, name string, phone string, isSelf int) {
-	C.WmNewContactsNotify(C.int(connId), C.CString(chatId), C.CString(name), C.CString(phone), C.int(isSelf))
+//export CWmSetBlocked
+func CWmSetBlocked(connId int, userId *C.char, isBlocked int) int {
+	return WmSetBlocked(connId, C.GoString(userId), isBlocked)
+}
+
+//export CWmGetPrivacySettings
+func CWmGetPrivacySettings(connId int) int {
+	return WmGetPrivacySettings(connId)
+}
+
+//export CWmSetPrivacySetting
+func CWmSetPrivacySetting(connId int, name *C.char, value *C.char) int {
+	return WmSetPrivacySetting(connId, C.GoString(name), C.GoString(value))
+}
+
+//export CWmGetProfilePicture
+func CWmGetProfilePicture(connId int, chatId *C.char) int {
+	return WmGetProfilePicture(connId, C.GoString(chatId))
+}
+
+//export CWmGetSelfProfile
+func CWmGetSelfProfile(connId int) int {
+	return WmGetSelfProfile(connId)
+}
+
+//export CWmSetPushName
+func CWmSetPushName(connId int, pushName *C.char) int {
+	return WmSetPushName(connId, C.GoString(pushName))
+}
+
+//export CWmSetAbout
+func CWmSetAbout(connId int, about *C.char) int {
+	return WmSetAbout(connId, C.GoString(about))
+}
+
+//export CWmSetSelfProfilePicture
+func CWmSetSelfProfilePicture(connId int, filePath *C.char) int {
+	return WmSetSelfProfilePicture(connId, C.GoString(filePath))
+}
+
+//export CWmGetUserDetails
+func CWmGetUserDetails(connId int, userId *C.char) int {
+	return WmGetUserDetails(connId, C.GoString(userId))
+}
+
+//export CWmLookupPhones
+func CWmLookupPhones(connId int, phones *C.char) int {
+	return WmLookupPhones(connId, C.GoString(phones))
+}
+
+//export CWmResolveLinks
+func CWmResolveLinks(connId int, text *C.char) int {
+	return WmResolveLinks(connId, C.GoString(text))
+}
+
+//export CWmGetContactQrLink
+func CWmGetContactQrLink(connId int, revoke int, show int) int {
+	return WmGetContactQrLink(connId, revoke, show)
+}
+
+//export CWmForwardMessage
+func CWmForwardMessage(connId int, chatId *C.char, msgId *C.char, fileId *C.char, fileType *C.char, text *C.char, toChatIds *C.char) int {
+	return WmForwardMessage(connId, C.GoString(chatId), C.GoString(msgId), C.GoString(fileId), C.GoString(fileType), C.GoString(text), C.GoString(toChatIds))
+}
+
+//export CWmSetTombstonesEnabled
+func CWmSetTombstonesEnabled(connId int, isEnabled int) int {
+	return WmSetTombstonesEnabled(connId, isEnabled)
+}
+
+//export CWmSetProxy
+func CWmSetProxy(connId int, proxy *C.char, mediaProxy *C.char, isLoginOnly int) int {
+	return WmSetProxy(connId, C.GoString(proxy), C.GoString(mediaProxy), isLoginOnly)
+}
+
+//export CWmSetMarkdownEnabled
+func CWmSetMarkdownEnabled(connId int, isEnabled int) int {
+	return WmSetMarkdownEnabled(connId, isEnabled)
+}
+
+func CWmNewContactsNotify(connId int, chatId string, name string, phone string, isSelf int, isBlocked int) {
+	C.WmNewContactsNotify(C.int(connId), C.CString(chatId), C.CString(name), C.CString(phone), C.int(isSelf), C.int(isBlocked))
 }
 
 func CWmNewChatsNotify(connId int, chatId string, isUnread int, isMuted int, isPinned int, lastMessageTime int) {
 	C.WmNewChatsNotify(C.int(connId), C.CString(chatId), C.int(isUnread), C.int(isMuted), C.int(isPinned), C.int(lastMessageTime))
 }
 
-func CWmNewMessagesNotify(connId int, chatId string, msgId string, senderId string, text string, fromMe int, quotedId string, fileId string, filePath string, fileStatus int, timeSent int, isRead int) {
-	C.WmNewMessagesNotify(C.int(connId), C.CString(chatId), C.CString(msgId), C.CString(senderId), C.CString(text), C.int(fromMe), C.CString(quotedId), C.CString(fileId), C.CString(filePath), C.int(fileStatus), C.int(timeSent), C.int(isRead))
+func CWmNewMessagesNotify(connId int, chatId string, msgId string, senderId string, text string, fromMe int, quotedId string, fileId string, filePath string, thumbPath string, fileStatus int, timeSent int, isRead int) {
+	isVoiceNote, durationSec := GetFileIdAudioInfo(fileId)
+	C.WmNewMessagesNotify(C.int(connId), C.CString(chatId), C.CString(msgId), C.CString(senderId), C.CString(text), C.int(fromMe), C.CString(quotedId), C.CString(fileId), C.CString(filePath), C.CString(thumbPath), C.int(fileStatus), C.int(BoolToInt(isVoiceNote)), C.int(durationSec), C.int(timeSent), C.int(isRead))
 }
 
 func CWmNewStatusNotify(connId int, chatId string, userId string, isOnline int, isTyping int, timeSeen int) {
@@ -131,12 +231,29 @@ func CWmNewMessageStatusNotify(connId int, chatId string, msgId string, isRead i
 	C.WmNewMessageStatusNotify(C.int(connId), C.CString(chatId), C.CString(msgId), C.int(isRead))
 }
 
-func CWmNewMessageFileNotify(connId int, chatId string, msgId string, filePath string, fileStatus int, action int) {
-	C.WmNewMessageFileNotify(C.int(connId), C.CString(chatId), C.CString(msgId), C.CString(filePath), C.int(fileStatus), C.int(action))
+func CWmNewMessageFileNotify(connId int, chatId string, msgId string, fileId string, filePath string, thumbPath string, fileStatus int, action int) {
+	isVoiceNote, durationSec := GetFileIdAudioInfo(fileId)
+	C.WmNewMessageFileNotify(C.int(connId), C.CString(chatId), C.CString(msgId), C.CString(fileId), C.CString(filePath), C.CString(thumbPath), C.int(fileStatus), C.int(BoolToInt(isVoiceNote)), C.int(durationSec), C.int(action))
+}
+
+func CWmNewMessageFileProgressNotify(connId int, chatId string, msgId string, percent int) {
+	C.WmNewMessageFileProgressNotify(C.int(connId), C.CString(chatId), C.CString(msgId), C.int(percent))
 }
 
-func CWmNewMessageReactionNotify(connId int, chatId string, msgId string, senderId string, text string, fromMe int) {
-	C.WmNewMessageReactionNotify(C.int(connId), C.CString(chatId), C.CString(msgId), C.CString(senderId), C.CString(text), C.int(fromMe))
+func CWmSendMessageProgressNotify(connId int, chatId string, percent int) {
+	C.WmSendMessageProgressNotify(C.int(connId), C.CString(chatId), C.int(percent))
+}
+
+func CWmNewMessageEditNotify(connId int, chatId string, msgId string, isEdited int, timeEdited int, priorText string) {
+	C.WmNewMessageEditNotify(C.int(connId), C.CString(chatId), C.CString(msgId), C.int(isEdited), C.int(timeEdited), C.CString(priorText))
+}
+
+func CWmForwardMessageNotify(connId int, chatId string, msgId string, toChatId string, isSuccess int) {
+	C.WmForwardMessageNotify(C.int(connId), C.CString(chatId), C.CString(msgId), C.CString(toChatId), C.int(isSuccess))
+}
+
+func CWmNewMessageReactionsNotify(connId int, chatId string, msgId string, selfId string, emojiSenders string, removedSenderId string) {
+	C.WmNewMessageReactionsNotify(C.int(connId), C.CString(chatId), C.CString(msgId), C.CString(selfId), C.CString(emojiSenders), C.CString(removedSenderId))
 }
 
 func CWmDeleteChatNotify(connId int, chatId string) {
@@ -155,10 +272,50 @@ func CWmUpdatePinNotify(connId int, chatId string, isPinned int, timePinned int)
 	C.WmUpdatePinNotify(C.int(connId), C.CString(chatId), C.int(isPinned), C.int(timePinned))
 }
 
+func CWmUpdatePrivacySettingNotify(connId int, name string, value string) {
+	C.WmUpdatePrivacySettingNotify(C.int(connId), C.CString(name), C.CString(value))
+}
+
+func CWmNewProfilePictureNotify(connId int, chatId string, filePath string) {
+	C.WmNewProfilePictureNotify(C.int(connId), C.CString(chatId), C.CString(filePath))
+}
+
+func CWmUpdateSelfProfileNotify(connId int, key string, value string) {
+	C.WmUpdateSelfProfileNotify(C.int(connId), C.CString(key), C.CString(value))
+}
+
+func CWmNewUserDetailsNotify(connId int, userId string, about string, verifiedName string, deviceCount int, isBusiness int, address string, email string, categories string, businessHours string) {
+	C.WmNewUserDetailsNotify(C.int(connId), C.CString(userId), C.CString(about), C.CString(verifiedName), C.int(deviceCount), C.int(isBusiness), C.CString(address), C.CString(email), C.CString(categories), C.CString(businessHours))
+}
+
+func CWmLookupPhoneNotify(connId int, phone string, userId string, verifiedName string, isRegistered int) {
+	C.WmLookupPhoneNotify(C.int(connId), C.CString(phone), C.CString(userId), C.CString(verifiedName), C.int(isRegistered))
+}
+
+func CWmNewLinkTargetNotify(connId int, chatId string, msgId string, link string, userId string, name string, text string) {
+	C.WmNewLinkTargetNotify(C.int(connId), C.CString(chatId), C.CString(msgId), C.CString(link), C.CString(userId), C.CString(name), C.CString(text))
+}
+
+func CWmNewContactQrLinkNotify(connId int, link string) {
+	C.WmNewContactQrLinkNotify(C.int(connId), C.CString(link))
+}
+
+func CWmNewConnStateNotify(connId int, state int, reason string) {
+	C.WmNewConnStateNotify(C.int(connId), C.int(state), C.CString(reason))
+}
+
 func CWmReinit(connId int) {
 	C.WmReinit(C.int(connId))
 }
 
+func CWmConnErrorNotify(connId int, message string, isReconnectable int) {
+	C.WmConnErrorNotify(C.int(connId), C.CString(message), C.int(isReconnectable))
+}
+
+func CWmErrorNotify(connId int, message string) {
+	C.WmErrorNotify(C.int(connId), C.CString(message))
+}
+
 func CWmSetProtocolUiControl(connId int, isTakeControl int) {
 	C.WmSetProtocolUiControl(C.int(connId), C.int(isTakeControl))
 }
@@ -171,7 +328,14 @@ func CWmClearStatus(flags int) {
 	C.WmClearStatus(C.int(flags))
 }
 
+// log callbacks are provided by wmchat, which is not linked in go unit tests
+var isLogEnabled = true
+
 func LOG_TRACE(message string) {
+	if !isLogEnabled {
+		return
+	}
+
 	_, filename, lineNo, ok := runtime.Caller(1)
 	if ok {
 		filename = filepath.Base(filename)
@@ -184,6 +348,10 @@ func LOG_TRACE(message string) {
 }
 
 func LOG_DEBUG(message string) {
+	if !isLogEnabled {
+		return
+	}
+
 	_, filename, lineNo, ok := runtime.Caller(1)
 	if ok {
 		filename = filepath.Base(filename)
@@ -196,6 +364,10 @@ func LOG_DEBUG(message string) {
 }
 
 func LOG_INFO(message string) {
+	if !isLogEnabled {
+		return
+	}
+
 	_, filename, lineNo, ok := runtime.Caller(1)
 	if ok {
 		filename = filepath.Base(filename)
@@ -208,6 +380,10 @@ func LOG_INFO(message string) {
 }
 
 func LOG_WARNING(message string) {
+	if !isLogEnabled {
+		return
+	}
+
 	_, filename, lineNo, ok := runtime.Caller(1)
 	if ok {
 		filename = filepath.Base(filename)
@@ -220,6 +396,10 @@ func LOG_WARNING(message string) {
 }
 
 func LOG_ERROR(message string) {
+	if !isLogEnabled {
+		return
+	}
+
 	_, filename, lineNo, ok := runtime.Caller(1)
 	if ok {
 		filename = filepath.Base(filename)
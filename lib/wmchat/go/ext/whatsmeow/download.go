@@ -7,6 +7,10 @@
 package whatsmeow
 
 import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
@@ -15,6 +19,7 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"os"
 	"strings"
 	"time"
 
@@ -358,4 +363,234 @@ type DownloadableMessageWithURL interface {
 	DownloadableMessage
 	GetUrl() string
 }
+
+// DownloadProgressFunc is called during streaming downloads with the number of encrypted bytes
+// received so far and the expected total, or -1 if the total is not known.
+type DownloadProgressFunc func(downloaded int64, total int64)
+
+// DownloadPlain downloads unencrypted data, such as profile pictures, using the media http client so that
+// any configured media proxy applies. The request is aborted if not completed within the timeout.
+func (cli *Client) DownloadPlain(url string, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare request: %w", err)
+	}
+	resp, err := cli.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, DownloadHTTPError{Response: resp}
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// ShouldRetryMediaDownload returns true if the error is transient, i.e. the download may be resumed later.
+func ShouldRetryMediaDownload(err error) bool {
+	return shouldRetryMediaDownload(err)
+}
+
+// DownloadMediaWithUrlToFile streams an attachment to disk. The encrypted data is appended to encFile, which
+// may contain a partial download from an earlier attempt that is then resumed. Once complete and verified, the
+// decrypted data is written to plainFile.
+func (cli *Client) DownloadMediaWithUrlToFile(url string, mediaKey []byte, appInfo MediaType, fileLength int, fileEncSha256 []byte, fileSha256 []byte, encFile *os.File, plainFile io.Writer, progress DownloadProgressFunc) error {
+	err := cli.downloadMediaToFileWithRetries(url, encFile, progress)
+	if err != nil {
+		return err
+	}
+	return decryptMediaFile(encFile, mediaKey, appInfo, fileLength, fileEncSha256, fileSha256, plainFile)
+}
+
+// DownloadMediaWithPathToFile is the streaming counterpart of DownloadMediaWithPath, see DownloadMediaWithUrlToFile.
+func (cli *Client) DownloadMediaWithPathToFile(directPath string, encFileHash, fileHash, mediaKey []byte, fileLength int, mediaType MediaType, mmsType string, encFile *os.File, plainFile io.Writer, progress DownloadProgressFunc) (err error) {
+	var mediaConn *MediaConn
+	mediaConn, err = cli.refreshMediaConn(false)
+	if err != nil {
+		return fmt.Errorf("failed to refresh media connections: %w", err)
+	}
+	if len(mmsType) == 0 {
+		mmsType = mediaTypeToMMSType[mediaType]
+	}
+	for i, host := range mediaConn.Hosts {
+		mediaURL := fmt.Sprintf("https://%s%s&hash=%s&mms-type=%s&__wa-mms=", host.Hostname, directPath, base64.URLEncoding.EncodeToString(encFileHash), mmsType)
+		err = cli.downloadMediaToFileWithRetries(mediaURL, encFile, progress)
+		if err == nil {
+			return decryptMediaFile(encFile, mediaKey, mediaType, fileLength, encFileHash, fileHash, plainFile)
+		} else if i >= len(mediaConn.Hosts)-1 {
+			return fmt.Errorf("failed to download media from last host: %w", err)
+		}
+		cli.Log.Warnf("Failed to download media: %s, trying with next host...", err)
+	}
+	return
+}
+
+func (cli *Client) downloadMediaToFileWithRetries(url string, encFile *os.File, progress DownloadProgressFunc) (err error) {
+	for retryNum := 0; retryNum < 5; retryNum++ {
+		err = cli.downloadMediaToFile(url, encFile, progress)
+		if err == nil || !shouldRetryMediaDownload(err) {
+			return
+		}
+		retryDuration := time.Duration(retryNum+1) * time.Second
+		var httpErr DownloadHTTPError
+		if errors.As(err, &httpErr) {
+			retryDuration = retryafter.Parse(httpErr.Response.Header.Get("Retry-After"), retryDuration)
+		}
+		cli.Log.Warnf("Failed to download media due to network error: %w, retrying in %s...", err, retryDuration)
+		time.Sleep(retryDuration)
+	}
+	return
+}
+
+func (cli *Client) downloadMediaToFile(url string, encFile *os.File, progress DownloadProgressFunc) error {
+	offset, err := encFile.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("failed to seek file: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to prepare request: %w", err)
+	}
+	req.Header.Set("Origin", socket.Origin)
+	req.Header.Set("Referer", socket.Origin+"/")
+	if cli.MessengerConfig != nil {
+		req.Header.Set("User-Agent", cli.MessengerConfig.UserAgent)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := cli.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		// resuming partial download
+	case resp.StatusCode == http.StatusOK:
+		// range not supported or fresh download, start over
+		if offset > 0 {
+			if err = encFile.Truncate(0); err != nil {
+				return fmt.Errorf("failed to truncate file: %w", err)
+			} else if _, err = encFile.Seek(0, io.SeekStart); err != nil {
+				return fmt.Errorf("failed to seek file: %w", err)
+			}
+			offset = 0
+		}
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// already fully downloaded, verified by caller
+		return nil
+	default:
+		return DownloadHTTPError{Response: resp}
+	}
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = offset + resp.ContentLength
+	}
+	buf := make([]byte, 32*1024)
+	for {
+		n, readErr := resp.Body.Read(buf)
+		if n > 0 {
+			if _, err = encFile.Write(buf[:n]); err != nil {
+				return fmt.Errorf("failed to write file: %w", err)
+			}
+			offset += int64(n)
+			if progress != nil {
+				progress(offset, total)
+			}
+		}
+		if errors.Is(readErr, io.EOF) {
+			return nil
+		} else if readErr != nil {
+			return readErr
+		}
+	}
+}
+
+func decryptMediaFile(encFile *os.File, mediaKey []byte, appInfo MediaType, fileLength int, fileEncSHA256, fileSHA256 []byte, plainFile io.Writer) error {
+	size, err := encFile.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("failed to seek file: %w", err)
+	} else if _, err = encFile.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek file: %w", err)
+	}
+	if mediaKey == nil && fileEncSHA256 == nil {
+		// Unencrypted media, just copy the downloaded data
+		_, err = io.Copy(plainFile, encFile)
+		return err
+	} else if size <= 10 {
+		return ErrTooShortFile
+	}
+
+	// verify checksum and mac in a first pass
+	iv, cipherKey, macKey, _ := getMediaKeys(mediaKey, appInfo)
+	cipherHasher := sha256.New()
+	cipherMAC := hmac.New(sha256.New, macKey)
+	cipherMAC.Write(iv)
+	if _, err = io.CopyN(io.MultiWriter(cipherHasher, cipherMAC), encFile, size-10); err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	mac := make([]byte, 10)
+	if _, err = io.ReadFull(encFile, mac); err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	cipherHasher.Write(mac)
+	if len(fileEncSHA256) == 32 && !bytes.Equal(cipherHasher.Sum(nil), fileEncSHA256) {
+		return ErrInvalidMediaEncSHA256
+	} else if !hmac.Equal(cipherMAC.Sum(nil)[:10], mac) {
+		return ErrInvalidMediaHMAC
+	} else if (size-10)%aes.BlockSize != 0 {
+		return fmt.Errorf("failed to decrypt file: ciphertext is not a multiple of the block size")
+	}
+
+	// decrypt in a second pass
+	if _, err = encFile.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek file: %w", err)
+	}
+	block, err := aes.NewCipher(cipherKey)
+	if err != nil {
+		return fmt.Errorf("failed to create cipher: %w", err)
+	}
+	cbc := cipher.NewCBCDecrypter(block, iv)
+	plainHasher := sha256.New()
+	buf := make([]byte, 32*1024)
+	remaining := size - 10
+	var written int64
+	for remaining > 0 {
+		chunk := buf
+		if remaining < int64(len(chunk)) {
+			chunk = chunk[:remaining]
+		}
+		if _, err = io.ReadFull(encFile, chunk); err != nil {
+			return fmt.Errorf("failed to read file: %w", err)
+		}
+		cbc.CryptBlocks(chunk, chunk)
+		remaining -= int64(len(chunk))
+		if remaining == 0 {
+			padLen := int(chunk[len(chunk)-1])
+			if padLen == 0 || padLen > aes.BlockSize || padLen > len(chunk) {
+				return fmt.Errorf("failed to decrypt file: invalid padding %d", padLen)
+			}
+			chunk = chunk[:len(chunk)-padLen]
+		}
+		plainHasher.Write(chunk)
+		if _, err = plainFile.Write(chunk); err != nil {
+			return fmt.Errorf("failed to write file: %w", err)
+		}
+		written += int64(len(chunk))
+	}
+	if fileLength >= 0 && written != int64(fileLength) {
+		return fmt.Errorf("%w: expected %d, got %d", ErrFileLengthMismatch, fileLength, written)
+	} else if len(fileSHA256) == 32 && !bytes.Equal(plainHasher.Sum(nil), fileSHA256) {
+		return ErrInvalidMediaSHA256
+	}
+	return nil
+}
+
+func (cli *Client) SetMediaTransport(transport *http.Transport) {
+	cli.http.Transport = transport
+}
+
 // nchat additions end
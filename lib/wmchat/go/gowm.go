@@ -8,30 +8,50 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
 	"io"
 	"io/ioutil"
+	"math"
 	"mime"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"google.golang.org/protobuf/proto"
 
 	"go.mau.fi/whatsmeow/proto/waCompanionReg"
 	"go.mau.fi/whatsmeow/proto/waE2E"
+	"go.mau.fi/whatsmeow/proto/waMmsRetry"
 	"go.mau.fi/whatsmeow/proto/waWeb"
 	"go.mau.fi/whatsmeow/store"
 
 	"github.com/mdp/qrterminal"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"golang.org/x/net/proxy"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/skip2/go-qrcode"
@@ -56,25 +76,97 @@ type intString struct {
 
 type State int64
 
+type RecentMessage struct {
+	Info    types.MessageInfo
+	Message *waE2E.Message
+}
+
+type RecentMessages struct {
+	messages map[string]RecentMessage
+	keys     []string
+}
+
+type MessageReactions struct {
+	senderEmojis map[string]map[string]string
+	keys         []string
+}
+
+type EditVersion struct {
+	Text       string
+	TimeEdited time.Time // time when this version was replaced
+}
+
+type EditHistory struct {
+	versions map[string][]EditVersion
+	keys     []string
+}
+
+type LastSeen struct {
+	IsOnline bool
+	TimeSeen time.Time
+}
+
+type Presences struct {
+	subscribed map[string]bool // successfully subscribed, re-sent upon reconnect
+	queued     map[string]bool // awaiting subscription
+	pending    []string
+	isFlushing bool
+	lastSeen   map[string]LastSeen
+}
+
+type PendingDownload struct {
+	chatId string
+	msgId  string
+	fileId string
+	action int
+}
+
+// connection states, keep in sync with ConnStateToString and ConnStateToFlags in wmchat.cpp
 const (
 	None State = iota
 	Connecting
-	Connected
-	Disconnected
+	Syncing
+	Online
+	Degraded
+	Reconnecting
+	Replaced
+	Banned
+	LoggedOut
 	Outdated
+	Disconnected
 )
 
 var (
-	mx        sync.Mutex
-	clients   map[int]*whatsmeow.Client    = make(map[int]*whatsmeow.Client)
-	paths     map[int]string               = make(map[int]string)
-	contacts  map[int]map[string]string    = make(map[int]map[string]string)
-	states    map[int]State                = make(map[int]State)
-	timeReads map[int]map[string]time.Time = make(map[int]map[string]time.Time)
-	handlers  map[int]*WmEventHandler      = make(map[int]*WmEventHandler)
-	sendTypes map[int]int                  = make(map[int]int)
+	mx         sync.Mutex
+	clients    map[int]*whatsmeow.Client                  = make(map[int]*whatsmeow.Client)
+	paths      map[int]string                             = make(map[int]string)
+	contacts   map[int]map[string]string                  = make(map[int]map[string]string)
+	states     map[int]State                              = make(map[int]State)
+	timeReads  map[int]map[string]time.Time               = make(map[int]map[string]time.Time)
+	handlers   map[int]*WmEventHandler                    = make(map[int]*WmEventHandler)
+	sendTypes  map[int]int                                = make(map[int]int)
+	blocked    map[int]map[string]bool                    = make(map[int]map[string]bool)
+	blockFetch map[int]chan struct{}                      = make(map[int]chan struct{})
+	pictures   map[int]map[string]string                  = make(map[int]map[string]string)
+	retries    map[int]map[string]chan *events.MediaRetry = make(map[int]map[string]chan *events.MediaRetry)
+	downloads  map[int]map[string]PendingDownload         = make(map[int]map[string]PendingDownload)
+	markdowns  map[int]bool                               = make(map[int]bool)
+	tombstones map[int]bool                               = make(map[int]bool)
+	recents    map[int]*RecentMessages                    = make(map[int]*RecentMessages)
+	edits      map[int]*EditHistory                       = make(map[int]*EditHistory)
+	reactions  map[int]*MessageReactions                  = make(map[int]*MessageReactions)
+	typings    map[int]map[string]*time.Timer             = make(map[int]map[string]*time.Timer)
+	presences  map[int]*Presences                         = make(map[int]*Presences)
+	stateChans map[int]chan struct{}                      = make(map[int]chan struct{})
+	offlines   map[int]bool                               = make(map[int]bool)
+	reasons    map[int]string                             = make(map[int]string)
 )
 
+// self profile keys
+var ProfileKeyPushName = "pushname"
+var ProfileKeyAbout = "about"
+var ProfileKeyPicture = "picture"
+
 // keep in sync with enum FileStatus in protocol.h
 var FileStatusNone = -1
 var FileStatusNotDownloaded = 0
@@ -82,6 +174,14 @@ var FileStatusDownloaded = 1
 var FileStatusDownloading = 2
 var FileStatusDownloadFailed = 3
 
+// keep in sync with enum DownloadFileAction in protocol.h
+var DownloadFileActionNone = 0
+
+// typing states, as passed in isTyping
+var TypingNone = 0
+var TypingText = 1
+var TypingAudio = 2
+
 // keep in sync with enum Flag in status.h
 var FlagNone = 0
 var FlagOffline = (1 << 0)
@@ -92,6 +192,8 @@ var FlagSending = (1 << 4)
 var FlagUpdating = (1 << 5)
 var FlagSyncing = (1 << 6)
 var FlagAway = (1 << 7)
+var FlagReconnecting = (1 << 8)
+var FlagDegraded = (1 << 9)
 
 func AddConn(conn *whatsmeow.Client, path string, sendType int) int {
 	mx.Lock()
@@ -100,9 +202,23 @@ func AddConn(conn *whatsmeow.Client, path string, sendType int) int {
 	paths[connId] = path
 	contacts[connId] = make(map[string]string)
 	states[connId] = None
+	stateChans[connId] = make(chan struct{})
+	offlines[connId] = false
+	reasons[connId] = ""
 	timeReads[connId] = make(map[string]time.Time)
-	handlers[connId] = &WmEventHandler{connId}
+	handlers[connId] = &WmEventHandler{connId: connId}
 	sendTypes[connId] = sendType
+	blocked[connId] = make(map[string]bool)
+	pictures[connId] = make(map[string]string)
+	retries[connId] = make(map[string]chan *events.MediaRetry)
+	downloads[connId] = make(map[string]PendingDownload)
+	markdowns[connId] = false
+	tombstones[connId] = false
+	recents[connId] = &RecentMessages{messages: make(map[string]RecentMessage)}
+	edits[connId] = &EditHistory{versions: make(map[string][]EditVersion)}
+	reactions[connId] = &MessageReactions{senderEmojis: make(map[string]map[string]string)}
+	typings[connId] = make(map[string]*time.Timer)
+	presences[connId] = &Presences{subscribed: make(map[string]bool), queued: make(map[string]bool), lastSeen: make(map[string]LastSeen)}
 	mx.Unlock()
 	return connId
 }
@@ -116,6 +232,24 @@ func RemoveConn(connId int) {
 	delete(timeReads, connId)
 	delete(handlers, connId)
 	delete(sendTypes, connId)
+	delete(blocked, connId)
+	delete(pictures, connId)
+	delete(retries, connId)
+	delete(downloads, connId)
+	delete(markdowns, connId)
+	delete(tombstones, connId)
+	delete(recents, connId)
+	delete(edits, connId)
+	delete(reactions, connId)
+	delete(blockFetch, connId)
+	for _, timer := range typings[connId] {
+		timer.Stop()
+	}
+	delete(typings, connId)
+	delete(presences, connId)
+	delete(stateChans, connId)
+	delete(offlines, connId)
+	delete(reasons, connId)
 	mx.Unlock()
 }
 
@@ -157,7 +291,155 @@ func GetState(connId int) State {
 func SetState(connId int, status State) {
 	mx.Lock()
 	states[connId] = status
+
+	// wake up any waiters
+	if stateChan, ok := stateChans[connId]; ok {
+		close(stateChan)
+		stateChans[connId] = make(chan struct{})
+	}
+	mx.Unlock()
+}
+
+func WaitState(connId int, timeout time.Duration, isDone func(State) bool) State {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		mx.Lock()
+		var state State = states[connId]
+		var stateChan chan struct{} = stateChans[connId]
+		mx.Unlock()
+
+		if isDone(state) {
+			return state
+		}
+
+		select {
+		case <-stateChan:
+		case <-timer.C:
+			return GetState(connId)
+		}
+	}
+}
+
+func GetStateReason(connId int) string {
+	mx.Lock()
+	var reason string = reasons[connId]
+	mx.Unlock()
+	return reason
+}
+
+func SetStateReason(connId int, reason string) {
+	mx.Lock()
+	reasons[connId] = reason
+	mx.Unlock()
+}
+
+func SetOfflineSynced(connId int, isSynced bool) {
+	mx.Lock()
+	offlines[connId] = isSynced
+	mx.Unlock()
+}
+
+func IsOfflineSynced(connId int) bool {
+	mx.Lock()
+	var isSynced bool = offlines[connId]
 	mx.Unlock()
+	return isSynced
+}
+
+func IsConnectedState(state State) bool {
+	return (state == Syncing) || (state == Online) || (state == Degraded)
+}
+
+func IsTerminalState(state State) bool {
+	return (state == Replaced) || (state == Banned) || (state == LoggedOut) || (state == Outdated) || (state == Disconnected)
+}
+
+func SetConnState(connId int, state State, reason string) {
+	prevState := GetState(connId)
+	SetStateReason(connId, reason) // before state, for waiters
+	SetState(connId, state)
+
+	if (state == Connecting) || (state == Reconnecting) {
+		SetOfflineSynced(connId, false)
+	}
+
+	if (prevState != state) || (len(reason) > 0) {
+		LOG_TRACE(fmt.Sprintf("Call CWmNewConnStateNotify %d -> %d %s", prevState, state, reason))
+		CWmNewConnStateNotify(connId, int(state), reason)
+	}
+}
+
+func NotifyConnError(connId int, message string, isReconnectable bool) {
+	LOG_WARNING(fmt.Sprintf("connection error %s", message))
+	LOG_TRACE(fmt.Sprintf("Call CWmConnErrorNotify %s %s", message, strconv.FormatBool(isReconnectable)))
+	CWmConnErrorNotify(connId, message, BoolToInt(isReconnectable))
+}
+
+func FormatCountdown(duration time.Duration) string {
+	duration = duration.Round(time.Minute)
+	days := int(duration.Hours()) / 24
+	hours := int(duration.Hours()) % 24
+	minutes := int(duration.Minutes()) % 60
+	if days > 0 {
+		return fmt.Sprintf("%dd %dh %dm", days, hours, minutes)
+	} else if hours > 0 {
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	} else {
+		return fmt.Sprintf("%dm", minutes)
+	}
+}
+
+func GetTemporaryBanMessage(tempBan *events.TemporaryBan) string {
+	message := "Your account has been temporarily banned by WhatsApp, reason " + tempBan.Code.String() + "."
+	if tempBan.Expire > 0 {
+		timeExpire := time.Now().Add(tempBan.Expire)
+		message += fmt.Sprintf(" The ban expires in %s (at %s).", FormatCountdown(tempBan.Expire), timeExpire.Format("2006-01-02 15:04"))
+	}
+
+	return message
+}
+
+func GetClientOutdatedMessage() string {
+	return "WhatsApp client is outdated, please update nchat to a newer version. See: " +
+		"https://github.com/d99kris/nchat/blob/master/doc/WMOUTDATED.md"
+}
+
+func GetConnectFailureMessage(reason events.ConnectFailureReason, serverMessage string) string {
+	var message string
+	switch reason {
+	case events.ConnectFailureLoggedOut:
+		message = "This device was logged out from another device, please link it again."
+	case events.ConnectFailureMainDeviceGone:
+		message = "The primary device was logged out or the account is locked, please link this device again."
+	case events.ConnectFailureUnknownLogout:
+		message = "WhatsApp logged out this device for an unknown reason, the account may be banned."
+	case events.ConnectFailureTempBanned:
+		message = "Your account has been temporarily banned by WhatsApp."
+	case events.ConnectFailureClientOutdated:
+		message = GetClientOutdatedMessage()
+	case events.ConnectFailureBadUserAgent:
+		message = "WhatsApp rejected the client user agent, please update nchat to a newer version."
+	case events.ConnectFailureInternalServerError, events.ConnectFailureExperimental:
+		message = "WhatsApp server error, please try reconnecting later."
+	case events.ConnectFailureServiceUnavailable:
+		message = "WhatsApp service is temporarily unavailable, please try reconnecting later."
+	default:
+		message = fmt.Sprintf("Connection failed with an unknown error (%s).", reason.String())
+	}
+
+	if len(serverMessage) > 0 {
+		message += " Server message: " + serverMessage
+	}
+
+	return message
+}
+
+func IsReconnectableFailure(reason events.ConnectFailureReason) bool {
+	// reconnecting after these only repeats the failure, or worse
+	return !reason.IsLoggedOut() && (reason != events.ConnectFailureTempBanned) &&
+		(reason != events.ConnectFailureClientOutdated) && (reason != events.ConnectFailureBadUserAgent)
 }
 
 func AddContactName(connId int, id string, name string) {
@@ -178,1600 +460,5047 @@ func GetContactName(connId int, id string) string {
 	return name
 }
 
-func GetTimeRead(connId int, chatId string) time.Time {
-	var timeRead time.Time
-	var ok bool
+func SetBlocked(connId int, userId string, isBlocked bool) {
 	mx.Lock()
-	timeRead, ok = timeReads[connId][chatId]
+	if isBlocked {
+		blocked[connId][userId] = true
+	} else {
+		delete(blocked[connId], userId)
+	}
 	mx.Unlock()
-	if !ok {
-		timeRead = time.Time{}
+}
+
+func IsBlocked(connId int, userId string) bool {
+	mx.Lock()
+	var isBlocked bool = blocked[connId][userId]
+	mx.Unlock()
+	return isBlocked
+}
+
+func GetBlocked(connId int) []string {
+	var userIds []string
+	mx.Lock()
+	for userId := range blocked[connId] {
+		userIds = append(userIds, userId)
 	}
-	return timeRead
+	mx.Unlock()
+	return userIds
 }
 
-func SetTimeRead(connId int, chatId string, timeRead time.Time) {
+func GetPictureId(connId int, chatId string) string {
 	mx.Lock()
-	timeReads[connId][chatId] = timeRead
+	var pictureId string = pictures[connId][chatId]
 	mx.Unlock()
+	return pictureId
 }
 
-// download info
-var downloadInfoVersion = 1 // bump version upon any struct change
-type DownloadInfo struct {
-	Version    int    `json:"Version_int"`
-	Url        string `json:"Url_string"`
-	DirectPath string `json:"DirectPath_string"`
+func SetPictureId(connId int, chatId string, pictureId string) {
+	mx.Lock()
+	if len(pictureId) > 0 {
+		pictures[connId][chatId] = pictureId
+	} else {
+		delete(pictures[connId], chatId)
+	}
+	mx.Unlock()
+}
 
-	TargetPath string              `json:"TargetPath_string"`
-	MediaKey   []byte              `json:"MediaKey_arraybyte"`
-	MediaType  whatsmeow.MediaType `json:"MediaType_MediaType"`
-	Size       int                 `json:"Size_int"`
+// media retries are keyed by chat and message id, as message ids are only unique per chat
+func MediaRetryKey(chatId string, msgId string) string {
+	return chatId + "/" + msgId
+}
 
-	FileEncSha256 []byte `json:"FileEncSha256_arraybyte"`
-	FileSha256    []byte `json:"FileSha256_arraybyte"`
+func AddMediaRetry(connId int, chatId string, msgId string) chan *events.MediaRetry {
+	retryChan := make(chan *events.MediaRetry, 1)
+	mx.Lock()
+	retries[connId][MediaRetryKey(chatId, msgId)] = retryChan
+	mx.Unlock()
+	return retryChan
 }
 
-func DownloadableMessageToFileId(client *whatsmeow.Client, msg whatsmeow.DownloadableMessage, targetPath string) string {
-	var info DownloadInfo
-	info.Version = downloadInfoVersion
+func RemoveMediaRetry(connId int, chatId string, msgId string) {
+	mx.Lock()
+	delete(retries[connId], MediaRetryKey(chatId, msgId))
+	mx.Unlock()
+}
 
-	info.TargetPath = targetPath
-	info.MediaKey = msg.GetMediaKey()
-	info.Size = whatsmeow.GetDownloadSize(msg)
-	info.FileEncSha256 = msg.GetFileEncSHA256()
-	info.FileSha256 = msg.GetFileSHA256()
+func GetMediaRetry(connId int, chatId string, msgId string) chan *events.MediaRetry {
+	mx.Lock()
+	retryChan := retries[connId][MediaRetryKey(chatId, msgId)]
+	mx.Unlock()
+	return retryChan
+}
 
-	info.MediaType = whatsmeow.GetMediaType(msg)
-	if len(info.MediaType) == 0 {
-		LOG_WARNING(fmt.Sprintf("unknown mediatype '%s'", string(msg.ProtoReflect().Descriptor().Name())))
-		return ""
-	}
+func AddPendingDownload(connId int, download PendingDownload) {
+	mx.Lock()
+	downloads[connId][download.msgId] = download
+	mx.Unlock()
+}
 
-	urlable, ok := msg.(whatsmeow.DownloadableMessageWithURL)
-	if ok && len(urlable.GetUrl()) > 0 {
-		info.Url = urlable.GetUrl()
-	} else if len(msg.GetDirectPath()) > 0 {
-		info.DirectPath = msg.GetDirectPath()
-	} else {
-		LOG_WARNING(fmt.Sprintf("url and path not present"))
-		return ""
-	}
+func RemovePendingDownload(connId int, msgId string) {
+	mx.Lock()
+	delete(downloads[connId], msgId)
+	mx.Unlock()
+}
 
-	LOG_TRACE(fmt.Sprintf("fileInfo %#v", info))
-	bytes, err := json.Marshal(info)
-	if err != nil {
-		LOG_WARNING(fmt.Sprintf("json encode failed"))
-		return ""
+func TakePendingDownloads(connId int) []PendingDownload {
+	var pendingDownloads []PendingDownload
+	mx.Lock()
+	for _, download := range downloads[connId] {
+		pendingDownloads = append(pendingDownloads, download)
 	}
+	downloads[connId] = make(map[string]PendingDownload)
+	mx.Unlock()
+	return pendingDownloads
+}
 
-	str := string(bytes)
-	LOG_TRACE(fmt.Sprintf("fileId %s", str))
+func SetMarkdownEnabled(connId int, isEnabled bool) {
+	mx.Lock()
+	markdowns[connId] = isEnabled
+	mx.Unlock()
+}
 
-	return str
+func IsMarkdownEnabled(connId int) bool {
+	mx.Lock()
+	var isEnabled bool = markdowns[connId]
+	mx.Unlock()
+	return isEnabled
 }
 
-func DownloadFromFileId(client *whatsmeow.Client, fileId string) (string, int) {
-	LOG_TRACE(fmt.Sprintf("fileId %s", fileId))
-	var info DownloadInfo
-	json.Unmarshal([]byte(fileId), &info)
-	if info.Version != downloadInfoVersion {
-		LOG_WARNING(fmt.Sprintf("unsupported version %d", info.Version))
-		return "", FileStatusDownloadFailed
-	}
+func SetTombstonesEnabled(connId int, isEnabled bool) {
+	mx.Lock()
+	tombstones[connId] = isEnabled
+	mx.Unlock()
+}
 
-	LOG_TRACE(fmt.Sprintf("fileInfo %#v", info))
+func IsTombstonesEnabled(connId int) bool {
+	mx.Lock()
+	var isEnabled bool = tombstones[connId]
+	mx.Unlock()
+	return isEnabled
+}
 
-	targetPath := info.TargetPath
-	filePath := ""
-	fileStatus := FileStatusNone
+// number of recent messages kept for quoting
+var recentMessagesMax = 1000
 
-	// download if not yet present
-	if _, statErr := os.Stat(targetPath); os.IsNotExist(statErr) {
-		LOG_TRACE(fmt.Sprintf("download new %#v", targetPath))
-		CWmSetStatus(FlagFetching)
+func AddRecentMessage(connId int, chatId string, info types.MessageInfo, msg *waE2E.Message) {
+	key := chatId + "/" + info.ID
+	mx.Lock()
+	recent := recents[connId]
+	if _, ok := recent.messages[key]; !ok {
+		recent.keys = append(recent.keys, key)
+		if len(recent.keys) > recentMessagesMax {
+			delete(recent.messages, recent.keys[0])
+			recent.keys = recent.keys[1:]
+		}
+	}
+	recent.messages[key] = RecentMessage{Info: info, Message: msg}
+	mx.Unlock()
+}
 
-		data, err := DownloadFromFileInfo(client, info)
-		if err != nil {
-			LOG_WARNING(fmt.Sprintf("download error %#v", err))
-			fileStatus = FileStatusDownloadFailed
-		} else {
-			file, err := os.Create(targetPath)
-			defer file.Close()
-			if err != nil {
-				LOG_WARNING(fmt.Sprintf("create error %#v", err))
-				fileStatus = FileStatusDownloadFailed
-			} else {
-				_, err = file.Write(data)
-				if err != nil {
-					LOG_WARNING(fmt.Sprintf("write error %#v", err))
-					fileStatus = FileStatusDownloadFailed
-				} else {
-					LOG_TRACE(fmt.Sprintf("download ok"))
-					filePath = targetPath
-					fileStatus = FileStatusDownloaded
-				}
+func RemoveRecentMessage(connId int, chatId string, msgId string) {
+	key := chatId + "/" + msgId
+	mx.Lock()
+	recent := recents[connId]
+	if _, ok := recent.messages[key]; ok {
+		delete(recent.messages, key)
+		for i, k := range recent.keys {
+			if k == key {
+				recent.keys = append(recent.keys[:i], recent.keys[i+1:]...)
+				break
 			}
 		}
-		CWmClearStatus(FlagFetching)
-	} else {
-		LOG_TRACE(fmt.Sprintf("download cached %#v", targetPath))
-		filePath = targetPath
-		fileStatus = FileStatusDownloaded
+	}
+	mx.Unlock()
+}
+
+// prior versions of edited messages, bounded in number of messages and versions per message
+var editHistoryMax = 1000
+var editVersionsMax = 10
+
+func AddEditVersion(connId int, chatId string, msgId string, text string, timeEdited time.Time) {
+	key := chatId + "/" + msgId
+	mx.Lock()
+	history := edits[connId]
+	if _, ok := history.versions[key]; !ok {
+		history.keys = append(history.keys, key)
+		if len(history.keys) > editHistoryMax {
+			delete(history.versions, history.keys[0])
+			history.keys = history.keys[1:]
+		}
+	}
+
+	versions := append(history.versions[key], EditVersion{Text: text, TimeEdited: timeEdited})
+	if len(versions) > editVersionsMax {
+		versions = versions[len(versions)-editVersionsMax:]
 	}
 
-	return filePath, fileStatus
+	history.versions[key] = versions
+	mx.Unlock()
+}
+
+func GetEditHistory(connId int, chatId string, msgId string) []EditVersion {
+	key := chatId + "/" + msgId
+	mx.Lock()
+	versions := append([]EditVersion{}, edits[connId].versions[key]...)
+	mx.Unlock()
+	return versions
 }
 
-func DownloadFromFileInfo(client *whatsmeow.Client, info DownloadInfo) ([]byte, error) {
+// number of messages for which reactions are aggregated
+var reactionsMax = 1000
 
-	if len(info.Url) > 0 {
-		LOG_TRACE(fmt.Sprintf("download url: %s", info.Url))
-		return client.DownloadMediaWithUrl(info.Url, info.MediaKey, info.MediaType, info.Size, info.FileEncSha256, info.FileSha256)
-	} else if len(info.DirectPath) > 0 {
-		LOG_TRACE(fmt.Sprintf("download directpath: %s", info.DirectPath))
-		return client.DownloadMediaWithPath(info.DirectPath, info.FileEncSha256, info.FileSha256, info.MediaKey, info.Size, info.MediaType, whatsmeow.GetMMSType(info.MediaType))
+func UpdateReaction(connId int, chatId string, msgId string, senderId string, emoji string) {
+	key := chatId + "/" + msgId
+	mx.Lock()
+	aggregate := reactions[connId]
+	senderEmojis, ok := aggregate.senderEmojis[key]
+	if !ok {
+		senderEmojis = make(map[string]string)
+		aggregate.senderEmojis[key] = senderEmojis
+		aggregate.keys = append(aggregate.keys, key)
+		if len(aggregate.keys) > reactionsMax {
+			delete(aggregate.senderEmojis, aggregate.keys[0])
+			aggregate.keys = aggregate.keys[1:]
+		}
+	}
+
+	// one reaction per sender, empty emoji removes it
+	if len(emoji) > 0 {
+		senderEmojis[senderId] = emoji
 	} else {
-		LOG_WARNING(fmt.Sprintf("url and path not present"))
-		return nil, whatsmeow.ErrNoURLPresent
+		delete(senderEmojis, senderId)
 	}
+	mx.Unlock()
 }
 
-// utils
-func ShowImage(path string) {
-	switch runtime.GOOS {
-	case "linux":
-		LOG_DEBUG("xdg-open " + path)
-		exec.Command("xdg-open", path).Start()
-	case "darwin":
-		LOG_DEBUG("open " + path)
-		exec.Command("open", path).Start()
-	default:
-		LOG_WARNING(fmt.Sprintf("unsupported os \"%s\"", runtime.GOOS))
+func GetReactions(connId int, chatId string, msgId string) map[string][]string {
+	key := chatId + "/" + msgId
+	emojiSenders := make(map[string][]string)
+	mx.Lock()
+	for senderId, emoji := range reactions[connId].senderEmojis[key] {
+		emojiSenders[emoji] = append(emojiSenders[emoji], senderId)
 	}
+	mx.Unlock()
+
+	for _, senders := range emojiSenders {
+		sort.Strings(senders)
+	}
+
+	return emojiSenders
 }
 
-func HasGUI() bool {
-	_, isForceQrTerminalSet := os.LookupEnv("FORCE_QR_TERMINAL")
-	if isForceQrTerminalSet {
-		return false
+// serialize emoji senders as one "emoji<tab>sender,sender" line per emoji
+func FormatReactions(emojiSenders map[string][]string) string {
+	emojis := make([]string, 0, len(emojiSenders))
+	for emoji := range emojiSenders {
+		emojis = append(emojis, emoji)
 	}
 
-	switch runtime.GOOS {
-	case "darwin":
-		LOG_INFO(fmt.Sprintf("has gui"))
-		LOG_DEBUG(fmt.Sprintf("gui check: [darwin default true]"))
-		return true
+	sort.Strings(emojis)
+	lines := make([]string, 0, len(emojis))
+	for _, emoji := range emojis {
+		lines = append(lines, emoji+"\t"+strings.Join(emojiSenders[emoji], ","))
+	}
 
-	case "linux":
-		_, isDisplaySet := os.LookupEnv("DISPLAY")
-		file, err := ioutil.TempFile("/tmp", "nchat-x11check.*.sh")
-		if err != nil {
-			LOG_WARNING(fmt.Sprintf("create file failed %#v", err))
-			return isDisplaySet
-		}
+	return strings.Join(lines, "\n")
+}
 
-		defer os.Remove(file.Name())
-		content := "#!/usr/bin/env bash\n\n" +
-			"if command -v timeout &> /dev/null; then\n" +
-			"  CMD=\"timeout 1s xset q\"\n" +
-			"else\n" +
-			"  CMD=\"xset q\"\n" +
-			"fi\n" +
-			"echo \"${CMD}\"\n" +
-			"${CMD} > /dev/null\n" +
-			"exit ${?}\n"
+func GetRecentMessage(connId int, chatId string, msgId string) *waE2E.Message {
+	key := chatId + "/" + msgId
+	mx.Lock()
+	var msg *waE2E.Message = recents[connId].messages[key].Message
+	mx.Unlock()
+	return msg
+}
 
-		_, err = io.WriteString(file, content)
-		if err != nil {
-			LOG_WARNING(fmt.Sprintf("write file failed %#v", err))
-			return isDisplaySet
-		}
+func GetRecentMessageInfo(connId int, chatId string, msgId string) (types.MessageInfo, bool) {
+	key := chatId + "/" + msgId
+	mx.Lock()
+	recent, ok := recents[connId].messages[key]
+	mx.Unlock()
+	return recent.Info, ok
+}
 
-		err = file.Close()
-		if err != nil {
-			LOG_WARNING(fmt.Sprintf("close file failed %#v", err))
-			return isDisplaySet
-		}
+// composing state not paused or refreshed within timeout is considered stale
+var typingTimeout = 25 * time.Second
 
-		err = os.Chmod(file.Name(), 0777)
-		if err != nil {
-			LOG_WARNING(fmt.Sprintf("chmod file failed %#v", err))
-			return isDisplaySet
+func StartTypingTimeout(connId int, chatId string, userId string) {
+	key := chatId + "/" + userId
+	mx.Lock()
+	if prevTimer, ok := typings[connId][key]; ok {
+		prevTimer.Stop()
+	}
+
+	var timer *time.Timer
+	timer = time.AfterFunc(typingTimeout, func() {
+		mx.Lock()
+		isCurrent := (typings[connId] != nil) && (typings[connId][key] == timer)
+		if isCurrent {
+			delete(typings[connId], key)
 		}
+		mx.Unlock()
 
-		cmdout, err := exec.Command(file.Name()).CombinedOutput()
-		if err == nil {
-			LOG_INFO(fmt.Sprintf("has gui"))
-			LOG_DEBUG(fmt.Sprintf("gui check: %s", strings.TrimSuffix(string(cmdout), "\n")))
-			return true
-		} else {
-			LOG_INFO(fmt.Sprintf("no gui"))
-			LOG_DEBUG(fmt.Sprintf("gui check: %s", strings.TrimSuffix(string(cmdout), "\n")))
-			return false
+		if isCurrent {
+			LOG_TRACE(fmt.Sprintf("Call CWmNewStatusNotify %s %s typing timeout", chatId, userId))
+			CWmNewStatusNotify(connId, chatId, userId, BoolToInt(true), TypingNone, -1)
 		}
+	})
+	typings[connId][key] = timer
+	mx.Unlock()
+}
 
-	default:
-		LOG_INFO(fmt.Sprintf("no gui"))
-		LOG_DEBUG(fmt.Sprintf("gui check: [other \"%s\" default false]", runtime.GOOS))
-		return false
+func StopTypingTimeout(connId int, chatId string, userId string) {
+	key := chatId + "/" + userId
+	mx.Lock()
+	if timer, ok := typings[connId][key]; ok {
+		timer.Stop()
+		delete(typings[connId], key)
 	}
+	mx.Unlock()
 }
 
-func BoolToInt(b bool) int {
-	if b {
-		return 1
+// presence subscriptions are sent in batches, spaced by delay
+var presenceBatchSize = 20
+var presenceBatchDelay = 500 * time.Millisecond
+var presenceRetryDelay = 30 * time.Second
+
+func QueuePresenceSubscriptions(connId int, userIds []string) {
+	mx.Lock()
+	presence := presences[connId]
+	for _, userId := range userIds {
+		if !presence.subscribed[userId] && !presence.queued[userId] {
+			presence.queued[userId] = true
+			presence.pending = append(presence.pending, userId)
+		}
 	}
-	return 0
-}
 
-func IntToBool(i int) bool {
-	return i != 0
+	if (len(presence.pending) > 0) && !presence.isFlushing {
+		presence.isFlushing = true
+		time.AfterFunc(presenceBatchDelay, func() { FlushPresenceSubscriptions(connId) })
+	}
+	mx.Unlock()
 }
 
-func StringToInt(s string) int {
-	i, err := strconv.Atoi(s)
-	if err != nil {
-		return 0
+func RequeuePresenceSubscriptions(connId int) {
+	mx.Lock()
+	presence := presences[connId]
+	for userId := range presence.subscribed {
+		presence.queued[userId] = true
 	}
-	return i
-}
 
-func JidToStr(jid types.JID) string {
-	return jid.User + "@" + jid.Server
+	presence.subscribed = make(map[string]bool)
+	presence.pending = presence.pending[:0]
+	for userId := range presence.queued {
+		presence.pending = append(presence.pending, userId)
+	}
+
+	sort.Strings(presence.pending)
+	if (len(presence.pending) > 0) && !presence.isFlushing {
+		presence.isFlushing = true
+		time.AfterFunc(presenceBatchDelay, func() { FlushPresenceSubscriptions(connId) })
+	}
+	mx.Unlock()
 }
 
-func GetChatId(chatJid types.JID, senderJid types.JID) string {
-	if chatJid.Server == "broadcast" {
-		if chatJid.User == "status" {
-			return JidToStr(chatJid) // status updates
-		} else {
-			return JidToStr(senderJid) // broadcast messages
+func RetryPresenceSubscriptions(connId int, userIds []string) {
+	mx.Lock()
+	presence, ok := presences[connId]
+	if !ok {
+		mx.Unlock()
+		return
+	}
+
+	for _, userId := range userIds {
+		if presence.queued[userId] && !slices.Contains(presence.pending, userId) {
+			presence.pending = append(presence.pending, userId)
 		}
-	} else {
-		return JidToStr(chatJid) // regular messages
 	}
-}
 
-func IsRead(isSyncRead bool, isSelfChat bool, fromMe bool, timeSent time.Time, timeRead time.Time) bool {
-	// consider message read:
-	// - during initial sync for chats with no unread messages
-	// - in self chat / saved messages
-	// - from others and timeSent <= timeRead i.e.. !timeSent.After(timeRead)
-	return isSyncRead || isSelfChat || (!fromMe && !timeSent.After(timeRead))
+	if (len(presence.pending) > 0) && !presence.isFlushing {
+		presence.isFlushing = true
+		time.AfterFunc(presenceBatchDelay, func() { FlushPresenceSubscriptions(connId) })
+	}
+	mx.Unlock()
 }
 
-func ParseWebMessageInfo(selfJid types.JID, chatJid types.JID, webMsg *waWeb.WebMessageInfo) *types.MessageInfo {
-	info := types.MessageInfo{
-		MessageSource: types.MessageSource{
-			Chat:     chatJid,
-			IsFromMe: webMsg.GetKey().GetFromMe(),
-			IsGroup:  chatJid.Server == types.GroupServer,
-		},
-		ID:        webMsg.GetKey().GetId(),
-		PushName:  webMsg.GetPushName(),
-		Timestamp: time.Unix(int64(webMsg.GetMessageTimestamp()), 0),
+func FlushPresenceSubscriptions(connId int) {
+	// take one batch, and schedule next if more pending
+	mx.Lock()
+	presence, ok := presences[connId]
+	if !ok {
+		mx.Unlock()
+		return
 	}
-	if info.IsFromMe {
-		info.Sender = selfJid.ToNonAD()
-	} else if webMsg.GetParticipant() != "" {
-		info.Sender, _ = types.ParseJID(webMsg.GetParticipant())
-	} else if webMsg.GetKey().GetParticipant() != "" {
-		info.Sender, _ = types.ParseJID(webMsg.GetKey().GetParticipant())
+
+	count := min(len(presence.pending), presenceBatchSize)
+	batch := append([]string{}, presence.pending[:count]...)
+	presence.pending = presence.pending[count:]
+	if len(presence.pending) > 0 {
+		time.AfterFunc(presenceBatchDelay, func() { FlushPresenceSubscriptions(connId) })
 	} else {
-		info.Sender = chatJid
+		presence.isFlushing = false
 	}
-	if info.Sender.IsEmpty() {
-		return nil
+	var client *whatsmeow.Client = clients[connId]
+	mx.Unlock()
+
+	// kept as queued, re-sent upon reconnect
+	if (client == nil) || !client.IsConnected() {
+		LOG_TRACE(fmt.Sprintf("subscribe presence postponed, not connected"))
+		return
 	}
-	return &info
-}
 
-// logger
-type ncLogger struct{}
+	LOG_TRACE(fmt.Sprintf("subscribe presence batch %d", len(batch)))
+	var subscribed []string
+	var failed []string
+	for _, userId := range batch {
+		userJid, _ := types.ParseJID(userId)
+		err := client.SubscribePresence(userJid)
+		if err != nil {
+			LOG_WARNING(fmt.Sprintf("subscribe presence error %#v", err))
+			failed = append(failed, userId)
+		} else {
+			subscribed = append(subscribed, userId)
+		}
+	}
 
-func (s *ncLogger) Debugf(msg string, args ...interface{}) {
-	LOG_DEBUG(fmt.Sprintf("whatsmeow %s", fmt.Sprintf(msg, args...)))
-}
+	mx.Lock()
+	for _, userId := range subscribed {
+		delete(presence.queued, userId)
+		presence.subscribed[userId] = true
+	}
+	mx.Unlock()
 
-func (s *ncLogger) Infof(msg string, args ...interface{}) {
-	LOG_INFO(fmt.Sprintf("whatsmeow %s", fmt.Sprintf(msg, args...)))
+	// failed remain queued, retried after a delay
+	if len(failed) > 0 {
+		time.AfterFunc(presenceRetryDelay, func() { RetryPresenceSubscriptions(connId, failed) })
+	}
 }
 
-func (s *ncLogger) Warnf(msg string, args ...interface{}) {
-	LOG_WARNING(fmt.Sprintf("whatsmeow %s", fmt.Sprintf(msg, args...)))
+func SetLastSeen(connId int, userId string, isOnline bool, timeSeen time.Time) {
+	mx.Lock()
+	lastSeen := presences[connId].lastSeen[userId]
+	lastSeen.IsOnline = isOnline
+	if !timeSeen.IsZero() {
+		lastSeen.TimeSeen = timeSeen
+	}
+	presences[connId].lastSeen[userId] = lastSeen
+	mx.Unlock()
 }
 
-func (s *ncLogger) Errorf(msg string, args ...interface{}) {
-	LOG_ERROR(fmt.Sprintf("whatsmeow %s", fmt.Sprintf(msg, args...)))
+func GetLastSeen(connId int, userId string) (LastSeen, bool) {
+	mx.Lock()
+	lastSeen, ok := presences[connId].lastSeen[userId]
+	mx.Unlock()
+	return lastSeen, ok
 }
 
-func (s *ncLogger) Sub(mod string) waLog.Logger {
-	return s
+func GetTimeRead(connId int, chatId string) time.Time {
+	var timeRead time.Time
+	var ok bool
+	mx.Lock()
+	timeRead, ok = timeReads[connId][chatId]
+	mx.Unlock()
+	if !ok {
+		timeRead = time.Time{}
+	}
+	return timeRead
 }
 
-func NcLogger() waLog.Logger {
-	return &ncLogger{}
+func SetTimeRead(connId int, chatId string, timeRead time.Time) {
+	mx.Lock()
+	timeReads[connId][chatId] = timeRead
+	mx.Unlock()
 }
 
-// loggable
-type ncSignalLogger struct{}
+// download info
+var downloadInfoVersion = 4    // bump version upon any struct change
+var downloadInfoMinVersion = 1 // oldest version still supported for download
+type DownloadInfo struct {
+	Version    int    `json:"Version_int"`
+	Url        string `json:"Url_string"`
+	DirectPath string `json:"DirectPath_string"`
 
-func (s *ncSignalLogger) Debug(caller, msg string) {
-	LOG_DEBUG(fmt.Sprintf("whatsmeow %s", fmt.Sprintf("%s %s", caller, msg)))
-}
+	TargetPath string              `json:"TargetPath_string"`
+	MediaKey   []byte              `json:"MediaKey_arraybyte"`
+	MediaType  whatsmeow.MediaType `json:"MediaType_MediaType"`
+	Size       int                 `json:"Size_int"`
 
-func (s *ncSignalLogger) Info(caller, msg string) {
-	LOG_INFO(fmt.Sprintf("whatsmeow %s", fmt.Sprintf("%s %s", caller, msg)))
-}
+	FileEncSha256 []byte `json:"FileEncSha256_arraybyte"`
+	FileSha256    []byte `json:"FileSha256_arraybyte"`
 
-func (s *ncSignalLogger) Warning(caller, msg string) {
-	LOG_WARNING(fmt.Sprintf("whatsmeow %s", fmt.Sprintf("%s %s", caller, msg)))
+	// message info, needed for media retry (version 2+)
+	MsgId     string `json:"MsgId_string"`
+	ChatJid   string `json:"ChatJid_string"`
+	SenderJid string `json:"SenderJid_string"`
+	FromMe    bool   `json:"FromMe_bool"`
+	IsGroup   bool   `json:"IsGroup_bool"`
+
+	// audio info (version 3+)
+	IsVoiceNote bool   `json:"IsVoiceNote_bool"`
+	Seconds     uint32 `json:"Seconds_uint32"`
+
+	// media info, needed for forwarding (version 4+)
+	Width    uint32 `json:"Width_uint32"`
+	Height   uint32 `json:"Height_uint32"`
+	FileName string `json:"FileName_string"`
 }
 
-func (s *ncSignalLogger) Error(caller, msg string) {
-	LOG_ERROR(fmt.Sprintf("whatsmeow %s", fmt.Sprintf("%s %s", caller, msg)))
-}
+// time to wait for phone to re-upload expired media
+var mediaRetryTimeout = 30 * time.Second
 
-func (s *ncSignalLogger) Configure(ss string) {
-}
+func DownloadableMessageToFileId(client *whatsmeow.Client, msg whatsmeow.DownloadableMessage, messageInfo types.MessageInfo, targetPath string) string {
+	var info DownloadInfo
+	info.Version = downloadInfoVersion
 
-// event handling
-type WmEventHandler struct {
-	connId int
-}
+	info.TargetPath = targetPath
+	info.MediaKey = msg.GetMediaKey()
+	info.Size = whatsmeow.GetDownloadSize(msg)
+	info.FileEncSha256 = msg.GetFileEncSHA256()
+	info.FileSha256 = msg.GetFileSHA256()
 
-func (handler *WmEventHandler) HandleEvent(rawEvt interface{}) {
-	switch evt := rawEvt.(type) {
+	info.MediaType = whatsmeow.GetMediaType(msg)
+	if len(info.MediaType) == 0 {
+		LOG_WARNING(fmt.Sprintf("unknown mediatype '%s'", string(msg.ProtoReflect().Descriptor().Name())))
+		return ""
+	}
 
-	case *events.AppStateSyncComplete:
-		// this happens after initial logon via QR code
-		LOG_TRACE(fmt.Sprintf("%#v", evt))
-		if evt.Name == appstate.WAPatchCriticalBlock {
-			LOG_TRACE("AppStateSyncComplete WAPatchCriticalBlock")
-			handler.HandleConnected()
-		} else if evt.Name == appstate.WAPatchRegular {
-			LOG_TRACE("AppStateSyncComplete WAPatchRegular")
-			handler.GetContacts()
-		}
+	urlable, ok := msg.(whatsmeow.DownloadableMessageWithURL)
+	if ok && len(urlable.GetUrl()) > 0 {
+		info.Url = urlable.GetUrl()
+	} else if len(msg.GetDirectPath()) > 0 {
+		info.DirectPath = msg.GetDirectPath()
+	} else {
+		LOG_WARNING(fmt.Sprintf("url and path not present"))
+		return ""
+	}
 
-	case *events.PushNameSetting:
-		// send presence when the pushname is changed remotely
-		LOG_TRACE(fmt.Sprintf("%#v", evt))
-		handler.HandleConnected()
+	switch media := msg.(type) {
+	case *waE2E.AudioMessage:
+		info.IsVoiceNote = media.GetPTT()
+		info.Seconds = media.GetSeconds()
+	case *waE2E.ImageMessage:
+		info.Width = media.GetWidth()
+		info.Height = media.GetHeight()
+	case *waE2E.VideoMessage:
+		info.Width = media.GetWidth()
+		info.Height = media.GetHeight()
+		info.Seconds = media.GetSeconds()
+	case *waE2E.DocumentMessage:
+		info.FileName = media.GetFileName()
+	}
 
-	case *events.PushName:
-		// other device changed our friendly name
-		LOG_TRACE(fmt.Sprintf("%#v", evt))
+	info.MsgId = messageInfo.ID
+	info.ChatJid = messageInfo.Chat.String()
+	info.SenderJid = messageInfo.Sender.String()
+	info.FromMe = messageInfo.IsFromMe
+	info.IsGroup = messageInfo.IsGroup
 
-	case *events.Connected:
-		// connected
-		LOG_TRACE(fmt.Sprintf("%#v", evt))
-		handler.HandleConnected()
-		SetState(handler.connId, Connected)
-		CWmSetStatus(FlagOnline)
-		CWmClearStatus(FlagConnecting)
+	return DownloadInfoToFileId(info)
+}
 
-	case *events.Disconnected:
-		// disconnected
-		LOG_TRACE(fmt.Sprintf("%#v", evt))
-		CWmClearStatus(FlagOnline)
+// returns whether a file id refers to a voice note, and its duration in seconds (-1 if unknown)
+func GetFileIdAudioInfo(fileId string) (bool, int) {
+	var info DownloadInfo
+	if (len(fileId) == 0) || (json.Unmarshal([]byte(fileId), &info) != nil) || (info.Seconds == 0) {
+		return info.IsVoiceNote, -1
+	}
 
-	case *events.StreamReplaced:
-		// TODO: find out when exactly this happens and how to handle it
-		LOG_TRACE(fmt.Sprintf("%#v", evt))
+	return info.IsVoiceNote, int(info.Seconds)
+}
 
-	case *events.Message:
-		LOG_TRACE(fmt.Sprintf("%#v", evt))
-		handler.HandleMessage(evt.Info, evt.Message, false /*isSyncRead*/)
+func DownloadInfoToFileId(info DownloadInfo) string {
+	LOG_TRACE(fmt.Sprintf("fileInfo %#v", info))
+	bytes, err := json.Marshal(info)
+	if err != nil {
+		LOG_WARNING(fmt.Sprintf("json encode failed"))
+		return ""
+	}
 
-	case *events.Receipt:
-		LOG_TRACE(fmt.Sprintf("%#v", evt))
-		handler.HandleReceipt(evt)
+	str := string(bytes)
+	LOG_TRACE(fmt.Sprintf("fileId %s", str))
 
-	case *events.Presence:
-		LOG_TRACE(fmt.Sprintf("%#v", evt))
-		handler.HandlePresence(evt)
+	return str
+}
 
-	case *events.ChatPresence:
-		LOG_TRACE(fmt.Sprintf("%#v", evt))
-		handler.HandleChatPresence(evt)
+func DownloadFromFileId(connId int, chatId string, msgId string, senderId string, fromMe bool, fileId string) (string, int, string) {
+	LOG_TRACE(fmt.Sprintf("fileId %s", fileId))
+	var info DownloadInfo
+	json.Unmarshal([]byte(fileId), &info)
+	if (info.Version < downloadInfoMinVersion) || (info.Version > downloadInfoVersion) {
+		LOG_WARNING(fmt.Sprintf("unsupported version %d", info.Version))
+		return "", FileStatusDownloadFailed, fileId
+	}
 
-	case *events.HistorySync:
-		// This happens after initial logon via QR code (after AppStateSyncComplete)
-		LOG_TRACE(fmt.Sprintf("%#v", evt))
-		handler.HandleHistorySync(evt)
+	client := GetClient(connId)
 
-	case *events.AppState:
-		LOG_TRACE(fmt.Sprintf("%#v - %#v / %#v", evt, evt.Index, evt.SyncActionValue))
+	// file ids stored before message info was included rely on caller provided info for media retry
+	if len(info.MsgId) == 0 {
+		info = SetDownloadInfoMessage(client, info, chatId, msgId, senderId, fromMe)
+		fileId = DownloadInfoToFileId(info)
+	}
 
-	case *events.LoggedOut:
-		LOG_TRACE(fmt.Sprintf("%#v", evt))
-		handler.HandleLoggedOut()
+	LOG_TRACE(fmt.Sprintf("fileInfo %#v", info))
 
-	case *events.QR:
-		// handled in WmLogin
-		LOG_TRACE(fmt.Sprintf("%#v", evt))
+	targetPath := info.TargetPath
+	filePath := ""
+	fileStatus := FileStatusNone
 
-	case *events.PairSuccess:
-		LOG_TRACE(fmt.Sprintf("%#v", evt))
+	// download if not yet present
+	if _, statErr := os.Stat(targetPath); os.IsNotExist(statErr) {
+		LOG_TRACE(fmt.Sprintf("download new %#v", targetPath))
+		CWmSetStatus(FlagFetching)
 
-	case *events.JoinedGroup:
-		LOG_TRACE(fmt.Sprintf("%#v", evt))
+		err := DownloadFromFileInfo(connId, chatId, msgId, info)
+		if errors.Is(err, whatsmeow.ErrMediaDownloadFailedWith404) || errors.Is(err, whatsmeow.ErrMediaDownloadFailedWith410) {
+			// media expired on server, request phone to re-upload it
+			LOG_DEBUG(fmt.Sprintf("download expired %#v, request media retry", err))
+			retryInfo, retryErr := RequestMediaRetry(connId, info)
+			if retryErr != nil {
+				LOG_WARNING(fmt.Sprintf("media retry error %#v", retryErr))
+			} else {
+				info = retryInfo
+				fileId = DownloadInfoToFileId(info)
+				err = DownloadFromFileInfo(connId, chatId, msgId, info)
+			}
+		}
 
-	case *events.OfflineSyncCompleted:
-		LOG_TRACE(fmt.Sprintf("%#v", evt))
-		handler.GetContacts()
+		if err != nil {
+			if IsDownloadInterrupted(client, err) {
+				LOG_DEBUG(fmt.Sprintf("download interrupted %#v", err))
+				fileStatus = FileStatusDownloading
+			} else {
+				LOG_WARNING(fmt.Sprintf("download error %#v", err))
+				fileStatus = FileStatusDownloadFailed
+			}
+		} else {
+			LOG_TRACE(fmt.Sprintf("download ok"))
+			filePath = targetPath
+			fileStatus = FileStatusDownloaded
+		}
+		CWmClearStatus(FlagFetching)
+	} else {
+		LOG_TRACE(fmt.Sprintf("download cached %#v", targetPath))
+		filePath = targetPath
+		fileStatus = FileStatusDownloaded
+	}
 
-	case *events.GroupInfo:
-		LOG_TRACE(fmt.Sprintf("%#v", evt))
-		handler.HandleGroupInfo(evt)
+	return filePath, fileStatus, fileId
+}
 
-	case *events.DeleteChat:
-		LOG_TRACE(fmt.Sprintf("%#v", evt))
-		handler.HandleDeleteChat(evt)
+func SetDownloadInfoMessage(client *whatsmeow.Client, info DownloadInfo, chatId string, msgId string, senderId string, fromMe bool) DownloadInfo {
+	chatJid, _ := types.ParseJID(chatId)
+	info.MsgId = msgId
+	info.ChatJid = chatId
+	info.FromMe = fromMe
+	info.IsGroup = (chatJid.Server == types.GroupServer)
+	if fromMe && (client.Store.ID != nil) {
+		info.SenderJid = JidToStr(client.Store.ID.ToNonAD())
+	} else if len(senderId) > 0 {
+		info.SenderJid = senderId
+	} else if !info.IsGroup {
+		info.SenderJid = chatId
+	}
 
-	case *events.Mute:
-		LOG_TRACE(fmt.Sprintf("%#v", evt))
-		handler.HandleMute(evt)
+	return info
+}
 
-	case *events.Pin:
-		LOG_TRACE(fmt.Sprintf("%#v", evt))
-		handler.HandlePin(evt)
+// a lost connection or network error defers a download until reconnect (resuming
+// any partial data), while server and integrity errors are reported as failed
+func IsDownloadInterrupted(client *whatsmeow.Client, err error) bool {
+	if !client.IsConnected() {
+		return true
+	}
 
-	case *events.ClientOutdated:
-		LOG_TRACE(fmt.Sprintf("%#v", evt))
-		handler.HandleClientOutdated()
+	var httpErr whatsmeow.DownloadHTTPError
+	if errors.As(err, &httpErr) {
+		return false
+	}
 
-	default:
-		LOG_TRACE(fmt.Sprintf("Event type not handled: %#v", rawEvt))
+	if errors.Is(err, whatsmeow.ErrFileLengthMismatch) || errors.Is(err, whatsmeow.ErrInvalidMediaSHA256) ||
+		errors.Is(err, whatsmeow.ErrInvalidMediaEncSHA256) || errors.Is(err, whatsmeow.ErrInvalidMediaHMAC) {
+		return false
 	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, context.DeadlineExceeded)
 }
 
-func (handler *WmEventHandler) HandleConnected() {
-	LOG_TRACE(fmt.Sprintf("HandleConnected"))
-	var client *whatsmeow.Client = GetClient(handler.connId)
+func DownloadFromFileInfo(connId int, chatId string, msgId string, info DownloadInfo) error {
+	client := GetClient(connId)
 
-	if len(client.Store.PushName) == 0 {
-		return
+	// encrypted data is kept across attempts to allow resume, decrypted data is renamed once verified
+	encPath := info.TargetPath + ".enc.part"
+	tmpPath := info.TargetPath + ".part"
+
+	encFile, err := os.OpenFile(encPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
 	}
-}
+	defer encFile.Close()
 
-func (handler *WmEventHandler) HandleReceipt(receipt *events.Receipt) {
-	if receipt.Type == events.ReceiptTypeRead || receipt.Type == events.ReceiptTypeReadSelf {
-		LOG_TRACE(fmt.Sprintf("%#v was read by %s at %s", receipt.MessageIDs, receipt.SourceString(), receipt.Timestamp))
-		connId := handler.connId
-		chatId := receipt.MessageSource.Chat.ToNonAD().String()
-		isRead := true
-		for _, msgId := range receipt.MessageIDs {
-			LOG_TRACE(fmt.Sprintf("Call CWmNewMessageStatusNotify"))
-			CWmNewMessageStatusNotify(connId, chatId, msgId, BoolToInt(isRead))
-		}
+	tmpFile, err := os.Create(tmpPath)
+	if err != nil {
+		return err
 	}
-}
 
-func (handler *WmEventHandler) HandlePresence(presence *events.Presence) {
-	if presence.From.Server != types.GroupServer {
-		connId := handler.connId
-		chatId := ""
-		userId := presence.From.ToNonAD().String()
-		isOnline := !presence.Unavailable
-		timeSeen := int(presence.LastSeen.Unix())
-		isTyping := false
-		LOG_TRACE(fmt.Sprintf("Call CWmNewStatusNotify"))
-		CWmNewStatusNotify(connId, chatId, userId, BoolToInt(isOnline), BoolToInt(isTyping), timeSeen)
+	progress := DownloadProgressNotifier(connId, chatId, msgId)
+	if len(info.Url) > 0 {
+		LOG_TRACE(fmt.Sprintf("download url: %s", info.Url))
+		err = client.DownloadMediaWithUrlToFile(info.Url, info.MediaKey, info.MediaType, info.Size, info.FileEncSha256, info.FileSha256, encFile, tmpFile, progress)
+	} else if len(info.DirectPath) > 0 {
+		LOG_TRACE(fmt.Sprintf("download directpath: %s", info.DirectPath))
+		err = client.DownloadMediaWithPathToFile(info.DirectPath, info.FileEncSha256, info.FileSha256, info.MediaKey, info.Size, info.MediaType, whatsmeow.GetMMSType(info.MediaType), encFile, tmpFile, progress)
+	} else {
+		LOG_WARNING(fmt.Sprintf("url and path not present"))
+		err = whatsmeow.ErrNoURLPresent
 	}
-}
 
-func (handler *WmEventHandler) HandleChatPresence(chatPresence *events.ChatPresence) {
-	connId := handler.connId
-	chatId := chatPresence.MessageSource.Chat.ToNonAD().String()
-	userId := chatPresence.MessageSource.Sender.ToNonAD().String()
-	isOnline := true
-	isTyping := (chatPresence.State == types.ChatPresenceComposing)
-	LOG_TRACE(fmt.Sprintf("Call CWmNewStatusNotify"))
-	CWmNewStatusNotify(connId, chatId, userId, BoolToInt(isOnline), BoolToInt(isTyping), -1)
+	closeErr := tmpFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(tmpPath)
+
+		// discard encrypted data unless download can be resumed or retried
+		var httpErr whatsmeow.DownloadHTTPError
+		if !IsDownloadInterrupted(client, err) && !whatsmeow.ShouldRetryMediaDownload(err) && !errors.As(err, &httpErr) {
+			os.Remove(encPath)
+		}
+
+		return err
+	}
+
+	os.Remove(encPath)
+	return os.Rename(tmpPath, info.TargetPath)
 }
 
-func (handler *WmEventHandler) HandleHistorySync(historySync *events.HistorySync) {
-	var client *whatsmeow.Client = GetClient(handler.connId)
-	selfJid := *client.Store.ID
+func DownloadProgressNotifier(connId int, chatId string, msgId string) whatsmeow.DownloadProgressFunc {
+	lastPercent := -1
+	return func(downloaded int64, total int64) {
+		if total <= 0 {
+			return
+		}
 
-	LOG_TRACE(fmt.Sprintf("HandleHistorySync SyncType %s Progress %d",
-		(*historySync.Data.SyncType).String(), historySync.Data.GetProgress()))
+		percent := int(downloaded * 100 / total)
+		if percent == lastPercent {
+			return
+		}
 
-	if historySync.Data.GetProgress() < 98 {
-		LOG_TRACE("Set Syncing")
-		CWmSetStatus(FlagSyncing)
+		lastPercent = percent
+		LOG_TRACE(fmt.Sprintf("Call CWmNewMessageFileProgressNotify %s %d", msgId, percent))
+		CWmNewMessageFileProgressNotify(connId, chatId, msgId, percent)
 	}
+}
 
-	conversations := historySync.Data.GetConversations()
-	for _, conversation := range conversations {
-		LOG_TRACE(fmt.Sprintf("HandleHistorySync Conversation %#v", *conversation))
+func RequestMediaRetry(connId int, info DownloadInfo) (DownloadInfo, error) {
+	client := GetClient(connId)
 
-		chatJid, _ := types.ParseJID(conversation.GetId())
+	if len(info.MsgId) == 0 {
+		return info, errors.New("message info not present")
+	}
 
-		isUnread := 0
-		lastMessageTime := 0
+	chatJid, chatErr := types.ParseJID(info.ChatJid)
+	if chatErr != nil {
+		return info, chatErr
+	}
 
-		isSyncRead := (conversation.GetUnreadCount() == 0)
-		hasMessages := false
-		syncMessages := conversation.GetMessages()
-		for _, syncMessage := range syncMessages {
-			webMessageInfo := syncMessage.Message
-			messageInfo := ParseWebMessageInfo(selfJid, chatJid, webMessageInfo)
-			message := webMessageInfo.GetMessage()
+	senderJid, senderErr := types.ParseJID(info.SenderJid)
+	if senderErr != nil {
+		return info, senderErr
+	}
 
-			if (messageInfo == nil) || (message == nil) {
-				continue
-			}
+	messageInfo := types.MessageInfo{
+		MessageSource: types.MessageSource{
+			Chat:     chatJid,
+			Sender:   senderJid,
+			IsFromMe: info.FromMe,
+			IsGroup:  info.IsGroup,
+		},
+		ID: info.MsgId,
+	}
 
-			handler.HandleMessage(*messageInfo, message, isSyncRead)
-			hasMessages = true
+	retryChan := AddMediaRetry(connId, info.ChatJid, info.MsgId)
+	defer RemoveMediaRetry(connId, info.ChatJid, info.MsgId)
 
-			messageTime := int(messageInfo.Timestamp.Unix())
-			if messageTime > lastMessageTime {
-				lastMessageTime = messageTime
-			}
+	err := client.SendMediaRetryReceipt(&messageInfo, info.MediaKey)
+	if err != nil {
+		return info, err
+	}
+
+	select {
+	case evt := <-retryChan:
+		notif, err := whatsmeow.DecryptMediaRetryNotification(evt, info.MediaKey)
+		if err != nil {
+			return info, err
 		}
 
-		if hasMessages {
-			isMuted := false
-			isPinned := false
-			settings, setErr := client.Store.ChatSettings.GetChatSettings(chatJid)
-			if setErr != nil {
-				LOG_WARNING(fmt.Sprintf("Get chat settings failed %#v", setErr))
-			} else {
-				if settings.Found {
-					mutedUntil := settings.MutedUntil.Unix()
-					isMuted = (mutedUntil == -1) || (mutedUntil > time.Now().Unix())
-					isPinned = settings.Pinned
-				} else {
-					LOG_DEBUG(fmt.Sprintf("Chat settings not found %s", JidToStr(chatJid)))
-				}
-			}
+		if notif.GetResult() != waMmsRetry.MediaRetryNotification_SUCCESS {
+			return info, fmt.Errorf("media retry result %s", notif.GetResult().String())
+		}
 
-			LOG_TRACE(fmt.Sprintf("Call CWmNewChatsNotify %s %d %t %t", JidToStr(chatJid), len(syncMessages), isMuted, isPinned))
-			CWmNewChatsNotify(handler.connId, JidToStr(chatJid), isUnread, BoolToInt(isMuted), BoolToInt(isPinned), lastMessageTime)
-		} else {
-			LOG_TRACE(fmt.Sprintf("Skip CWmNewChatsNotify %s %d", JidToStr(chatJid), len(syncMessages)))
+		if len(notif.GetDirectPath()) == 0 {
+			return info, errors.New("media retry path not present")
 		}
 
-	}
+		LOG_DEBUG(fmt.Sprintf("media retry ok %s", notif.GetDirectPath()))
+		info.Url = ""
+		info.DirectPath = notif.GetDirectPath()
+		return info, nil
 
-	if historySync.Data.GetProgress() == 100 {
-		LOG_TRACE("Clear Syncing")
-		CWmClearStatus(FlagSyncing)
+	case <-time.After(mediaRetryTimeout):
+		return info, errors.New("media retry timeout")
 	}
 }
 
-func (handler *WmEventHandler) HandleGroupInfo(groupInfo *events.GroupInfo) {
-	connId := handler.connId
-	client := GetClient(connId)
-	chatId := JidToStr(groupInfo.JID)
+// media thumbnails
+func ThumbnailPath(connId int, msgId string, ext string) string {
+	var tmpPath string = GetPath(connId) + "/tmp"
+	return fmt.Sprintf("%s/%s-thumb.%s", tmpPath, msgId, ext)
+}
 
-	selfJid := *client.Store.ID
-	senderJidStr := ""
-	if (groupInfo.Sender != nil) && (JidToStr(*groupInfo.Sender) != JidToStr(groupInfo.JID)) {
-		senderJidStr = JidToStr(*groupInfo.Sender)
+func SaveThumbnail(connId int, msgId string, ext string, data []byte) string {
+	if len(data) == 0 {
+		return ""
 	}
 
-	// text
-	text := ""
-	if groupInfo.Name != nil {
-		// Group name change
-		if senderJidStr == "" {
-			senderJidStr = JidToStr(groupInfo.JID)
+	thumbPath := ThumbnailPath(connId, msgId, ext)
+	if _, statErr := os.Stat(thumbPath); os.IsNotExist(statErr) {
+		err := os.WriteFile(thumbPath, data, 0644)
+		if err != nil {
+			LOG_WARNING(fmt.Sprintf("write thumbnail error %#v", err))
+			return ""
 		}
+	}
 
-		groupName := *groupInfo.Name
-		text = "[Changed group name to " + groupName.Name + "]"
-	} else if len(groupInfo.Join) > 0 {
-		// Group member joined
-		if (len(groupInfo.Join) == 1) && ((senderJidStr == "") || (senderJidStr == JidToStr(groupInfo.Join[0]))) {
-			senderJidStr = JidToStr(groupInfo.Join[0])
-			text = "[Joined]"
-		} else {
-			if senderJidStr == "" {
-				senderJidStr = JidToStr(groupInfo.JID)
-			}
+	return thumbPath
+}
 
-			joined := ""
-			for _, jid := range groupInfo.Join {
-				if joined != "" {
-					joined += ", "
-				}
+func GetCachedThumbnail(connId int, msgId string) string {
+	matches, _ := filepath.Glob(ThumbnailPath(connId, msgId, "*"))
+	if len(matches) > 0 {
+		return matches[0]
+	}
 
-				joined += GetContactName(connId, JidToStr(jid))
-			}
-
-			text = "[Added " + joined + "]"
-		}
-	} else if len(groupInfo.Leave) > 0 {
-		// Group member left
-		if (len(groupInfo.Leave) == 1) && ((senderJidStr == "") || (senderJidStr == JidToStr(groupInfo.Leave[0]))) {
-			senderJidStr = JidToStr(groupInfo.Leave[0])
-			text = "[Left]"
-		} else {
-			if senderJidStr == "" {
-				senderJidStr = JidToStr(groupInfo.JID)
-			}
+	return ""
+}
 
-			left := ""
-			for _, jid := range groupInfo.Leave {
-				if left != "" {
-					left += ", "
-				}
+type DownloadableMediaThumbnail interface {
+	whatsmeow.DownloadableThumbnail
+	GetJPEGThumbnail() []byte
+}
 
-				left += GetContactName(connId, JidToStr(jid))
-			}
+// returns embedded or previously fetched thumbnail, without network access
+func GetMessageThumbnail(connId int, msgId string, msg DownloadableMediaThumbnail) string {
+	if len(msg.GetJPEGThumbnail()) > 0 {
+		return SaveThumbnail(connId, msgId, "jpg", msg.GetJPEGThumbnail())
+	}
 
-			text = "[Removed " + left + "]"
-		}
+	thumbPath := ThumbnailPath(connId, msgId, "jpg")
+	if _, statErr := os.Stat(thumbPath); statErr == nil {
+		return thumbPath
 	}
 
-	if text == "" {
-		LOG_TRACE(fmt.Sprintf("HandleGroupInfo ignore"))
+	return ""
+}
+
+// fetches a remote thumbnail in the background and updates the message file info once available,
+// skipped during history sync to avoid a request per synced message
+func FetchMessageThumbnail(connId int, chatId string, msgId string, fileId string, filePath string, msg DownloadableMediaThumbnail, mediaType whatsmeow.MediaType, isHistorySync bool) {
+	if isHistorySync || (len(msg.GetThumbnailDirectPath()) == 0) {
 		return
-	} else {
-		LOG_TRACE(fmt.Sprintf("HandleGroupInfo notify"))
 	}
 
-	// context
-	quotedId := ""
-
-	// file id, path and status
-	fileId := ""
-	filePath := ""
-	fileStatus := FileStatusNone
+	go func() {
+		// download thumbnail, encrypted with the media key of the message
+		client := GetClient(connId)
+		mmsType := "thumbnail-" + whatsmeow.GetMMSType(mediaType)
+		data, err := client.DownloadMediaWithPath(msg.GetThumbnailDirectPath(), msg.GetThumbnailEncSHA256(), msg.GetThumbnailSHA256(), msg.GetMediaKey(), -1, mediaType, mmsType)
+		if err != nil {
+			LOG_WARNING(fmt.Sprintf("download thumbnail error %#v", err))
+			return
+		}
 
-	// general
-	timeSent := int(groupInfo.Timestamp.Unix())
-	msgId := strconv.Itoa(timeSent) // group info updates do not have msg id
-	fromMe := (senderJidStr == JidToStr(selfJid))
-	senderId := senderJidStr
-	selfId := JidToStr(*client.Store.ID)
-	isSelfChat := (chatId == selfId)
-	isSyncRead := false
-	isRead := IsRead(isSyncRead, isSelfChat, fromMe, groupInfo.Timestamp, GetTimeRead(connId, chatId))
+		thumbPath := SaveThumbnail(connId, msgId, "jpg", data)
+		if len(thumbPath) == 0 {
+			return
+		}
 
-	// reset typing if needed
-	UpdateTypingStatus(connId, chatId, senderId, fromMe, isSyncRead)
+		// file may have been downloaded meanwhile
+		fileStatus := FileStatusNotDownloaded
+		if _, statErr := os.Stat(filePath); statErr == nil {
+			fileStatus = FileStatusDownloaded
+		}
 
-	LOG_TRACE(fmt.Sprintf("Call CWmNewMessagesNotify %s: %s", chatId, text))
-	CWmNewMessagesNotify(connId, chatId, msgId, senderId, text, BoolToInt(fromMe), quotedId, fileId, filePath, fileStatus, timeSent, BoolToInt(isRead))
+		LOG_TRACE(fmt.Sprintf("Call CWmNewMessageFileNotify %s thumbnail", msgId))
+		CWmNewMessageFileNotify(connId, chatId, msgId, fileId, filePath, thumbPath, fileStatus, DownloadFileActionNone)
+	}()
 }
 
-func (handler *WmEventHandler) HandleDeleteChat(deleteChat *events.DeleteChat) {
-	connId := handler.connId
-	chatId := deleteChat.JID.ToNonAD().String()
+// upload size limits per media type
+var uploadSizeLimits = map[whatsmeow.MediaType]int64{
+	whatsmeow.MediaImage:    16 * 1024 * 1024,
+	whatsmeow.MediaVideo:    16 * 1024 * 1024,
+	whatsmeow.MediaAudio:    16 * 1024 * 1024,
+	whatsmeow.MediaDocument: 2 * 1024 * 1024 * 1024,
+}
 
-	LOG_TRACE(fmt.Sprintf("Call CWmDeleteChatNotify %s", chatId))
-	CWmDeleteChatNotify(connId, chatId)
+// temporary upload file, reporting progress as the encrypted data is read back for upload
+type UploadProgressFile struct {
+	file        *os.File
+	size        int64
+	offset      int64
+	lastPercent int
+	progress    func(percent int)
 }
 
-func (handler *WmEventHandler) HandleMute(mute *events.Mute) {
-	connId := handler.connId
-	chatId := mute.JID.ToNonAD().String()
-	muteAction := mute.Action
-	if muteAction == nil {
-		LOG_WARNING(fmt.Sprintf("mute event missing mute action"))
-		return
-	}
+func (upload *UploadProgressFile) Write(p []byte) (int, error) {
+	n, err := upload.file.Write(p)
+	upload.size += int64(n)
+	return n, err
+}
 
-	isMuted := *muteAction.Muted
+func (upload *UploadProgressFile) Seek(offset int64, whence int) (int64, error) {
+	pos, err := upload.file.Seek(offset, whence)
+	upload.offset = pos
+	return pos, err
+}
 
-	LOG_TRACE(fmt.Sprintf("Call CWmUpdateMuteNotify %s %s", chatId, strconv.FormatBool(isMuted)))
-	CWmUpdateMuteNotify(connId, chatId, BoolToInt(isMuted))
+func (upload *UploadProgressFile) Read(p []byte) (int, error) {
+	n, err := upload.file.Read(p)
+	upload.offset += int64(n)
+	if upload.size > 0 {
+		percent := int(upload.offset * 100 / upload.size)
+		if percent != upload.lastPercent {
+			upload.lastPercent = percent
+			upload.progress(percent)
+		}
+	}
+	return n, err
 }
 
-func (handler *WmEventHandler) HandlePin(pin *events.Pin) {
-	connId := handler.connId
-	chatId := pin.JID.ToNonAD().String()
-	pinAction := pin.Action
-	if pinAction == nil {
-		LOG_WARNING(fmt.Sprintf("pin event missing pin action"))
-		return
+func UploadFromFile(connId int, chatId string, filePath string, mediaType whatsmeow.MediaType) (whatsmeow.UploadResponse, error) {
+	client := GetClient(connId)
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return whatsmeow.UploadResponse{}, err
 	}
+	defer file.Close()
 
-	isPinned := *pinAction.Pinned
-	timePinned := int(pin.Timestamp.Unix())
+	var tmpPath string = GetPath(connId) + "/tmp"
+	tmpFile, err := os.CreateTemp(tmpPath, "upload-*")
+	if err != nil {
+		return whatsmeow.UploadResponse{}, err
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	progressFile := &UploadProgressFile{
+		file:        tmpFile,
+		lastPercent: -1,
+		progress: func(percent int) {
+			LOG_TRACE(fmt.Sprintf("Call CWmSendMessageProgressNotify %s %d", chatId, percent))
+			CWmSendMessageProgressNotify(connId, chatId, percent)
+		},
+	}
 
-	LOG_TRACE(fmt.Sprintf("Call CWmUpdatePinNotify %s %s %d", chatId, strconv.FormatBool(isPinned), timePinned))
-	CWmUpdatePinNotify(connId, chatId, BoolToInt(isPinned), timePinned)
+	return client.UploadReader(context.Background(), file, progressFile, mediaType)
 }
 
-func (handler *WmEventHandler) HandleClientOutdated() {
-	connId := handler.connId
-	LOG_WARNING(fmt.Sprintf("Client Outdated"))
-	SetState(connId, Outdated)
+// profile pictures
+func ProfilePicturePath(connId int, chatId string, pictureId string) string {
+	var tmpPath string = GetPath(connId) + "/tmp"
+	return fmt.Sprintf("%s/avatar-%s-%s.jpg", tmpPath, chatId, pictureId)
 }
 
-func (handler *WmEventHandler) HandleLoggedOut() {
-	LOG_INFO("logged out by server, reinit")
-	connId := handler.connId
+func GetCachedPictureId(connId int, chatId string) string {
+	pictureId := GetPictureId(connId, chatId)
+	if len(pictureId) > 0 {
+		if _, statErr := os.Stat(ProfilePicturePath(connId, chatId, pictureId)); os.IsNotExist(statErr) {
+			SetPictureId(connId, chatId, "")
+			pictureId = ""
+		}
+	} else {
+		// look for picture downloaded in a previous session
+		matches, _ := filepath.Glob(ProfilePicturePath(connId, chatId, "*"))
+		if len(matches) > 0 {
+			pictureId = strings.TrimPrefix(filepath.Base(matches[0]), "avatar-"+chatId+"-")
+			pictureId = strings.TrimSuffix(pictureId, ".jpg")
+			SetPictureId(connId, chatId, pictureId)
+		}
+	}
 
-	LOG_TRACE(fmt.Sprintf("Call CWmReinit"))
-	CWmReinit(connId)
+	return pictureId
 }
 
-func GetNameFromContactInfo(contactInfo types.ContactInfo) string {
-	if len(contactInfo.FullName) > 0 {
-		return contactInfo.FullName
+var profilePictureTimeout = 30 * time.Second
+
+func DownloadProfilePicture(connId int, chatId string) (string, error) {
+	client := GetClient(connId)
+
+	chatJid, jidErr := types.ParseJID(chatId)
+	if jidErr != nil {
+		return "", jidErr
 	}
 
-	if len(contactInfo.FirstName) > 0 {
-		return contactInfo.FirstName
+	// return cached picture if not changed
+	existingId := GetCachedPictureId(connId, chatId)
+
+	params := whatsmeow.GetProfilePictureParams{
+		ExistingID: existingId,
+	}
+	info, err := client.GetProfilePictureInfo(chatJid, &params)
+	if errors.Is(err, whatsmeow.ErrProfilePictureNotSet) || errors.Is(err, whatsmeow.ErrProfilePictureUnauthorized) {
+		LOG_TRACE(fmt.Sprintf("profile picture not available %s", chatId))
+		RemoveProfilePicture(connId, chatId)
+		return "", nil
+	} else if err != nil {
+		return "", err
+	} else if info == nil {
+		LOG_TRACE(fmt.Sprintf("profile picture cached %s", chatId))
+		return ProfilePicturePath(connId, chatId, existingId), nil
 	}
 
-	if len(contactInfo.PushName) > 0 {
-		return contactInfo.PushName
+	// download new picture
+	LOG_TRACE(fmt.Sprintf("download profile picture %s %s", chatId, info.ID))
+	data, err := client.DownloadPlain(info.URL, profilePictureTimeout)
+	if err != nil {
+		return "", err
 	}
 
-	if len(contactInfo.BusinessName) > 0 {
-		return contactInfo.BusinessName
+	filePath := ProfilePicturePath(connId, chatId, info.ID)
+	err = os.WriteFile(filePath, data, 0644)
+	if err != nil {
+		return "", err
 	}
 
-	return ""
+	// remove previous picture
+	if len(existingId) > 0 && (existingId != info.ID) {
+		_ = os.Remove(ProfilePicturePath(connId, chatId, existingId))
+	}
+
+	SetPictureId(connId, chatId, info.ID)
+	return filePath, nil
 }
 
-func PhoneFromUserId(userId string) string {
-	phone := ""
-	if strings.HasSuffix(userId, "@s.whatsapp.net") {
-		phone = strings.Replace(userId, "@s.whatsapp.net", "", 1)
+func RemoveProfilePicture(connId int, chatId string) {
+	existingId := GetCachedPictureId(connId, chatId)
+	if len(existingId) > 0 {
+		_ = os.Remove(ProfilePicturePath(connId, chatId, existingId))
+		SetPictureId(connId, chatId, "")
 	}
-
-	LOG_TRACE(fmt.Sprintf("user %s phone %s", userId, phone))
-	return phone
 }
 
-func (handler *WmEventHandler) GetContacts() {
-	var client *whatsmeow.Client = GetClient(handler.connId)
-	connId := handler.connId
-	LOG_TRACE(fmt.Sprintf("GetContacts"))
+// whatsapp expects square profile pictures of this size
+var profilePictureSize = 640
 
-	CWmSetStatus(FlagFetching)
+func ImageFileToProfilePicture(filePath string) ([]byte, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
 
-	// contacts
-	contacts, contErr := client.Store.Contacts.GetAllContacts()
-	if contErr != nil {
-		LOG_WARNING(fmt.Sprintf("get all contacts failed %#v", contErr))
-	} else {
-		LOG_TRACE(fmt.Sprintf("contacts %#v", contacts))
-		for jid, contactInfo := range contacts {
-			name := GetNameFromContactInfo(contactInfo)
-			if len(name) > 0 {
-				userId := JidToStr(jid)
-				phone := PhoneFromUserId(userId)
-				LOG_TRACE(fmt.Sprintf("Call CWmNewContactsNotify %s %s", userId, name))
-				CWmNewContactsNotify(connId, userId, name, phone, BoolToInt(false))
-				AddContactName(connId, userId, name)
-			} else {
-				LOG_WARNING(fmt.Sprintf("Skip CWmNewContactsNotify %s %#v", JidToStr(jid), contactInfo))
-			}
-		}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
 	}
 
-	// special handling for self
-	selfId := JidToStr(*client.Store.ID)
-	selfName := "" // overridden by ui
-	selfPhone := PhoneFromUserId(selfId)
-	LOG_TRACE(fmt.Sprintf("Call CWmNewContactsNotify %s %s", selfId, selfName))
-	CWmNewContactsNotify(connId, selfId, selfName, selfPhone, BoolToInt(true))
-	AddContactName(connId, selfId, selfName)
+	// center crop to square
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	if side <= 0 {
+		return nil, fmt.Errorf("invalid picture size %dx%d", bounds.Dx(), bounds.Dy())
+	}
 
-	// special handling for official whatsapp account
-	whatsappId := "0@s.whatsapp.net"
-	whatsappName := "WhatsApp"
-	whatsappPhone := ""
-	LOG_TRACE(fmt.Sprintf("Call CWmNewContactsNotify %s %s", whatsappId, whatsappName))
-	CWmNewContactsNotify(connId, whatsappId, whatsappName, whatsappPhone, BoolToInt(false))
-	AddContactName(connId, whatsappId, whatsappName)
+	x0 := bounds.Min.X + (bounds.Dx()-side)/2
+	y0 := bounds.Min.Y + (bounds.Dy()-side)/2
+	crop := image.Rect(x0, y0, x0+side, y0+side)
 
-	// special handling for status updates
-	statusId := "status@broadcast"
-	statusName := "Status Updates"
-	statusPhone := ""
-	LOG_TRACE(fmt.Sprintf("Call CWmNewContactsNotify %s %s", statusId, statusName))
-	CWmNewContactsNotify(connId, statusId, statusName, statusPhone, BoolToInt(false))
-	AddContactName(connId, statusId, statusName)
+	// scale onto white background, as jpeg has no transparency
+	picture := image.NewRGBA(image.Rect(0, 0, profilePictureSize, profilePictureSize))
+	draw.Draw(picture, picture.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(picture, picture.Bounds(), img, crop, draw.Over, nil)
 
-	// groups
-	groups, groupErr := client.GetJoinedGroups()
-	if groupErr != nil {
-		LOG_WARNING(fmt.Sprintf("get joined groups failed %#v", groupErr))
-	} else {
-		LOG_TRACE(fmt.Sprintf("groups %#v", groups))
-		for _, group := range groups {
-			groupId := JidToStr(group.JID)
-			groupName := group.GroupName.Name
-			groupPhone := ""
-			LOG_TRACE(fmt.Sprintf("Call CWmNewContactsNotify %s %s", groupId, groupName))
-			CWmNewContactsNotify(connId, groupId, groupName, groupPhone, BoolToInt(false))
-			AddContactName(connId, groupId, groupName)
-		}
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, picture, &jpeg.Options{Quality: 90})
+	if err != nil {
+		return nil, err
 	}
 
-	CWmClearStatus(FlagFetching)
+	return buf.Bytes(), nil
 }
 
-func (handler *WmEventHandler) HandleMessage(messageInfo types.MessageInfo, msg *waE2E.Message, isSyncRead bool) {
-	switch {
-	case msg.Conversation != nil || msg.ExtendedTextMessage != nil:
-		handler.HandleTextMessage(messageInfo, msg, isSyncRead)
+// media thumbnails and dimensions
+var thumbnailMaxSize = 100
 
-	case msg.ImageMessage != nil:
-		handler.HandleImageMessage(messageInfo, msg, isSyncRead)
+func GetImageInfo(filePath string) (uint32, uint32, []byte, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	defer file.Close()
 
-	case msg.VideoMessage != nil:
-		handler.HandleVideoMessage(messageInfo, msg, isSyncRead)
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return 0, 0, nil, err
+	}
 
-	case msg.AudioMessage != nil:
-		handler.HandleAudioMessage(messageInfo, msg, isSyncRead)
+	bounds := img.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+	if (width <= 0) || (height <= 0) {
+		return 0, 0, nil, errors.New("invalid image dimensions")
+	}
 
-	case msg.DocumentMessage != nil:
-		handler.HandleDocumentMessage(messageInfo, msg, isSyncRead)
+	// scale down keeping aspect ratio
+	thumbWidth := width
+	thumbHeight := height
+	if (width >= height) && (width > thumbnailMaxSize) {
+		thumbWidth = thumbnailMaxSize
+		thumbHeight = max(1, height*thumbnailMaxSize/width)
+	} else if (height > width) && (height > thumbnailMaxSize) {
+		thumbHeight = thumbnailMaxSize
+		thumbWidth = max(1, width*thumbnailMaxSize/height)
+	}
 
-	case msg.StickerMessage != nil:
-		handler.HandleStickerMessage(messageInfo, msg, isSyncRead)
+	// jpeg has no alpha, so draw onto white background
+	thumb := image.NewRGBA(image.Rect(0, 0, thumbWidth, thumbHeight))
+	draw.Draw(thumb, thumb.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.ApproxBiLinear.Scale(thumb, thumb.Bounds(), img, bounds, draw.Over, nil)
 
-	case msg.TemplateMessage != nil:
-		handler.HandleTemplateMessage(messageInfo, msg, isSyncRead)
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 75})
+	if err != nil {
+		return 0, 0, nil, err
+	}
 
-	case msg.ReactionMessage != nil:
-		handler.HandleReactionMessage(messageInfo, msg, isSyncRead)
+	return uint32(width), uint32(height), buf.Bytes(), nil
+}
 
-	case msg.ProtocolMessage != nil:
-		handler.HandleProtocolMessage(messageInfo, msg, isSyncRead)
+// voice notes
+var waveformSamples = 64
+var opusSampleRate = 48000
 
-	default:
-		handler.HandleUnsupportedMessage(messageInfo, msg, isSyncRead)
-	}
+func FormatDuration(seconds uint32) string {
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
 }
 
-func (handler *WmEventHandler) HandleTextMessage(messageInfo types.MessageInfo, msg *waE2E.Message, isSyncRead bool) {
-	LOG_TRACE(fmt.Sprintf("TextMessage"))
+// returns sizes of opus audio packets and duration in seconds for an ogg/opus file
+func ReadOggOpusPackets(filePath string) ([]int, uint32, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	header := make([]byte, 27)
+	segments := make([]byte, 255)
+	var packets []int
+	var packet []byte
+	var granule int64
+	var preSkip int64
+	packetCount := 0
+	for {
+		if _, err := io.ReadFull(reader, header); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, 0, err
+		}
 
-	connId := handler.connId
-	var client *whatsmeow.Client = GetClient(handler.connId)
-	text := ""
+		if string(header[0:4]) != "OggS" {
+			return nil, 0, errors.New("not an ogg file")
+		}
 
-	// text
-	quotedId := ""
-	if msg.GetExtendedTextMessage() == nil {
-		text = msg.GetConversation()
-	} else {
-		text = msg.GetExtendedTextMessage().GetText()
-		ci := msg.GetExtendedTextMessage().GetContextInfo()
-		if ci != nil {
-			quotedId = ci.GetStanzaId()
+		if pageGranule := int64(binary.LittleEndian.Uint64(header[6:14])); pageGranule > 0 {
+			granule = pageGranule
 		}
-	}
 
-	// file id, path and status
-	fileId := ""
-	filePath := ""
-	fileStatus := FileStatusNone
+		segmentCount := int(header[26])
+		if _, err := io.ReadFull(reader, segments[:segmentCount]); err != nil {
+			return nil, 0, err
+		}
 
-	// general
-	chatId := GetChatId(messageInfo.Chat, messageInfo.Sender)
-	msgId := messageInfo.ID
-	fromMe := messageInfo.IsFromMe
-	senderId := JidToStr(messageInfo.Sender)
-	selfId := JidToStr(*client.Store.ID)
-	isSelfChat := (chatId == selfId)
-	timeSent := int(messageInfo.Timestamp.Unix())
-	isRead := IsRead(isSyncRead, isSelfChat, fromMe, messageInfo.Timestamp, GetTimeRead(connId, chatId))
-
-	// reset typing if needed
-	UpdateTypingStatus(connId, chatId, senderId, fromMe, isSyncRead)
+		// lacing values below 255 terminate a packet, which may span pages
+		for _, segmentSize := range segments[:segmentCount] {
+			data := make([]byte, segmentSize)
+			if _, err := io.ReadFull(reader, data); err != nil {
+				return nil, 0, err
+			}
 
-	LOG_TRACE(fmt.Sprintf("Call CWmNewMessagesNotify %s: %s", chatId, text))
-	CWmNewMessagesNotify(connId, chatId, msgId, senderId, text, BoolToInt(fromMe), quotedId, fileId, filePath, fileStatus, timeSent, BoolToInt(isRead))
-}
+			packet = append(packet, data...)
+			if segmentSize == 255 {
+				continue
+			}
 
-func (handler *WmEventHandler) HandleImageMessage(messageInfo types.MessageInfo, msg *waE2E.Message, isSyncRead bool) {
-	LOG_TRACE(fmt.Sprintf("ImageMessage"))
+			if packetCount == 0 {
+				// identification header
+				if (len(packet) < 19) || (string(packet[0:8]) != "OpusHead") {
+					return nil, 0, errors.New("not an opus stream")
+				}
 
-	connId := handler.connId
-	var client *whatsmeow.Client = GetClient(handler.connId)
+				preSkip = int64(binary.LittleEndian.Uint16(packet[10:12]))
+			} else if packetCount > 1 {
+				// skip comment header, keep audio packets
+				packets = append(packets, len(packet))
+			}
 
-	// get image part
-	img := msg.GetImageMessage()
-	if img == nil {
-		LOG_WARNING(fmt.Sprintf("get image message failed"))
-		return
+			packetCount++
+			packet = nil
+		}
 	}
 
-	// get extension
-	ext := "jpg"
-	exts, extErr := mime.ExtensionsByType(img.GetMimetype())
-	if extErr != nil && len(exts) > 0 {
-		ext = exts[0]
+	if packetCount == 0 {
+		return nil, 0, errors.New("not an opus stream")
 	}
 
-	// text
-	text := img.GetCaption()
+	samples := max(granule-preSkip, 0)
+	seconds := uint32((samples + int64(opusSampleRate)/2) / int64(opusSampleRate))
+	return packets, seconds, nil
+}
 
-	// context
-	quotedId := ""
-	ci := img.GetContextInfo()
-	if ci != nil {
-		quotedId = ci.GetStanzaId()
+// derives a voice note waveform from decoded audio, using ffmpeg as no opus decoder is
+// available in the build. returns nil if ffmpeg is not installed or decoding fails.
+func DecodeWaveform(filePath string) []byte {
+	ffmpegPath, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		LOG_DEBUG("ffmpeg not found, waveform not decoded")
+		return nil
 	}
 
-	// file id, path and status
-	var tmpPath string = GetPath(connId) + "/tmp"
-	filePath := fmt.Sprintf("%s/%s.%s", tmpPath, messageInfo.ID, ext)
-	fileId := DownloadableMessageToFileId(client, img, filePath)
-	fileStatus := FileStatusNotDownloaded
-
-	// general
-	chatId := GetChatId(messageInfo.Chat, messageInfo.Sender)
-	msgId := messageInfo.ID
-	fromMe := messageInfo.IsFromMe
-	senderId := JidToStr(messageInfo.Sender)
-	selfId := JidToStr(*client.Store.ID)
-	isSelfChat := (chatId == selfId)
-	timeSent := int(messageInfo.Timestamp.Unix())
-	isRead := IsRead(isSyncRead, isSelfChat, fromMe, messageInfo.Timestamp, GetTimeRead(connId, chatId))
-
-	// reset typing if needed
-	UpdateTypingStatus(connId, chatId, senderId, fromMe, isSyncRead)
+	pcm, err := exec.Command(ffmpegPath, "-v", "error", "-i", filePath, "-f", "s16le", "-ac", "1", "-ar", "8000", "-").Output()
+	if err != nil {
+		LOG_WARNING(fmt.Sprintf("decode audio error %#v", err))
+		return nil
+	}
 
-	LOG_TRACE(fmt.Sprintf("Call CWmNewMessagesNotify %s: image", chatId))
-	CWmNewMessagesNotify(connId, chatId, msgId, senderId, text, BoolToInt(fromMe), quotedId, fileId, filePath, fileStatus, timeSent, BoolToInt(isRead))
+	return WaveformFromSamples(pcm)
 }
 
-func (handler *WmEventHandler) HandleVideoMessage(messageInfo types.MessageInfo, msg *waE2E.Message, isSyncRead bool) {
-	LOG_TRACE(fmt.Sprintf("VideoMessage"))
+// computes waveform from 16-bit little endian mono samples, as rms per segment scaled to 0-100
+func WaveformFromSamples(pcm []byte) []byte {
+	sampleCount := len(pcm) / 2
+	if sampleCount < waveformSamples {
+		return nil
+	}
 
-	connId := handler.connId
-	var client *whatsmeow.Client = GetClient(handler.connId)
+	levels := make([]float64, waveformSamples)
+	maxLevel := 0.0
+	for i := range levels {
+		start := i * sampleCount / waveformSamples
+		end := (i + 1) * sampleCount / waveformSamples
+		sum := 0.0
+		for j := start; j < end; j++ {
+			sample := float64(int16(binary.LittleEndian.Uint16(pcm[j*2 : j*2+2])))
+			sum += sample * sample
+		}
 
-	// get video part
-	vid := msg.GetVideoMessage()
-	if vid == nil {
-		LOG_WARNING(fmt.Sprintf("get video message failed"))
-		return
+		levels[i] = math.Sqrt(sum / float64(end-start))
+		maxLevel = max(maxLevel, levels[i])
 	}
 
-	// get extension
-	ext := "mp4"
-	exts, extErr := mime.ExtensionsByType(vid.GetMimetype())
-	if extErr != nil && len(exts) > 0 {
-		ext = exts[0]
+	// silence carries no useful waveform
+	if maxLevel == 0 {
+		return nil
 	}
 
-	// text
-	text := vid.GetCaption()
+	// scale to 0-100 as expected by whatsapp
+	waveform := make([]byte, waveformSamples)
+	for i, level := range levels {
+		waveform[i] = byte(level * 100 / maxLevel)
+	}
 
-	// context
-	quotedId := ""
-	ci := vid.GetContextInfo()
-	if ci != nil {
-		quotedId = ci.GetStanzaId()
+	return waveform
+}
+
+// approximates a voice note waveform from opus packet sizes, used when the audio cannot be
+// decoded. only meaningful for variable bitrate streams, where packet sizes roughly follow
+// speech activity rather than amplitude. for constant bitrate streams nil is returned.
+func EstimateWaveform(packets []int) []byte {
+	if len(packets) == 0 || slices.Min(packets) == slices.Max(packets) {
+		return nil
 	}
 
-	// file id, path and status
-	var tmpPath string = GetPath(connId) + "/tmp"
-	filePath := fmt.Sprintf("%s/%s.%s", tmpPath, messageInfo.ID, ext)
-	fileId := DownloadableMessageToFileId(client, vid, filePath)
-	fileStatus := FileStatusNotDownloaded
+	waveform := make([]byte, waveformSamples)
+	levels := make([]float64, waveformSamples)
+	maxLevel := 0.0
+	for i := range levels {
+		start := i * len(packets) / waveformSamples
+		end := max((i+1)*len(packets)/waveformSamples, start+1)
+		sum := 0
+		for _, size := range packets[start:min(end, len(packets))] {
+			sum += size
+		}
 
-	// general
-	chatId := GetChatId(messageInfo.Chat, messageInfo.Sender)
-	msgId := messageInfo.ID
-	fromMe := messageInfo.IsFromMe
-	senderId := JidToStr(messageInfo.Sender)
-	selfId := JidToStr(*client.Store.ID)
-	isSelfChat := (chatId == selfId)
-	timeSent := int(messageInfo.Timestamp.Unix())
-	isRead := IsRead(isSyncRead, isSelfChat, fromMe, messageInfo.Timestamp, GetTimeRead(connId, chatId))
+		levels[i] = float64(sum) / float64(end-start)
+		maxLevel = max(maxLevel, levels[i])
+	}
 
-	// reset typing if needed
-	UpdateTypingStatus(connId, chatId, senderId, fromMe, isSyncRead)
+	// scale to 0-100 as expected by whatsapp
+	for i, level := range levels {
+		if maxLevel > 0 {
+			waveform[i] = byte(level * 100 / maxLevel)
+		}
+	}
 
-	LOG_TRACE(fmt.Sprintf("Call CWmNewMessagesNotify %s: video", chatId))
-	CWmNewMessagesNotify(connId, chatId, msgId, senderId, text, BoolToInt(fromMe), quotedId, fileId, filePath, fileStatus, timeSent, BoolToInt(isRead))
+	return waveform
 }
 
-func (handler *WmEventHandler) HandleAudioMessage(messageInfo types.MessageInfo, msg *waE2E.Message, isSyncRead bool) {
-	LOG_TRACE(fmt.Sprintf("AudioMessage"))
+// sticker limits
+var stickerSize uint32 = 512
+var stickerMaxBytes int64 = 100 * 1024
+var stickerAnimatedMaxBytes int64 = 500 * 1024
 
-	connId := handler.connId
-	var client *whatsmeow.Client = GetClient(handler.connId)
+func GetWebpInfo(filePath string) (uint32, uint32, bool, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	defer file.Close()
 
-	// get audio part
-	aud := msg.GetAudioMessage()
-	if aud == nil {
-		LOG_WARNING(fmt.Sprintf("get audio message failed"))
-		return
+	header := make([]byte, 30)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return 0, 0, false, err
 	}
 
-	// get extension
-	ext := "ogg"
-	exts, extErr := mime.ExtensionsByType(aud.GetMimetype())
-	if extErr != nil && len(exts) > 0 {
-		ext = exts[0]
+	if (string(header[0:4]) != "RIFF") || (string(header[8:12]) != "WEBP") {
+		return 0, 0, false, errors.New("not a webp file")
 	}
 
-	// text
-	text := ""
+	// extended format holds canvas size and animation flag
+	if string(header[12:16]) == "VP8X" {
+		isAnimated := (header[20] & 0x02) != 0
+		width := 1 + (uint32(header[24]) | uint32(header[25])<<8 | uint32(header[26])<<16)
+		height := 1 + (uint32(header[27]) | uint32(header[28])<<8 | uint32(header[29])<<16)
+		return width, height, isAnimated, nil
+	}
 
-	// context
-	quotedId := ""
-	ci := aud.GetContextInfo()
-	if ci != nil {
-		quotedId = ci.GetStanzaId()
+	// simple format is never animated
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, 0, false, err
 	}
 
-	// file id, path and status
-	var tmpPath string = GetPath(connId) + "/tmp"
-	filePath := fmt.Sprintf("%s/%s.%s", tmpPath, messageInfo.ID, ext)
-	fileId := DownloadableMessageToFileId(client, aud, filePath)
-	fileStatus := FileStatusNotDownloaded
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return 0, 0, false, err
+	}
 
-	// general
-	chatId := GetChatId(messageInfo.Chat, messageInfo.Sender)
-	msgId := messageInfo.ID
-	fromMe := messageInfo.IsFromMe
-	senderId := JidToStr(messageInfo.Sender)
-	selfId := JidToStr(*client.Store.ID)
-	isSelfChat := (chatId == selfId)
-	timeSent := int(messageInfo.Timestamp.Unix())
-	isRead := IsRead(isSyncRead, isSelfChat, fromMe, messageInfo.Timestamp, GetTimeRead(connId, chatId))
+	return uint32(config.Width), uint32(config.Height), false, nil
+}
 
-	// reset typing if needed
-	UpdateTypingStatus(connId, chatId, senderId, fromMe, isSyncRead)
+func IsValidSticker(width uint32, height uint32, isAnimated bool, fileSize int64) bool {
+	maxBytes := stickerMaxBytes
+	if isAnimated {
+		maxBytes = stickerAnimatedMaxBytes
+	}
 
-	LOG_TRACE(fmt.Sprintf("Call CWmNewMessagesNotify %s: audio", chatId))
-	CWmNewMessagesNotify(connId, chatId, msgId, senderId, text, BoolToInt(fromMe), quotedId, fileId, filePath, fileStatus, timeSent, BoolToInt(isRead))
+	if (width != stickerSize) || (height != stickerSize) {
+		LOG_DEBUG(fmt.Sprintf("sticker size %dx%d not %dx%d", width, height, stickerSize, stickerSize))
+		return false
+	}
+
+	if fileSize > maxBytes {
+		LOG_DEBUG(fmt.Sprintf("sticker file size %d exceeds limit %d", fileSize, maxBytes))
+		return false
+	}
+
+	return true
 }
 
-func (handler *WmEventHandler) HandleDocumentMessage(messageInfo types.MessageInfo, msg *waE2E.Message, isSyncRead bool) {
-	LOG_TRACE(fmt.Sprintf("DocumentMessage"))
+type Mp4Box struct {
+	boxType string
+	start   int64 // payload start
+	end     int64
+}
 
-	connId := handler.connId
-	var client *whatsmeow.Client = GetClient(handler.connId)
+func ReadMp4Boxes(reader io.ReaderAt, start int64, end int64) ([]Mp4Box, error) {
+	var boxes []Mp4Box
+	header := make([]byte, 16)
+	for offset := start; offset+8 <= end; {
+		if _, err := reader.ReadAt(header[:8], offset); err != nil {
+			return boxes, err
+		}
 
-	// get doc part
-	doc := msg.GetDocumentMessage()
-	if doc == nil {
-		LOG_WARNING(fmt.Sprintf("get document message failed"))
-		return
-	}
+		size := int64(binary.BigEndian.Uint32(header[0:4]))
+		boxType := string(header[4:8])
+		headerSize := int64(8)
+		if size == 1 {
+			// 64-bit size
+			if _, err := reader.ReadAt(header[8:16], offset+8); err != nil {
+				return boxes, err
+			}
 
-	// text
-	text := doc.GetCaption()
+			size = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerSize = 16
+		} else if size == 0 {
+			// box extends to end
+			size = end - offset
+		}
 
-	// context
-	quotedId := ""
-	ci := doc.GetContextInfo()
-	if ci != nil {
-		quotedId = ci.GetStanzaId()
+		if (size < headerSize) || (size > end-offset) {
+			return boxes, errors.New("invalid mp4 box " + boxType)
+		}
+
+		boxes = append(boxes, Mp4Box{boxType, offset + headerSize, offset + size})
+		offset += size
 	}
 
-	// file id, path and status
-	var tmpPath string = GetPath(connId) + "/tmp"
-	filePath := fmt.Sprintf("%s/%s-%s", tmpPath, messageInfo.ID, *doc.FileName)
-	fileId := DownloadableMessageToFileId(client, doc, filePath)
-	fileStatus := FileStatusNotDownloaded
+	return boxes, nil
+}
 
-	// general
-	chatId := GetChatId(messageInfo.Chat, messageInfo.Sender)
-	msgId := messageInfo.ID
-	fromMe := messageInfo.IsFromMe
-	senderId := JidToStr(messageInfo.Sender)
-	selfId := JidToStr(*client.Store.ID)
-	isSelfChat := (chatId == selfId)
-	timeSent := int(messageInfo.Timestamp.Unix())
-	isRead := IsRead(isSyncRead, isSelfChat, fromMe, messageInfo.Timestamp, GetTimeRead(connId, chatId))
+func FindMp4Box(boxes []Mp4Box, boxType string) *Mp4Box {
+	for i := range boxes {
+		if boxes[i].boxType == boxType {
+			return &boxes[i]
+		}
+	}
 
-	// reset typing if needed
-	UpdateTypingStatus(connId, chatId, senderId, fromMe, isSyncRead)
+	return nil
+}
 
-	LOG_TRACE(fmt.Sprintf("Call CWmNewMessagesNotify %s: document", chatId))
-	CWmNewMessagesNotify(connId, chatId, msgId, senderId, text, BoolToInt(fromMe), quotedId, fileId, filePath, fileStatus, timeSent, BoolToInt(isRead))
+func ReadMp4BoxData(reader io.ReaderAt, box *Mp4Box, maxLen int64) ([]byte, error) {
+	data := make([]byte, min(box.end-box.start, maxLen))
+	_, err := reader.ReadAt(data, box.start)
+	return data, err
 }
 
-func (handler *WmEventHandler) HandleStickerMessage(messageInfo types.MessageInfo, msg *waE2E.Message, isSyncRead bool) {
-	LOG_TRACE(fmt.Sprintf("StickerMessage"))
+func GetVideoInfo(filePath string) (uint32, uint32, uint32, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer file.Close()
 
-	connId := handler.connId
-	var client *whatsmeow.Client = GetClient(handler.connId)
+	stat, err := file.Stat()
+	if err != nil {
+		return 0, 0, 0, err
+	}
 
-	// get sticker part
-	sticker := msg.GetStickerMessage()
-	if sticker == nil {
-		LOG_WARNING(fmt.Sprintf("get sticker message failed"))
-		return
+	// mp4 and mov share the same container format
+	topBoxes, err := ReadMp4Boxes(file, 0, stat.Size())
+	moov := FindMp4Box(topBoxes, "moov")
+	if moov == nil {
+		if err == nil {
+			err = errors.New("moov box not found")
+		}
+		return 0, 0, 0, err
 	}
 
-	// get extension
-	ext := "webp"
-	exts, extErr := mime.ExtensionsByType(sticker.GetMimetype())
-	if extErr != nil && len(exts) > 0 {
-		ext = exts[0]
+	moovBoxes, err := ReadMp4Boxes(file, moov.start, moov.end)
+	if err != nil {
+		return 0, 0, 0, err
 	}
 
-	// text
-	text := "[Sticker]"
+	// duration from movie header
+	var seconds uint32
+	if mvhd := FindMp4Box(moovBoxes, "mvhd"); mvhd != nil {
+		data, err := ReadMp4BoxData(file, mvhd, 32)
+		if err != nil {
+			return 0, 0, 0, err
+		}
 
-	// context
-	quotedId := ""
-	ci := sticker.GetContextInfo()
-	if ci != nil {
-		quotedId = ci.GetStanzaId()
+		var timescale, duration uint64
+		if (len(data) > 0) && (data[0] == 1) {
+			if len(data) >= 32 {
+				timescale = uint64(binary.BigEndian.Uint32(data[20:24]))
+				duration = binary.BigEndian.Uint64(data[24:32])
+			}
+		} else if len(data) >= 20 {
+			timescale = uint64(binary.BigEndian.Uint32(data[12:16]))
+			duration = uint64(binary.BigEndian.Uint32(data[16:20]))
+		}
+
+		if timescale > 0 {
+			seconds = uint32((duration + timescale/2) / timescale)
+		}
 	}
 
-	// file id, path and status
-	var tmpPath string = GetPath(connId) + "/tmp"
-	filePath := fmt.Sprintf("%s/%s.%s", tmpPath, messageInfo.ID, ext)
-	fileId := DownloadableMessageToFileId(client, sticker, filePath)
-	fileStatus := FileStatusNotDownloaded
+	// dimensions from header of first video track
+	for _, trak := range moovBoxes {
+		if trak.boxType != "trak" {
+			continue
+		}
 
-	// general
-	chatId := GetChatId(messageInfo.Chat, messageInfo.Sender)
-	msgId := messageInfo.ID
-	fromMe := messageInfo.IsFromMe
-	senderId := JidToStr(messageInfo.Sender)
-	selfId := JidToStr(*client.Store.ID)
-	isSelfChat := (chatId == selfId)
-	timeSent := int(messageInfo.Timestamp.Unix())
-	isRead := IsRead(isSyncRead, isSelfChat, fromMe, messageInfo.Timestamp, GetTimeRead(connId, chatId))
+		trakBoxes, err := ReadMp4Boxes(file, trak.start, trak.end)
+		if err != nil {
+			continue
+		}
 
-	// reset typing if needed
-	UpdateTypingStatus(connId, chatId, senderId, fromMe, isSyncRead)
+		tkhd := FindMp4Box(trakBoxes, "tkhd")
+		mdia := FindMp4Box(trakBoxes, "mdia")
+		if (tkhd == nil) || (mdia == nil) {
+			continue
+		}
 
-	LOG_TRACE(fmt.Sprintf("Call CWmNewMessagesNotify %s: sticker", chatId))
-	CWmNewMessagesNotify(connId, chatId, msgId, senderId, text, BoolToInt(fromMe), quotedId, fileId, filePath, fileStatus, timeSent, BoolToInt(isRead))
-}
+		mdiaBoxes, err := ReadMp4Boxes(file, mdia.start, mdia.end)
+		if err != nil {
+			continue
+		}
 
-func (handler *WmEventHandler) HandleTemplateMessage(messageInfo types.MessageInfo, msg *waE2E.Message, isSyncRead bool) {
-	LOG_TRACE(fmt.Sprintf("TemplateMessage"))
+		hdlr := FindMp4Box(mdiaBoxes, "hdlr")
+		if hdlr == nil {
+			continue
+		}
 
-	connId := handler.connId
-	var client *whatsmeow.Client = GetClient(handler.connId)
+		hdlrData, err := ReadMp4BoxData(file, hdlr, 12)
+		if (err != nil) || (len(hdlrData) < 12) || (string(hdlrData[8:12]) != "vide") {
+			continue
+		}
 
-	// get template part
-	tpl := msg.GetTemplateMessage()
-	if tpl == nil {
-		LOG_WARNING(fmt.Sprintf("get template message failed"))
-		return
-	}
+		data, err := ReadMp4BoxData(file, tkhd, 96)
+		if err != nil {
+			continue
+		}
 
-	// handle hydrated template
-	hydtpl := tpl.GetHydratedTemplate()
-	if hydtpl == nil {
-		LOG_TRACE(fmt.Sprintf("unhandled template type"))
-		return
-	}
+		// width and height are 16.16 fixed point at end of header
+		sizeOffset := 76
+		if (len(data) > 0) && (data[0] == 1) {
+			sizeOffset = 88
+		}
 
-	// text slice
-	var texts []string
+		if len(data) < sizeOffset+8 {
+			continue
+		}
 
-	// title
-	switch hydtitle := hydtpl.GetTitle().(type) {
-	case *waE2E.TemplateMessage_HydratedFourRowTemplate_DocumentMessage:
-		texts = append(texts, "[Document]")
-	case *waE2E.TemplateMessage_HydratedFourRowTemplate_ImageMessage:
-		texts = append(texts, "[Image]")
-	case *waE2E.TemplateMessage_HydratedFourRowTemplate_VideoMessage:
-		texts = append(texts, "[Video]")
-	case *waE2E.TemplateMessage_HydratedFourRowTemplate_LocationMessage:
-		texts = append(texts, "[Location]")
-	case *waE2E.TemplateMessage_HydratedFourRowTemplate_HydratedTitleText:
-		if hydtitle.HydratedTitleText != "" {
-			texts = append(texts, hydtitle.HydratedTitleText)
+		width := binary.BigEndian.Uint32(data[sizeOffset:sizeOffset+4]) >> 16
+		height := binary.BigEndian.Uint32(data[sizeOffset+4:sizeOffset+8]) >> 16
+
+		// display matrix {a, b, u, c, d, v, x, y, w} precedes width and height, a
+		// rotation by 90 or 270 degrees has zero a and d, and swaps the dimensions
+		matrixOffset := sizeOffset - 36
+		matrixA := int32(binary.BigEndian.Uint32(data[matrixOffset : matrixOffset+4]))
+		matrixD := int32(binary.BigEndian.Uint32(data[matrixOffset+16 : matrixOffset+20]))
+		if (matrixA == 0) && (matrixD == 0) {
+			LOG_TRACE("video rotated 90 or 270 degrees")
+			width, height = height, width
 		}
-	}
 
-	// content
-	content := hydtpl.GetHydratedContentText()
-	if content != "" {
-		texts = append(texts, content)
+		return width, height, seconds, nil
 	}
 
-	// buttons
-	buttons := hydtpl.GetHydratedButtons()
-	for _, button := range buttons {
-		switch hydbutton := button.GetHydratedButton().(type) {
-		case *waE2E.HydratedTemplateButton_QuickReplyButton:
-			texts = append(texts, fmt.Sprintf("%s", hydbutton.QuickReplyButton.GetDisplayText()))
-		case *waE2E.HydratedTemplateButton_CallButton:
-			texts = append(texts, fmt.Sprintf("%s: %s", hydbutton.CallButton.GetDisplayText(), hydbutton.CallButton.GetPhoneNumber()))
-		}
-	}
+	return 0, 0, seconds, errors.New("video track not found")
+}
 
-	// footer
-	footer := hydtpl.GetHydratedFooterText()
-	if footer != "" {
-		texts = append(texts, footer)
-	}
+// text formatting
+var FormatNone = 0
+var FormatBold = (1 << 0)
+var FormatItalic = (1 << 1)
+var FormatStrike = (1 << 2)
+var FormatCode = (1 << 3)
+var FormatMono = (1 << 4)
+
+var formatMarkers = map[rune]int{'*': FormatBold, '_': FormatItalic, '~': FormatStrike, '`': FormatCode}
+var monoMarker = "```"
+
+// literal markers are escaped by backslash in markdown, and by a preceding zero width space in whatsapp
+var markdownEscape = '\\'
+var waEscape = '\u200B'
+
+type FormatSpan struct {
+	Style    int          // FormatNone for plain text
+	Text     string       // plain text, code or mono content
+	Children []FormatSpan // nested spans for bold, italic and strike
+}
 
-	// text
-	text := strings.Join(texts, "\n")
+type formatParser struct {
+	runes   []rune
+	literal []bool
+}
 
-	// context
-	quotedId := ""
-	ci := tpl.GetContextInfo()
-	if ci != nil {
-		quotedId = ci.GetStanzaId()
-	}
+func IsFormatMarker(r rune) bool {
+	_, ok := formatMarkers[r]
+	return ok
+}
 
-	// file id, path and status
-	fileId := ""
-	filePath := ""
-	fileStatus := FileStatusNone
+func IsFormatBoundary(r rune) bool {
+	return unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r) || (r == waEscape)
+}
 
-	// general
-	chatId := GetChatId(messageInfo.Chat, messageInfo.Sender)
-	msgId := messageInfo.ID
-	fromMe := messageInfo.IsFromMe
-	senderId := JidToStr(messageInfo.Sender)
-	selfId := JidToStr(*client.Store.ID)
-	isSelfChat := (chatId == selfId)
-	timeSent := int(messageInfo.Timestamp.Unix())
-	isRead := IsRead(isSyncRead, isSelfChat, fromMe, messageInfo.Timestamp, GetTimeRead(connId, chatId))
+// urls are kept verbatim, markers within them are never treated as formatting
+var formatUrlRegex = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+var formatUrlTrailing = ".,;:!?)'\""
+
+func FormatUrlRunes(runes []rune) []bool {
+	inUrl := make([]bool, len(runes))
+	text := string(runes)
+	for _, loc := range formatUrlRegex.FindAllStringIndex(text, -1) {
+		urlRunes := []rune(text[loc[0]:loc[1]])
+		for (len(urlRunes) > 0) && (IsFormatMarker(urlRunes[len(urlRunes)-1]) || strings.ContainsRune(formatUrlTrailing, urlRunes[len(urlRunes)-1])) {
+			urlRunes = urlRunes[:len(urlRunes)-1]
+		}
 
-	// reset typing if needed
-	UpdateTypingStatus(connId, chatId, senderId, fromMe, isSyncRead)
+		start := utf8.RuneCountInString(text[:loc[0]])
+		for i := start; i < start+len(urlRunes); i++ {
+			inUrl[i] = true
+		}
+	}
 
-	LOG_TRACE(fmt.Sprintf("Call CWmNewMessagesNotify %s: template", chatId))
-	CWmNewMessagesNotify(connId, chatId, msgId, senderId, text, BoolToInt(fromMe), quotedId, fileId, filePath, fileStatus, timeSent, BoolToInt(isRead))
+	return inUrl
 }
 
-func (handler *WmEventHandler) HandleReactionMessage(messageInfo types.MessageInfo, msg *waE2E.Message, isSyncRead bool) {
-	LOG_TRACE(fmt.Sprintf("ReactionMessage"))
+func ParseFormatting(text string, escape rune) []FormatSpan {
+	var parser formatParser
+	input := []rune(text)
+	inUrl := FormatUrlRunes(input)
+	for i := 0; i < len(input); i++ {
+		if inUrl[i] {
+			parser.runes = append(parser.runes, input[i])
+			parser.literal = append(parser.literal, true)
+			continue
+		}
 
-	connId := handler.connId
+		isEscapedMarker := (i+1 < len(input)) && IsFormatMarker(input[i+1])
+		isEscapedEscape := (i+1 < len(input)) && (input[i+1] == escape) && (escape == markdownEscape)
+		if (input[i] == escape) && (isEscapedMarker || isEscapedEscape) {
+			i++
+			parser.runes = append(parser.runes, input[i])
+			parser.literal = append(parser.literal, true)
+			continue
+		}
 
-	// get reaction part
-	reaction := msg.GetReactionMessage()
-	if reaction == nil {
-		LOG_WARNING(fmt.Sprintf("get reaction message failed"))
-		return
+		parser.runes = append(parser.runes, input[i])
+		parser.literal = append(parser.literal, false)
 	}
 
-	// general
-	chatId := GetChatId(messageInfo.Chat, messageInfo.Sender)
-	fromMe := messageInfo.IsFromMe
-	senderId := JidToStr(messageInfo.Sender)
-	text := reaction.GetText()
-	msgId := *reaction.Key.ID
-
-	CWmNewMessageReactionNotify(connId, chatId, msgId, senderId, text, BoolToInt(fromMe))
+	return parser.parse(0, len(parser.runes))
+}
 
-	// @todo: add auto-marking reactions of read, investigate why below does not work
-	//reMsgId := messageInfo.ID
-	//WmMarkMessageRead(connId, chatId, senderId, reMsgId)
+func (parser *formatParser) canOpen(i int, end int) bool {
+	return !parser.literal[i] && (i+1 < end) && !unicode.IsSpace(parser.runes[i+1]) &&
+		((i == 0) || IsFormatBoundary(parser.runes[i-1]))
 }
 
-func (handler *WmEventHandler) HandleProtocolMessage(messageInfo types.MessageInfo, msg *waE2E.Message, isSyncRead bool) {
-	LOG_TRACE(fmt.Sprintf("ProtocolMessage"))
+func (parser *formatParser) canClose(k int) bool {
+	return !parser.literal[k] && !unicode.IsSpace(parser.runes[k-1]) &&
+		((k+1 == len(parser.runes)) || IsFormatBoundary(parser.runes[k+1]))
+}
 
-	// get protocol part
-	protocol := msg.GetProtocolMessage()
-	if protocol == nil {
-		LOG_WARNING(fmt.Sprintf("get protocol message failed"))
-		return
+func (parser *formatParser) isMonoMarker(i int, end int) bool {
+	if i+len(monoMarker) > end {
+		return false
 	}
 
-	if protocol.GetType() == waE2E.ProtocolMessage_MESSAGE_EDIT {
-		// handle message edit
-		editedMsg := protocol.GetEditedMessage()
-		if editedMsg != nil {
-			newMessageInfo := messageInfo
-			newMessageInfo.ID = protocol.GetKey().GetId()
-			handler.HandleMessage(newMessageInfo, editedMsg, isSyncRead)
-		} else {
-			LOG_WARNING(fmt.Sprintf("get edited message failed"))
+	for j, r := range monoMarker {
+		if (parser.runes[i+j] != r) || parser.literal[i+j] {
+			return false
 		}
-	} else if protocol.GetType() == waE2E.ProtocolMessage_REVOKE {
-		// handle message revoke
-		connId := handler.connId
-		chatId := messageInfo.Chat.String()
-		msgId := protocol.GetKey().GetId()
-		LOG_TRACE(fmt.Sprintf("Call CWmDeleteMessageNotify %s %s", chatId, msgId))
-		CWmDeleteMessageNotify(connId, chatId, msgId)
-	} else {
-		LOG_TRACE(fmt.Sprintf("ProtocolMessage %#v ignore", protocol.GetType()))
 	}
+
+	return true
 }
 
-func (handler *WmEventHandler) HandleUnsupportedMessage(messageInfo types.MessageInfo, msg *waE2E.Message, isSyncRead bool) {
-	// list from type Message struct in def.pb.go
-	msgType := "Unknown"
-	msgNotify := false
-	switch {
-	case msg.ImageMessage != nil:
-		msgType = "ImageMessage"
+func (parser *formatParser) findMonoEnd(i int, end int) int {
+	if !parser.isMonoMarker(i, end) || ((i > 0) && !IsFormatBoundary(parser.runes[i-1])) {
+		return -1
+	}
 
-	case msg.ExtendedTextMessage != nil:
-		msgType = "ExtendedTextMessage"
+	// mono blocks may span multiple lines
+	for k := i + len(monoMarker) + 1; k < end; k++ {
+		if parser.isMonoMarker(k, end) {
+			return k
+		}
+	}
 
-	case msg.DocumentMessage != nil:
-		msgType = "DocumentMessage"
+	return -1
+}
 
-	case msg.AudioMessage != nil:
-		msgType = "AudioMessage"
+func (parser *formatParser) findSpanEnd(i int, end int) int {
+	marker := parser.runes[i]
+	if !IsFormatMarker(marker) || !parser.canOpen(i, end) {
+		return -1
+	}
 
-	case msg.VideoMessage != nil:
-		msgType = "VideoMessage"
+	// other spans must be on a single line
+	for k := i + 2; (k < end) && (parser.runes[k] != '\n'); k++ {
+		if (parser.runes[k] == marker) && parser.canClose(k) {
+			return k
+		}
+	}
 
-	case msg.StickerMessage != nil:
-		msgType = "StickerMessage"
+	return -1
+}
 
-	case msg.SenderKeyDistributionMessage != nil:
-		msgType = "SenderKeyDistributionMessage"
+func (parser *formatParser) parse(start int, end int) []FormatSpan {
+	var spans []FormatSpan
+	var text []rune
+	flush := func() {
+		if len(text) > 0 {
+			spans = append(spans, FormatSpan{Style: FormatNone, Text: string(text)})
+			text = nil
+		}
+	}
 
-	case msg.ContactMessage != nil:
-		msgType = "Contact"
-		msgNotify = true
+	for i := start; i < end; {
+		if k := parser.findMonoEnd(i, end); k != -1 {
+			flush()
+			spans = append(spans, FormatSpan{Style: FormatMono, Text: string(parser.runes[i+len(monoMarker) : k])})
+			i = k + len(monoMarker)
+			continue
+		}
 
-	case msg.LocationMessage != nil:
-		msgType = "Location"
-		msgNotify = true
+		if k := parser.findSpanEnd(i, end); k != -1 {
+			flush()
+			style := formatMarkers[parser.runes[i]]
+			if style == FormatCode {
+				spans = append(spans, FormatSpan{Style: style, Text: string(parser.runes[i+1 : k])})
+			} else {
+				spans = append(spans, FormatSpan{Style: style, Children: parser.parse(i+1, k)})
+			}
+			i = k + 1
+			continue
+		}
 
-	case msg.Call != nil:
-		msgType = "Call"
-		msgNotify = true
+		text = append(text, parser.runes[i])
+		i++
+	}
 
-	case msg.Chat != nil:
-		msgType = "Chat"
+	flush()
+	return spans
+}
 
-	case msg.ContactsArrayMessage != nil:
-		msgType = "ContactsArrayMessage"
+// marks markers forming spans, which need to be escaped to be kept as plain text
+func (parser *formatParser) markSpanMarkers(start int, end int, marked []bool) {
+	for i := start; i < end; {
+		if k := parser.findMonoEnd(i, end); k != -1 {
+			for j := 0; j < len(monoMarker); j++ {
+				marked[i+j] = true
+				marked[k+j] = true
+			}
+			parser.markSpanMarkers(i+len(monoMarker), k, marked)
+			i = k + len(monoMarker)
+			continue
+		}
 
-	case msg.HighlyStructuredMessage != nil:
-		msgType = "HighlyStructuredMessage"
+		if k := parser.findSpanEnd(i, end); k != -1 {
+			marked[i] = true
+			marked[k] = true
+			parser.markSpanMarkers(i+1, k, marked)
+			i = k + 1
+			continue
+		}
 
-	case msg.FastRatchetKeySenderKeyDistributionMessage != nil:
-		msgType = "FastRatchetKeySenderKeyDistributionMessage"
+		i++
+	}
+}
 
-	case msg.SendPaymentMessage != nil:
-		msgType = "SendPaymentMessage"
+// escapes only what would otherwise be parsed as formatting, unpaired markers are kept as is
+func EscapeFormatting(text string, escape rune) string {
+	runes := []rune(text)
+	parser := formatParser{runes: runes, literal: FormatUrlRunes(runes)}
+	marked := make([]bool, len(runes))
+	parser.markSpanMarkers(0, len(runes), marked)
+
+	var builder strings.Builder
+	for i, r := range runes {
+		isEscape := !parser.literal[i] && (r == escape) && (escape == markdownEscape) &&
+			(i+1 < len(runes)) && (IsFormatMarker(runes[i+1]) || (runes[i+1] == escape))
+		if marked[i] || isEscape {
+			builder.WriteRune(escape)
+		}
 
-	case msg.LiveLocationMessage != nil:
-		msgType = "LiveLocation"
-		msgNotify = true
+		builder.WriteRune(r)
+	}
 
-	case msg.RequestPaymentMessage != nil:
-		msgType = "RequestPaymentMessage"
+	return builder.String()
+}
 
-	case msg.DeclinePaymentRequestMessage != nil:
-		msgType = "DeclinePaymentRequestMessage"
+func RenderFormatting(spans []FormatSpan, escape rune) string {
+	var builder strings.Builder
+	for _, span := range spans {
+		switch span.Style {
+		case FormatNone:
+			builder.WriteString(EscapeFormatting(span.Text, escape))
+
+		case FormatMono:
+			builder.WriteString(monoMarker + span.Text + monoMarker)
+
+		default:
+			var marker rune
+			for r, style := range formatMarkers {
+				if style == span.Style {
+					marker = r
+				}
+			}
 
-	case msg.CancelPaymentRequestMessage != nil:
-		msgType = "CancelPaymentRequestMessage"
+			builder.WriteRune(marker)
+			if span.Style == FormatCode {
+				builder.WriteString(span.Text)
+			} else {
+				builder.WriteString(RenderFormatting(span.Children, escape))
+			}
+			builder.WriteRune(marker)
+		}
+	}
 
-	case msg.GroupInviteMessage != nil:
-		msgType = "GroupInviteMessage"
+	return builder.String()
+}
 
-	case msg.TemplateButtonReplyMessage != nil:
-		msgType = "TemplateButtonReplyMessage"
+func ConvertFormatting(text string, fromEscape rune, toEscape rune) string {
+	return RenderFormatting(ParseFormatting(text, fromEscape), toEscape)
+}
 
-	case msg.ProductMessage != nil:
-		msgType = "ProductMessage"
+func WaTextToMarkdown(connId int, text string) string {
+	if !IsMarkdownEnabled(connId) {
+		return text
+	}
 
-	case msg.DeviceSentMessage != nil:
-		msgType = "DeviceSentMessage"
+	return ConvertFormatting(text, waEscape, markdownEscape)
+}
 
-	case msg.MessageContextInfo != nil:
-		msgType = "MessageContextInfo"
+func MarkdownToWaText(connId int, text string) string {
+	if !IsMarkdownEnabled(connId) {
+		return text
+	}
 
-	case msg.ListMessage != nil:
-		msgType = "ListMessage"
+	return ConvertFormatting(text, markdownEscape, waEscape)
+}
 
-	case msg.ViewOnceMessage != nil:
-		msgType = "ViewOnceMessage"
+// whatsapp links
+type WaLink struct {
+	Link string
+	Kind string
+	Code string
+	Text string
+}
 
-	case msg.OrderMessage != nil:
-		msgType = "OrderMessage"
+var WaLinkKindPhone = "phone"
+var WaLinkKindQr = "qr"
+var WaLinkKindMessage = "message"
 
-	case msg.ListResponseMessage != nil:
-		msgType = "ListResponseMessage"
+var waLinkRegexp = regexp.MustCompile(`(?i)(?:https?://)?(?:wa\.me|api\.whatsapp\.com)/[^\s]*`)
 
-	case msg.EphemeralMessage != nil:
-		msgType = "EphemeralMessage"
+func ParseWaLinks(text string) []WaLink {
+	var links []WaLink
+	for _, match := range waLinkRegexp.FindAllString(text, -1) {
+		rawUrl := match
+		if !strings.Contains(strings.ToLower(rawUrl), "://") {
+			rawUrl = "https://" + rawUrl
+		}
 
-	case msg.InvoiceMessage != nil:
-		msgType = "InvoiceMessage"
+		parsedUrl, err := url.Parse(rawUrl)
+		if err != nil {
+			LOG_TRACE(fmt.Sprintf("parse link %s err %#v", match, err))
+			continue
+		}
 
-	case msg.ButtonsMessage != nil:
-		msgType = "ButtonsMessage"
+		link := WaLink{Link: match}
+		segments := strings.Split(strings.Trim(parsedUrl.Path, "/"), "/")
+		query := parsedUrl.Query()
+		switch {
+		case (len(segments) == 2) && (strings.ToLower(segments[0]) == "qr"):
+			link.Kind = WaLinkKindQr
+			link.Code = segments[1]
+
+		case (len(segments) == 2) && (strings.ToLower(segments[0]) == "message"):
+			link.Kind = WaLinkKindMessage
+			link.Code = segments[1]
+
+		case (len(segments) == 1) && (strings.ToLower(segments[0]) == "send"):
+			link.Kind = WaLinkKindPhone
+			link.Code = query.Get("phone")
+			link.Text = query.Get("text")
+
+		case (len(segments) == 1) && (len(NormalizePhone(segments[0])) > 0):
+			link.Kind = WaLinkKindPhone
+			link.Code = segments[0]
+			link.Text = query.Get("text")
+
+		default:
+			LOG_TRACE(fmt.Sprintf("unsupported link %s", match))
+			continue
+		}
 
-	case msg.ButtonsResponseMessage != nil:
-		msgType = "ButtonsResponseMessage"
+		links = append(links, link)
+	}
 
-	case msg.PaymentInviteMessage != nil:
-		msgType = "PaymentInviteMessage"
+	return links
+}
 
-	case msg.InteractiveMessage != nil:
-		msgType = "InteractiveMessage"
+func ResolveWaLink(client *whatsmeow.Client, link WaLink) (types.JID, string, string, error) {
+	switch link.Kind {
+	case WaLinkKindPhone:
+		phone := NormalizePhone(link.Code)
+		if len(phone) == 0 {
+			return types.EmptyJID, "", "", fmt.Errorf("invalid phone number %s", link.Code)
+		}
+
+		responses, err := client.IsOnWhatsApp([]string{phone})
+		if err != nil {
+			return types.EmptyJID, "", "", err
+		}
+
+		if (len(responses) == 0) || !responses[0].IsIn {
+			return types.EmptyJID, "", "", fmt.Errorf("phone number %s not registered", phone)
+		}
+
+		name := ""
+		if responses[0].VerifiedName != nil {
+			name = responses[0].VerifiedName.Details.GetVerifiedName()
+		}
+
+		return responses[0].JID, name, link.Text, nil
+
+	case WaLinkKindQr:
+		target, err := client.ResolveContactQRLink(link.Code)
+		if err != nil {
+			return types.EmptyJID, "", "", err
+		}
+
+		return target.JID, target.PushName, "", nil
+
+	case WaLinkKindMessage:
+		target, err := client.ResolveBusinessMessageLink(link.Code)
+		if err != nil {
+			return types.EmptyJID, "", "", err
+		}
+
+		name := target.VerifiedName
+		if len(name) == 0 {
+			name = target.PushName
+		}
+
+		return target.JID, name, target.Message, nil
+
+	default:
+		return types.EmptyJID, "", "", fmt.Errorf("unsupported link kind %s", link.Kind)
+	}
+}
+
+func ResolveWaLinks(connId int, chatId string, msgId string, text string) int {
+	client := GetClient(connId)
+	count := 0
+	for _, link := range ParseWaLinks(text) {
+		jid, name, prefill, err := ResolveWaLink(client, link)
+		if err != nil {
+			LOG_WARNING(fmt.Sprintf("resolve link %s error %#v", link.Link, err))
+			continue
+		}
+
+		userId := JidToStr(jid.ToNonAD())
+		if len(name) == 0 {
+			name = PhoneFromUserId(userId)
+		}
+
+		AddUnknownContact(connId, userId, name)
+
+		LOG_TRACE(fmt.Sprintf("Call CWmNewLinkTargetNotify %s %s", link.Link, userId))
+		CWmNewLinkTargetNotify(connId, chatId, msgId, link.Link, userId, name, prefill)
+		count += 1
+	}
+
+	return count
+}
+
+// qr code
+func ShowQrCode(code string, qrPath string, hasGUI bool) {
+	if hasGUI {
+		qrcode.WriteFile(code, qrcode.Medium, 512, qrPath)
+		ShowImage(qrPath)
+	} else {
+		qrterminal.GenerateHalfBlock(code, qrterminal.L, os.Stdout)
+	}
+}
+
+// utils
+func ShowImage(path string) {
+	switch runtime.GOOS {
+	case "linux":
+		LOG_DEBUG("xdg-open " + path)
+		exec.Command("xdg-open", path).Start()
+	case "darwin":
+		LOG_DEBUG("open " + path)
+		exec.Command("open", path).Start()
+	default:
+		LOG_WARNING(fmt.Sprintf("unsupported os \"%s\"", runtime.GOOS))
+	}
+}
+
+func HasGUI() bool {
+	_, isForceQrTerminalSet := os.LookupEnv("FORCE_QR_TERMINAL")
+	if isForceQrTerminalSet {
+		return false
+	}
+
+	switch runtime.GOOS {
+	case "darwin":
+		LOG_INFO(fmt.Sprintf("has gui"))
+		LOG_DEBUG(fmt.Sprintf("gui check: [darwin default true]"))
+		return true
+
+	case "linux":
+		_, isDisplaySet := os.LookupEnv("DISPLAY")
+		file, err := ioutil.TempFile("/tmp", "nchat-x11check.*.sh")
+		if err != nil {
+			LOG_WARNING(fmt.Sprintf("create file failed %#v", err))
+			return isDisplaySet
+		}
+
+		defer os.Remove(file.Name())
+		content := "#!/usr/bin/env bash\n\n" +
+			"if command -v timeout &> /dev/null; then\n" +
+			"  CMD=\"timeout 1s xset q\"\n" +
+			"else\n" +
+			"  CMD=\"xset q\"\n" +
+			"fi\n" +
+			"echo \"${CMD}\"\n" +
+			"${CMD} > /dev/null\n" +
+			"exit ${?}\n"
+
+		_, err = io.WriteString(file, content)
+		if err != nil {
+			LOG_WARNING(fmt.Sprintf("write file failed %#v", err))
+			return isDisplaySet
+		}
+
+		err = file.Close()
+		if err != nil {
+			LOG_WARNING(fmt.Sprintf("close file failed %#v", err))
+			return isDisplaySet
+		}
+
+		err = os.Chmod(file.Name(), 0777)
+		if err != nil {
+			LOG_WARNING(fmt.Sprintf("chmod file failed %#v", err))
+			return isDisplaySet
+		}
+
+		cmdout, err := exec.Command(file.Name()).CombinedOutput()
+		if err == nil {
+			LOG_INFO(fmt.Sprintf("has gui"))
+			LOG_DEBUG(fmt.Sprintf("gui check: %s", strings.TrimSuffix(string(cmdout), "\n")))
+			return true
+		} else {
+			LOG_INFO(fmt.Sprintf("no gui"))
+			LOG_DEBUG(fmt.Sprintf("gui check: %s", strings.TrimSuffix(string(cmdout), "\n")))
+			return false
+		}
+
+	default:
+		LOG_INFO(fmt.Sprintf("no gui"))
+		LOG_DEBUG(fmt.Sprintf("gui check: [other \"%s\" default false]", runtime.GOOS))
+		return false
+	}
+}
+
+func BoolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func IntToBool(i int) bool {
+	return i != 0
+}
+
+func StringToInt(s string) int {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return 0
+	}
+	return i
+}
+
+func JidToStr(jid types.JID) string {
+	return jid.User + "@" + jid.Server
+}
+
+func GetChatId(chatJid types.JID, senderJid types.JID) string {
+	if chatJid.Server == "broadcast" {
+		if chatJid.User == "status" {
+			return JidToStr(chatJid) // status updates
+		} else {
+			return JidToStr(senderJid) // broadcast messages
+		}
+	} else {
+		return JidToStr(chatJid) // regular messages
+	}
+}
+
+func IsRead(isSyncRead bool, isSelfChat bool, fromMe bool, timeSent time.Time, timeRead time.Time) bool {
+	// consider message read:
+	// - during initial sync for chats with no unread messages
+	// - in self chat / saved messages
+	// - from others and timeSent <= timeRead i.e.. !timeSent.After(timeRead)
+	return isSyncRead || isSelfChat || (!fromMe && !timeSent.After(timeRead))
+}
+
+func ParseWebMessageInfo(selfJid types.JID, chatJid types.JID, webMsg *waWeb.WebMessageInfo) *types.MessageInfo {
+	info := types.MessageInfo{
+		MessageSource: types.MessageSource{
+			Chat:     chatJid,
+			IsFromMe: webMsg.GetKey().GetFromMe(),
+			IsGroup:  chatJid.Server == types.GroupServer,
+		},
+		ID:        webMsg.GetKey().GetId(),
+		PushName:  webMsg.GetPushName(),
+		Timestamp: time.Unix(int64(webMsg.GetMessageTimestamp()), 0),
+	}
+	if info.IsFromMe {
+		info.Sender = selfJid.ToNonAD()
+	} else if webMsg.GetParticipant() != "" {
+		info.Sender, _ = types.ParseJID(webMsg.GetParticipant())
+	} else if webMsg.GetKey().GetParticipant() != "" {
+		info.Sender, _ = types.ParseJID(webMsg.GetKey().GetParticipant())
+	} else {
+		info.Sender = chatJid
+	}
+	if info.Sender.IsEmpty() {
+		return nil
+	}
+	return &info
+}
+
+// logger
+type ncLogger struct{}
+
+func (s *ncLogger) Debugf(msg string, args ...interface{}) {
+	LOG_DEBUG(fmt.Sprintf("whatsmeow %s", fmt.Sprintf(msg, args...)))
+}
+
+func (s *ncLogger) Infof(msg string, args ...interface{}) {
+	LOG_INFO(fmt.Sprintf("whatsmeow %s", fmt.Sprintf(msg, args...)))
+}
+
+func (s *ncLogger) Warnf(msg string, args ...interface{}) {
+	LOG_WARNING(fmt.Sprintf("whatsmeow %s", fmt.Sprintf(msg, args...)))
+}
+
+func (s *ncLogger) Errorf(msg string, args ...interface{}) {
+	LOG_ERROR(fmt.Sprintf("whatsmeow %s", fmt.Sprintf(msg, args...)))
+}
+
+func (s *ncLogger) Sub(mod string) waLog.Logger {
+	return s
+}
+
+func NcLogger() waLog.Logger {
+	return &ncLogger{}
+}
+
+// loggable
+type ncSignalLogger struct{}
+
+func (s *ncSignalLogger) Debug(caller, msg string) {
+	LOG_DEBUG(fmt.Sprintf("whatsmeow %s", fmt.Sprintf("%s %s", caller, msg)))
+}
+
+func (s *ncSignalLogger) Info(caller, msg string) {
+	LOG_INFO(fmt.Sprintf("whatsmeow %s", fmt.Sprintf("%s %s", caller, msg)))
+}
+
+func (s *ncSignalLogger) Warning(caller, msg string) {
+	LOG_WARNING(fmt.Sprintf("whatsmeow %s", fmt.Sprintf("%s %s", caller, msg)))
+}
+
+func (s *ncSignalLogger) Error(caller, msg string) {
+	LOG_ERROR(fmt.Sprintf("whatsmeow %s", fmt.Sprintf("%s %s", caller, msg)))
+}
+
+func (s *ncSignalLogger) Configure(ss string) {
+}
+
+// event handling
+type WmEventHandler struct {
+	connId int
+}
+
+func (handler *WmEventHandler) HandleEvent(rawEvt interface{}) {
+	switch evt := rawEvt.(type) {
+
+	case *events.AppStateSyncComplete:
+		// this happens after initial logon via QR code
+		LOG_TRACE(fmt.Sprintf("%#v", evt))
+		if evt.Name == appstate.WAPatchCriticalBlock {
+			LOG_TRACE("AppStateSyncComplete WAPatchCriticalBlock")
+			handler.HandleConnected()
+		} else if evt.Name == appstate.WAPatchRegular {
+			LOG_TRACE("AppStateSyncComplete WAPatchRegular")
+			handler.GetContacts()
+		}
+
+	case *events.PushNameSetting:
+		// send presence when the pushname is changed remotely
+		LOG_TRACE(fmt.Sprintf("%#v", evt))
+		handler.HandleConnected()
+		handler.HandlePushNameSetting(evt)
+
+	case *events.PushName:
+		// other device changed our friendly name
+		LOG_TRACE(fmt.Sprintf("%#v", evt))
+
+	case *events.Connected:
+		// connected
+		LOG_TRACE(fmt.Sprintf("%#v", evt))
+		handler.FetchBlocklist()
+		handler.HandleConnected()
+		go handler.ResumeDownloads()
+		RequeuePresenceSubscriptions(handler.connId)
+		handler.HandleConnectedState()
+
+	case *events.Disconnected:
+		// disconnected
+		LOG_TRACE(fmt.Sprintf("%#v", evt))
+		handler.HandleDisconnected()
+
+	case *events.KeepAliveTimeout:
+		LOG_TRACE(fmt.Sprintf("%#v", evt))
+		handler.HandleKeepAliveTimeout(evt)
+
+	case *events.KeepAliveRestored:
+		LOG_TRACE(fmt.Sprintf("%#v", evt))
+		handler.HandleKeepAliveRestored()
+
+	case *events.TemporaryBan:
+		LOG_TRACE(fmt.Sprintf("%#v", evt))
+		handler.HandleTemporaryBan(evt)
+
+	case *events.ConnectFailure:
+		LOG_TRACE(fmt.Sprintf("%#v", evt))
+		handler.HandleConnectFailure(evt)
+
+	case *events.MediaRetry:
+		LOG_TRACE(fmt.Sprintf("%#v", evt))
+		handler.HandleMediaRetry(evt)
+
+	case *events.StreamReplaced:
+		LOG_TRACE(fmt.Sprintf("%#v", evt))
+		handler.HandleStreamReplaced()
+
+	case *events.Message:
+		LOG_TRACE(fmt.Sprintf("%#v", evt))
+		handler.HandleMessage(evt.Info, evt.Message, false /*isSyncRead*/, false /*isHistorySync*/)
+		go handler.HandleMessageLinks(evt.Info, evt.Message)
+
+	case *events.Receipt:
+		LOG_TRACE(fmt.Sprintf("%#v", evt))
+		handler.HandleReceipt(evt)
+
+	case *events.Presence:
+		LOG_TRACE(fmt.Sprintf("%#v", evt))
+		handler.HandlePresence(evt)
+
+	case *events.ChatPresence:
+		LOG_TRACE(fmt.Sprintf("%#v", evt))
+		handler.HandleChatPresence(evt)
+
+	case *events.HistorySync:
+		// This happens after initial logon via QR code (after AppStateSyncComplete)
+		LOG_TRACE(fmt.Sprintf("%#v", evt))
+		handler.HandleHistorySync(evt)
+
+	case *events.AppState:
+		LOG_TRACE(fmt.Sprintf("%#v - %#v / %#v", evt, evt.Index, evt.SyncActionValue))
+
+	case *events.LoggedOut:
+		LOG_TRACE(fmt.Sprintf("%#v", evt))
+		SetConnState(handler.connId, LoggedOut, evt.Reason.String())
+		handler.HandleLoggedOut()
+
+	case *events.QR:
+		// handled in WmLogin
+		LOG_TRACE(fmt.Sprintf("%#v", evt))
+
+	case *events.PairSuccess:
+		LOG_TRACE(fmt.Sprintf("%#v", evt))
+
+	case *events.JoinedGroup:
+		LOG_TRACE(fmt.Sprintf("%#v", evt))
+
+	case *events.OfflineSyncCompleted:
+		LOG_TRACE(fmt.Sprintf("%#v", evt))
+		handler.GetContacts()
+		handler.HandleOfflineSyncCompleted()
+
+	case *events.GroupInfo:
+		LOG_TRACE(fmt.Sprintf("%#v", evt))
+		handler.HandleGroupInfo(evt)
+
+	case *events.DeleteChat:
+		LOG_TRACE(fmt.Sprintf("%#v", evt))
+		handler.HandleDeleteChat(evt)
+
+	case *events.Mute:
+		LOG_TRACE(fmt.Sprintf("%#v", evt))
+		handler.HandleMute(evt)
+
+	case *events.Pin:
+		LOG_TRACE(fmt.Sprintf("%#v", evt))
+		handler.HandlePin(evt)
+
+	case *events.ClientOutdated:
+		LOG_TRACE(fmt.Sprintf("%#v", evt))
+		handler.HandleClientOutdated()
+
+	case *events.Blocklist:
+		LOG_TRACE(fmt.Sprintf("%#v", evt))
+		handler.HandleBlocklist(evt)
+
+	case *events.PrivacySettings:
+		LOG_TRACE(fmt.Sprintf("%#v", evt))
+		handler.HandlePrivacySettings(evt)
+
+	case *events.Picture:
+		LOG_TRACE(fmt.Sprintf("%#v", evt))
+		handler.HandlePicture(evt)
+
+	default:
+		LOG_TRACE(fmt.Sprintf("Event type not handled: %#v", rawEvt))
+	}
+}
+
+// offline sync normally completes shortly after connect, do not wait forever
+var offlineSyncTimeout = 30 * time.Second
+
+func (handler *WmEventHandler) HandleConnectedState() {
+	connId := handler.connId
+
+	// offline sync may complete before connected event is dispatched
+	if IsOfflineSynced(connId) {
+		SetConnState(connId, Online, "")
+		return
+	}
+
+	SetConnState(connId, Syncing, "")
+	time.AfterFunc(offlineSyncTimeout, func() {
+		if GetState(connId) == Syncing {
+			LOG_WARNING(fmt.Sprintf("offline sync timeout"))
+			SetConnState(connId, Online, "")
+		}
+	})
+}
+
+func (handler *WmEventHandler) HandleOfflineSyncCompleted() {
+	connId := handler.connId
+	SetOfflineSynced(connId, true)
+	if GetState(connId) == Syncing {
+		SetConnState(connId, Online, "")
+	}
+}
+
+func (handler *WmEventHandler) HandleDisconnected() {
+	connId := handler.connId
+	var client *whatsmeow.Client = GetClient(connId)
+
+	// keep state if already explained by another event
+	if IsTerminalState(GetState(connId)) {
+		return
+	}
+
+	if client.EnableAutoReconnect {
+		SetConnState(connId, Reconnecting, "")
+	} else {
+		SetConnState(connId, Disconnected, "")
+	}
+}
+
+func (handler *WmEventHandler) HandleTemporaryBan(tempBan *events.TemporaryBan) {
+	connId := handler.connId
+	message := GetTemporaryBanMessage(tempBan)
+	SetConnState(connId, Banned, message)
+	NotifyConnError(connId, message, false /*isReconnectable*/)
+}
+
+func (handler *WmEventHandler) HandleConnectFailure(connectFailure *events.ConnectFailure) {
+	connId := handler.connId
+	message := GetConnectFailureMessage(connectFailure.Reason, connectFailure.Message)
+	isReconnectable := IsReconnectableFailure(connectFailure.Reason)
+
+	// only terminal reasons stop auto reconnect
+	if isReconnectable {
+		SetConnState(connId, Reconnecting, message)
+	} else {
+		SetConnState(connId, Disconnected, message)
+	}
+
+	NotifyConnError(connId, message, isReconnectable)
+}
+
+func (handler *WmEventHandler) HandleStreamReplaced() {
+	connId := handler.connId
+	message := "Another client took over this session, for example nchat or WhatsApp Web running elsewhere."
+	SetConnState(connId, Replaced, message)
+	NotifyConnError(connId, message, true /*isReconnectable*/)
+}
+
+func (handler *WmEventHandler) HandleKeepAliveTimeout(keepAliveTimeout *events.KeepAliveTimeout) {
+	connId := handler.connId
+	var client *whatsmeow.Client = GetClient(connId)
+
+	// whatsmeow forces reconnect after max fail time
+	if client.EnableAutoReconnect && (time.Since(keepAliveTimeout.LastSuccess) > whatsmeow.KeepAliveMaxFailTime) {
+		SetConnState(connId, Reconnecting, "")
+	} else if IsConnectedState(GetState(connId)) {
+		SetConnState(connId, Degraded, "")
+	}
+}
+
+func (handler *WmEventHandler) HandleKeepAliveRestored() {
+	connId := handler.connId
+	if GetState(connId) == Degraded {
+		SetConnState(connId, Online, "")
+	}
+}
+
+func (handler *WmEventHandler) HandleConnected() {
+	LOG_TRACE(fmt.Sprintf("HandleConnected"))
+	var client *whatsmeow.Client = GetClient(handler.connId)
+
+	if len(client.Store.PushName) == 0 {
+		return
+	}
+}
+
+func (handler *WmEventHandler) HandlePushNameSetting(pushNameSetting *events.PushNameSetting) {
+	connId := handler.connId
+	if pushNameSetting.Action == nil {
+		LOG_WARNING(fmt.Sprintf("push name setting event missing action"))
+		return
+	}
+
+	pushName := pushNameSetting.Action.GetName()
+	LOG_TRACE(fmt.Sprintf("Call CWmUpdateSelfProfileNotify pushname %s", pushName))
+	CWmUpdateSelfProfileNotify(connId, ProfileKeyPushName, pushName)
+}
+
+func (handler *WmEventHandler) HandleReceipt(receipt *events.Receipt) {
+	if receipt.Type == events.ReceiptTypeRead || receipt.Type == events.ReceiptTypeReadSelf {
+		LOG_TRACE(fmt.Sprintf("%#v was read by %s at %s", receipt.MessageIDs, receipt.SourceString(), receipt.Timestamp))
+		connId := handler.connId
+		chatId := receipt.MessageSource.Chat.ToNonAD().String()
+		isRead := true
+		for _, msgId := range receipt.MessageIDs {
+			LOG_TRACE(fmt.Sprintf("Call CWmNewMessageStatusNotify"))
+			CWmNewMessageStatusNotify(connId, chatId, msgId, BoolToInt(isRead))
+		}
+	}
+}
+
+func (handler *WmEventHandler) HandlePresence(presence *events.Presence) {
+	if presence.From.Server != types.GroupServer {
+		connId := handler.connId
+		chatId := ""
+		userId := presence.From.ToNonAD().String()
+		isOnline := !presence.Unavailable
+		timeSeen := int(presence.LastSeen.Unix())
+		isTyping := false
+		SetLastSeen(connId, userId, isOnline, presence.LastSeen)
+		LOG_TRACE(fmt.Sprintf("Call CWmNewStatusNotify"))
+		CWmNewStatusNotify(connId, chatId, userId, BoolToInt(isOnline), BoolToInt(isTyping), timeSeen)
+	}
+}
+
+func (handler *WmEventHandler) HandleChatPresence(chatPresence *events.ChatPresence) {
+	connId := handler.connId
+	chatId := chatPresence.MessageSource.Chat.ToNonAD().String()
+	userId := chatPresence.MessageSource.Sender.ToNonAD().String()
+	isOnline := true
+	typing := TypingNone
+	if chatPresence.State == types.ChatPresenceComposing {
+		if chatPresence.Media == types.ChatPresenceMediaAudio {
+			typing = TypingAudio
+		} else {
+			typing = TypingText
+		}
+
+		StartTypingTimeout(connId, chatId, userId)
+	} else {
+		StopTypingTimeout(connId, chatId, userId)
+	}
+
+	LOG_TRACE(fmt.Sprintf("Call CWmNewStatusNotify"))
+	CWmNewStatusNotify(connId, chatId, userId, BoolToInt(isOnline), typing, -1)
+}
+
+func (handler *WmEventHandler) HandleHistorySync(historySync *events.HistorySync) {
+	var client *whatsmeow.Client = GetClient(handler.connId)
+	selfJid := *client.Store.ID
+
+	LOG_TRACE(fmt.Sprintf("HandleHistorySync SyncType %s Progress %d",
+		(*historySync.Data.SyncType).String(), historySync.Data.GetProgress()))
+
+	if historySync.Data.GetProgress() < 98 {
+		LOG_TRACE("Set Syncing")
+		CWmSetStatus(FlagSyncing)
+	}
+
+	conversations := historySync.Data.GetConversations()
+	for _, conversation := range conversations {
+		LOG_TRACE(fmt.Sprintf("HandleHistorySync Conversation %#v", *conversation))
+
+		chatJid, _ := types.ParseJID(conversation.GetId())
+
+		isUnread := 0
+		lastMessageTime := 0
+
+		isSyncRead := (conversation.GetUnreadCount() == 0)
+		hasMessages := false
+		syncMessages := conversation.GetMessages()
+		for _, syncMessage := range syncMessages {
+			webMessageInfo := syncMessage.Message
+			messageInfo := ParseWebMessageInfo(selfJid, chatJid, webMessageInfo)
+			message := webMessageInfo.GetMessage()
+
+			if (messageInfo == nil) || (message == nil) {
+				continue
+			}
+
+			handler.HandleMessage(*messageInfo, message, isSyncRead, true /*isHistorySync*/)
+			handler.HandleSyncReactions(chatJid, *messageInfo, webMessageInfo.GetReactions())
+			hasMessages = true
+
+			messageTime := int(messageInfo.Timestamp.Unix())
+			if messageTime > lastMessageTime {
+				lastMessageTime = messageTime
+			}
+		}
+
+		if hasMessages {
+			isMuted := false
+			isPinned := false
+			settings, setErr := client.Store.ChatSettings.GetChatSettings(chatJid)
+			if setErr != nil {
+				LOG_WARNING(fmt.Sprintf("Get chat settings failed %#v", setErr))
+			} else {
+				if settings.Found {
+					mutedUntil := settings.MutedUntil.Unix()
+					isMuted = (mutedUntil == -1) || (mutedUntil > time.Now().Unix())
+					isPinned = settings.Pinned
+				} else {
+					LOG_DEBUG(fmt.Sprintf("Chat settings not found %s", JidToStr(chatJid)))
+				}
+			}
+
+			LOG_TRACE(fmt.Sprintf("Call CWmNewChatsNotify %s %d %t %t", JidToStr(chatJid), len(syncMessages), isMuted, isPinned))
+			CWmNewChatsNotify(handler.connId, JidToStr(chatJid), isUnread, BoolToInt(isMuted), BoolToInt(isPinned), lastMessageTime)
+		} else {
+			LOG_TRACE(fmt.Sprintf("Skip CWmNewChatsNotify %s %d", JidToStr(chatJid), len(syncMessages)))
+		}
+
+	}
+
+	if historySync.Data.GetProgress() == 100 {
+		LOG_TRACE("Clear Syncing")
+		CWmClearStatus(FlagSyncing)
+	}
+}
+
+func (handler *WmEventHandler) HandleGroupInfo(groupInfo *events.GroupInfo) {
+	connId := handler.connId
+	client := GetClient(connId)
+	chatId := JidToStr(groupInfo.JID)
+
+	selfJid := *client.Store.ID
+	senderJidStr := ""
+	if (groupInfo.Sender != nil) && (JidToStr(*groupInfo.Sender) != JidToStr(groupInfo.JID)) {
+		senderJidStr = JidToStr(*groupInfo.Sender)
+	}
+
+	// text
+	text := ""
+	if groupInfo.Name != nil {
+		// Group name change
+		if senderJidStr == "" {
+			senderJidStr = JidToStr(groupInfo.JID)
+		}
+
+		groupName := *groupInfo.Name
+		text = "[Changed group name to " + groupName.Name + "]"
+	} else if len(groupInfo.Join) > 0 {
+		// Group member joined
+		if (len(groupInfo.Join) == 1) && ((senderJidStr == "") || (senderJidStr == JidToStr(groupInfo.Join[0]))) {
+			senderJidStr = JidToStr(groupInfo.Join[0])
+			text = "[Joined]"
+		} else {
+			if senderJidStr == "" {
+				senderJidStr = JidToStr(groupInfo.JID)
+			}
+
+			joined := ""
+			for _, jid := range groupInfo.Join {
+				if joined != "" {
+					joined += ", "
+				}
+
+				joined += GetContactName(connId, JidToStr(jid))
+			}
+
+			text = "[Added " + joined + "]"
+		}
+	} else if len(groupInfo.Leave) > 0 {
+		// Group member left
+		if (len(groupInfo.Leave) == 1) && ((senderJidStr == "") || (senderJidStr == JidToStr(groupInfo.Leave[0]))) {
+			senderJidStr = JidToStr(groupInfo.Leave[0])
+			text = "[Left]"
+		} else {
+			if senderJidStr == "" {
+				senderJidStr = JidToStr(groupInfo.JID)
+			}
+
+			left := ""
+			for _, jid := range groupInfo.Leave {
+				if left != "" {
+					left += ", "
+				}
+
+				left += GetContactName(connId, JidToStr(jid))
+			}
+
+			text = "[Removed " + left + "]"
+		}
+	}
+
+	if text == "" {
+		LOG_TRACE(fmt.Sprintf("HandleGroupInfo ignore"))
+		return
+	} else {
+		LOG_TRACE(fmt.Sprintf("HandleGroupInfo notify"))
+	}
+
+	// context
+	quotedId := ""
+
+	// file id, path and status
+	fileId := ""
+	filePath := ""
+	thumbPath := ""
+	fileStatus := FileStatusNone
+
+	// general
+	timeSent := int(groupInfo.Timestamp.Unix())
+	msgId := strconv.Itoa(timeSent) // group info updates do not have msg id
+	fromMe := (senderJidStr == JidToStr(selfJid))
+	senderId := senderJidStr
+	selfId := JidToStr(*client.Store.ID)
+	isSelfChat := (chatId == selfId)
+	isSyncRead := false
+	isRead := IsRead(isSyncRead, isSelfChat, fromMe, groupInfo.Timestamp, GetTimeRead(connId, chatId))
+
+	// reset typing if needed
+	UpdateTypingStatus(connId, chatId, senderId, fromMe, isSyncRead)
+
+	LOG_TRACE(fmt.Sprintf("Call CWmNewMessagesNotify %s: %s", chatId, text))
+	CWmNewMessagesNotify(connId, chatId, msgId, senderId, text, BoolToInt(fromMe), quotedId, fileId, filePath, thumbPath, fileStatus, timeSent, BoolToInt(isRead))
+}
+
+func (handler *WmEventHandler) HandleDeleteChat(deleteChat *events.DeleteChat) {
+	connId := handler.connId
+	chatId := deleteChat.JID.ToNonAD().String()
+
+	LOG_TRACE(fmt.Sprintf("Call CWmDeleteChatNotify %s", chatId))
+	CWmDeleteChatNotify(connId, chatId)
+}
+
+func (handler *WmEventHandler) HandleMute(mute *events.Mute) {
+	connId := handler.connId
+	chatId := mute.JID.ToNonAD().String()
+	muteAction := mute.Action
+	if muteAction == nil {
+		LOG_WARNING(fmt.Sprintf("mute event missing mute action"))
+		return
+	}
+
+	isMuted := *muteAction.Muted
+
+	LOG_TRACE(fmt.Sprintf("Call CWmUpdateMuteNotify %s %s", chatId, strconv.FormatBool(isMuted)))
+	CWmUpdateMuteNotify(connId, chatId, BoolToInt(isMuted))
+}
+
+func (handler *WmEventHandler) HandlePin(pin *events.Pin) {
+	connId := handler.connId
+	chatId := pin.JID.ToNonAD().String()
+	pinAction := pin.Action
+	if pinAction == nil {
+		LOG_WARNING(fmt.Sprintf("pin event missing pin action"))
+		return
+	}
+
+	isPinned := *pinAction.Pinned
+	timePinned := int(pin.Timestamp.Unix())
+
+	LOG_TRACE(fmt.Sprintf("Call CWmUpdatePinNotify %s %s %d", chatId, strconv.FormatBool(isPinned), timePinned))
+	CWmUpdatePinNotify(connId, chatId, BoolToInt(isPinned), timePinned)
+}
+
+func (handler *WmEventHandler) HandleClientOutdated() {
+	connId := handler.connId
+	LOG_WARNING(fmt.Sprintf("Client Outdated"))
+	message := GetClientOutdatedMessage()
+	SetConnState(connId, Outdated, message)
+	NotifyConnError(connId, message, false /*isReconnectable*/)
+}
+
+func (handler *WmEventHandler) HandleBlocklist(blocklist *events.Blocklist) {
+	connId := handler.connId
+
+	// modify action means the whole list should be re-requested
+	if blocklist.Action == events.BlocklistActionModify {
+		handler.GetBlocklist()
+		return
+	}
+
+	for _, change := range blocklist.Changes {
+		userId := JidToStr(change.JID.ToNonAD())
+		isBlocked := (change.Action == events.BlocklistChangeActionBlock)
+		SetBlocked(connId, userId, isBlocked)
+		NotifyContactBlocked(connId, userId)
+	}
+}
+
+func (handler *WmEventHandler) GetBlocklist() {
+	var client *whatsmeow.Client = GetClient(handler.connId)
+	LOG_TRACE(fmt.Sprintf("GetBlocklist"))
+
+	blocklist, err := client.GetBlocklist()
+	if err != nil {
+		LOG_WARNING(fmt.Sprintf("get blocklist failed %#v", err))
+		return
+	}
+
+	UpdateBlocklist(handler.connId, blocklist)
+}
+
+// blocklist fetch is shared between connected handling and contacts
+var blocklistTimeout = 30 * time.Second
+
+func (handler *WmEventHandler) FetchBlocklist() chan struct{} {
+	done := make(chan struct{})
+	mx.Lock()
+	blockFetch[handler.connId] = done
+	mx.Unlock()
+
+	go func() {
+		handler.GetBlocklist()
+		close(done)
+	}()
+
+	return done
+}
+
+func (handler *WmEventHandler) WaitBlocklist() {
+	mx.Lock()
+	done, ok := blockFetch[handler.connId]
+	mx.Unlock()
+
+	if !ok {
+		done = handler.FetchBlocklist()
+	}
+
+	select {
+	case <-done:
+	case <-time.After(blocklistTimeout):
+		LOG_WARNING(fmt.Sprintf("wait blocklist timeout"))
+	}
+}
+
+func UpdateBlocklist(connId int, blocklist *types.Blocklist) {
+	LOG_TRACE(fmt.Sprintf("blocklist %#v", blocklist))
+
+	// unblock users no longer present in list
+	isListed := make(map[string]bool)
+	for _, jid := range blocklist.JIDs {
+		isListed[JidToStr(jid.ToNonAD())] = true
+	}
+
+	for _, userId := range GetBlocked(connId) {
+		if !isListed[userId] {
+			SetBlocked(connId, userId, false)
+			NotifyContactBlocked(connId, userId)
+		}
+	}
+
+	// block users present in list
+	for userId := range isListed {
+		if IsBlocked(connId, userId) {
+			continue
+		}
+
+		SetBlocked(connId, userId, true)
+		NotifyContactBlocked(connId, userId)
+	}
+}
+
+func NotifyContactBlocked(connId int, userId string) {
+	// contacts not yet known to ui get their blocked state when first added
+	name := GetContactName(connId, userId)
+	if name == userId {
+		return
+	}
+
+	isBlocked := IsBlocked(connId, userId)
+	LOG_TRACE(fmt.Sprintf("Call CWmNewContactsNotify %s %s blocked %s", userId, name, strconv.FormatBool(isBlocked)))
+	CWmNewContactsNotify(connId, userId, name, PhoneFromUserId(userId), BoolToInt(false), BoolToInt(isBlocked))
+}
+
+func (handler *WmEventHandler) ResumeDownloads() {
+	connId := handler.connId
+	for _, download := range TakePendingDownloads(connId) {
+		LOG_DEBUG("resume download " + download.msgId)
+		WmDownloadFile(connId, download.chatId, download.msgId, download.fileId, "", 0, download.action)
+	}
+}
+
+func (handler *WmEventHandler) HandleMediaRetry(mediaRetry *events.MediaRetry) {
+	connId := handler.connId
+	retryChan := GetMediaRetry(connId, JidToStr(mediaRetry.ChatID.ToNonAD()), mediaRetry.MessageID)
+	if retryChan == nil {
+		LOG_TRACE(fmt.Sprintf("media retry not requested %s", mediaRetry.MessageID))
+		return
+	}
+
+	select {
+	case retryChan <- mediaRetry:
+	default:
+		LOG_TRACE(fmt.Sprintf("media retry already received %s", mediaRetry.MessageID))
+	}
+}
+
+func (handler *WmEventHandler) HandlePicture(picture *events.Picture) {
+	connId := handler.connId
+	chatId := JidToStr(picture.JID.ToNonAD())
+
+	if picture.Remove {
+		RemoveProfilePicture(connId, chatId)
+		NotifyProfilePicture(connId, chatId, "")
+		return
+	}
+
+	// only refresh pictures previously requested
+	existingId := GetCachedPictureId(connId, chatId)
+	if (len(existingId) == 0) || (existingId == picture.PictureID) {
+		LOG_TRACE(fmt.Sprintf("profile picture refresh skip %s", chatId))
+		return
+	}
+
+	filePath, err := DownloadProfilePicture(connId, chatId)
+	if err != nil {
+		LOG_WARNING(fmt.Sprintf("profile picture refresh error %#v", err))
+		return
+	}
+
+	NotifyProfilePicture(connId, chatId, filePath)
+}
+
+func NotifyProfilePicture(connId int, chatId string, filePath string) {
+	LOG_TRACE(fmt.Sprintf("Call CWmNewProfilePictureNotify %s %s", chatId, filePath))
+	CWmNewProfilePictureNotify(connId, chatId, filePath)
+
+	// own picture is also part of self profile
+	client := GetClient(connId)
+	if (client.Store.ID != nil) && (chatId == JidToStr(client.Store.ID.ToNonAD())) {
+		LOG_TRACE(fmt.Sprintf("Call CWmUpdateSelfProfileNotify picture %s", filePath))
+		CWmUpdateSelfProfileNotify(connId, ProfileKeyPicture, filePath)
+	}
+}
+
+func (handler *WmEventHandler) HandlePrivacySettings(privacySettings *events.PrivacySettings) {
+	connId := handler.connId
+	settings := privacySettings.NewSettings
+
+	if privacySettings.GroupAddChanged {
+		NotifyPrivacySetting(connId, types.PrivacySettingTypeGroupAdd, settings.GroupAdd)
+	}
+
+	if privacySettings.LastSeenChanged {
+		NotifyPrivacySetting(connId, types.PrivacySettingTypeLastSeen, settings.LastSeen)
+	}
+
+	if privacySettings.StatusChanged {
+		NotifyPrivacySetting(connId, types.PrivacySettingTypeStatus, settings.Status)
+	}
+
+	if privacySettings.ProfileChanged {
+		NotifyPrivacySetting(connId, types.PrivacySettingTypeProfile, settings.Profile)
+	}
+
+	if privacySettings.ReadReceiptsChanged {
+		NotifyPrivacySetting(connId, types.PrivacySettingTypeReadReceipts, settings.ReadReceipts)
+	}
+
+	if privacySettings.OnlineChanged {
+		NotifyPrivacySetting(connId, types.PrivacySettingTypeOnline, settings.Online)
+	}
+
+	if privacySettings.CallAddChanged {
+		NotifyPrivacySetting(connId, types.PrivacySettingTypeCallAdd, settings.CallAdd)
+	}
+}
+
+func NotifyPrivacySettings(connId int, settings *types.PrivacySettings) {
+	NotifyPrivacySetting(connId, types.PrivacySettingTypeGroupAdd, settings.GroupAdd)
+	NotifyPrivacySetting(connId, types.PrivacySettingTypeLastSeen, settings.LastSeen)
+	NotifyPrivacySetting(connId, types.PrivacySettingTypeStatus, settings.Status)
+	NotifyPrivacySetting(connId, types.PrivacySettingTypeProfile, settings.Profile)
+	NotifyPrivacySetting(connId, types.PrivacySettingTypeReadReceipts, settings.ReadReceipts)
+	NotifyPrivacySetting(connId, types.PrivacySettingTypeOnline, settings.Online)
+	NotifyPrivacySetting(connId, types.PrivacySettingTypeCallAdd, settings.CallAdd)
+}
+
+func NotifyPrivacySetting(connId int, name types.PrivacySettingType, value types.PrivacySetting) {
+	LOG_TRACE(fmt.Sprintf("Call CWmUpdatePrivacySettingNotify %s %s", string(name), string(value)))
+	CWmUpdatePrivacySettingNotify(connId, string(name), string(value))
+}
+
+func IsValidPrivacySetting(name types.PrivacySettingType, value types.PrivacySetting) bool {
+	switch name {
+	case types.PrivacySettingTypeGroupAdd, types.PrivacySettingTypeLastSeen, types.PrivacySettingTypeStatus,
+		types.PrivacySettingTypeProfile:
+		return (value == types.PrivacySettingAll) || (value == types.PrivacySettingContacts) ||
+			(value == types.PrivacySettingContactBlacklist) || (value == types.PrivacySettingNone)
+
+	case types.PrivacySettingTypeReadReceipts:
+		return (value == types.PrivacySettingAll) || (value == types.PrivacySettingNone)
+
+	case types.PrivacySettingTypeOnline:
+		return (value == types.PrivacySettingAll) || (value == types.PrivacySettingMatchLastSeen)
+
+	case types.PrivacySettingTypeCallAdd:
+		return (value == types.PrivacySettingAll) || (value == types.PrivacySettingKnown)
+
+	default:
+		return false
+	}
+}
+
+func (handler *WmEventHandler) HandleLoggedOut() {
+	LOG_INFO("logged out by server, reinit")
+	connId := handler.connId
+
+	LOG_TRACE(fmt.Sprintf("Call CWmReinit"))
+	CWmReinit(connId)
+}
+
+func GetNameFromContactInfo(contactInfo types.ContactInfo) string {
+	if len(contactInfo.FullName) > 0 {
+		return contactInfo.FullName
+	}
+
+	if len(contactInfo.FirstName) > 0 {
+		return contactInfo.FirstName
+	}
+
+	if len(contactInfo.PushName) > 0 {
+		return contactInfo.PushName
+	}
+
+	if len(contactInfo.BusinessName) > 0 {
+		return contactInfo.BusinessName
+	}
+
+	return ""
+}
+
+func PhoneFromUserId(userId string) string {
+	phone := ""
+	if strings.HasSuffix(userId, "@s.whatsapp.net") {
+		phone = strings.Replace(userId, "@s.whatsapp.net", "", 1)
+	}
+
+	LOG_TRACE(fmt.Sprintf("user %s phone %s", userId, phone))
+	return phone
+}
+
+func FormatBusinessHours(businessHours []types.BusinessHoursConfig) string {
+	minutesToTime := func(minutes string) string {
+		num := StringToInt(minutes)
+		return fmt.Sprintf("%02d:%02d", num/60, num%60)
+	}
+
+	var hours []string
+	for _, config := range businessHours {
+		if config.Mode == "specific_hours" {
+			hours = append(hours, fmt.Sprintf("%s %s-%s", config.DayOfWeek,
+				minutesToTime(config.OpenTime), minutesToTime(config.CloseTime)))
+		} else {
+			hours = append(hours, fmt.Sprintf("%s %s", config.DayOfWeek, config.Mode))
+		}
+	}
+
+	return strings.Join(hours, ", ")
+}
+
+func NormalizePhone(phone string) string {
+	// strip formatting characters
+	phone = strings.TrimSpace(phone)
+	phone = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "", "/", "").Replace(phone)
+
+	// international prefix
+	if strings.HasPrefix(phone, "00") {
+		phone = "+" + strings.TrimPrefix(phone, "00")
+	} else if !strings.HasPrefix(phone, "+") {
+		phone = "+" + phone
+	}
+
+	// e.164 allows up to 15 digits
+	digits := strings.TrimPrefix(phone, "+")
+	if (len(digits) < 7) || (len(digits) > 15) || (digits[0] == '0') {
+		return ""
+	}
+
+	for _, ch := range digits {
+		if (ch < '0') || (ch > '9') {
+			return ""
+		}
+	}
+
+	return phone
+}
+
+func AddUnknownContact(connId int, userId string, name string) {
+	if GetContactName(connId, userId) != userId {
+		return
+	}
+
+	LOG_TRACE(fmt.Sprintf("Call CWmNewContactsNotify %s %s", userId, name))
+	CWmNewContactsNotify(connId, userId, name, PhoneFromUserId(userId), BoolToInt(false), BoolToInt(IsBlocked(connId, userId)))
+	AddContactName(connId, userId, name)
+}
+
+func (handler *WmEventHandler) GetContacts() {
+	var client *whatsmeow.Client = GetClient(handler.connId)
+	connId := handler.connId
+	LOG_TRACE(fmt.Sprintf("GetContacts"))
+
+	CWmSetStatus(FlagFetching)
+
+	// blocked state is sent along with contacts
+	handler.WaitBlocklist()
+
+	// contacts
+	contacts, contErr := client.Store.Contacts.GetAllContacts()
+	if contErr != nil {
+		LOG_WARNING(fmt.Sprintf("get all contacts failed %#v", contErr))
+	} else {
+		LOG_TRACE(fmt.Sprintf("contacts %#v", contacts))
+		for jid, contactInfo := range contacts {
+			name := GetNameFromContactInfo(contactInfo)
+			if len(name) > 0 {
+				userId := JidToStr(jid)
+				phone := PhoneFromUserId(userId)
+				isBlocked := IsBlocked(connId, userId)
+				LOG_TRACE(fmt.Sprintf("Call CWmNewContactsNotify %s %s", userId, name))
+				CWmNewContactsNotify(connId, userId, name, phone, BoolToInt(false), BoolToInt(isBlocked))
+				AddContactName(connId, userId, name)
+			} else {
+				LOG_WARNING(fmt.Sprintf("Skip CWmNewContactsNotify %s %#v", JidToStr(jid), contactInfo))
+			}
+		}
+	}
+
+	// special handling for self
+	selfId := JidToStr(*client.Store.ID)
+	selfName := "" // overridden by ui
+	selfPhone := PhoneFromUserId(selfId)
+	LOG_TRACE(fmt.Sprintf("Call CWmNewContactsNotify %s %s", selfId, selfName))
+	CWmNewContactsNotify(connId, selfId, selfName, selfPhone, BoolToInt(true), BoolToInt(false))
+	AddContactName(connId, selfId, selfName)
+
+	// special handling for official whatsapp account
+	whatsappId := "0@s.whatsapp.net"
+	whatsappName := "WhatsApp"
+	whatsappPhone := ""
+	LOG_TRACE(fmt.Sprintf("Call CWmNewContactsNotify %s %s", whatsappId, whatsappName))
+	CWmNewContactsNotify(connId, whatsappId, whatsappName, whatsappPhone, BoolToInt(false), BoolToInt(false))
+	AddContactName(connId, whatsappId, whatsappName)
+
+	// special handling for status updates
+	statusId := "status@broadcast"
+	statusName := "Status Updates"
+	statusPhone := ""
+	LOG_TRACE(fmt.Sprintf("Call CWmNewContactsNotify %s %s", statusId, statusName))
+	CWmNewContactsNotify(connId, statusId, statusName, statusPhone, BoolToInt(false), BoolToInt(false))
+	AddContactName(connId, statusId, statusName)
+
+	// groups
+	groups, groupErr := client.GetJoinedGroups()
+	if groupErr != nil {
+		LOG_WARNING(fmt.Sprintf("get joined groups failed %#v", groupErr))
+	} else {
+		LOG_TRACE(fmt.Sprintf("groups %#v", groups))
+		for _, group := range groups {
+			groupId := JidToStr(group.JID)
+			groupName := group.GroupName.Name
+			groupPhone := ""
+			LOG_TRACE(fmt.Sprintf("Call CWmNewContactsNotify %s %s", groupId, groupName))
+			CWmNewContactsNotify(connId, groupId, groupName, groupPhone, BoolToInt(false), BoolToInt(false))
+			AddContactName(connId, groupId, groupName)
+		}
+	}
+
+	CWmClearStatus(FlagFetching)
+}
+
+func (handler *WmEventHandler) HandleMessage(messageInfo types.MessageInfo, msg *waE2E.Message, isSyncRead bool, isHistorySync bool) {
+	// keep message content for quoting in replies and forwarding
+	if (msg.ReactionMessage == nil) && (msg.EncReactionMessage == nil) && (msg.ProtocolMessage == nil) {
+		chatId := GetChatId(messageInfo.Chat, messageInfo.Sender)
+		AddRecentMessage(handler.connId, chatId, messageInfo, msg)
+	}
+
+	switch {
+	case msg.Conversation != nil || msg.ExtendedTextMessage != nil:
+		handler.HandleTextMessage(messageInfo, msg, isSyncRead)
+
+	case msg.ImageMessage != nil:
+		handler.HandleImageMessage(messageInfo, msg, isSyncRead, isHistorySync)
+
+	case msg.VideoMessage != nil:
+		handler.HandleVideoMessage(messageInfo, msg, isSyncRead, isHistorySync)
+
+	case msg.AudioMessage != nil:
+		handler.HandleAudioMessage(messageInfo, msg, isSyncRead)
+
+	case msg.DocumentMessage != nil:
+		handler.HandleDocumentMessage(messageInfo, msg, isSyncRead)
+
+	case msg.StickerMessage != nil:
+		handler.HandleStickerMessage(messageInfo, msg, isSyncRead)
+
+	case msg.TemplateMessage != nil:
+		handler.HandleTemplateMessage(messageInfo, msg, isSyncRead)
+
+	case msg.ReactionMessage != nil:
+		handler.HandleReactionMessage(messageInfo, msg, isSyncRead)
+
+	case msg.EncReactionMessage != nil:
+		handler.HandleEncReactionMessage(messageInfo, msg, isSyncRead)
+
+	case msg.ProtocolMessage != nil:
+		handler.HandleProtocolMessage(messageInfo, msg, isSyncRead)
+
+	default:
+		handler.HandleUnsupportedMessage(messageInfo, msg, isSyncRead)
+	}
+}
+
+func GetMessageText(msg *waE2E.Message) string {
+	switch {
+	case msg.Conversation != nil:
+		return msg.GetConversation()
+	case msg.ExtendedTextMessage != nil:
+		return msg.ExtendedTextMessage.GetText()
+	case msg.ImageMessage != nil:
+		return msg.ImageMessage.GetCaption()
+	case msg.VideoMessage != nil:
+		return msg.VideoMessage.GetCaption()
+	case msg.DocumentMessage != nil:
+		return msg.DocumentMessage.GetCaption()
+	default:
+		return ""
+	}
+}
+
+func GetMessageContextInfo(msg *waE2E.Message) *waE2E.ContextInfo {
+	switch {
+	case msg.ExtendedTextMessage != nil:
+		return msg.ExtendedTextMessage.GetContextInfo()
+	case msg.ImageMessage != nil:
+		return msg.ImageMessage.GetContextInfo()
+	case msg.VideoMessage != nil:
+		return msg.VideoMessage.GetContextInfo()
+	case msg.AudioMessage != nil:
+		return msg.AudioMessage.GetContextInfo()
+	case msg.DocumentMessage != nil:
+		return msg.DocumentMessage.GetContextInfo()
+	case msg.StickerMessage != nil:
+		return msg.StickerMessage.GetContextInfo()
+	}
+
+	return nil
+}
+
+func SetMessageContextInfo(msg *waE2E.Message, contextInfo *waE2E.ContextInfo) bool {
+	switch {
+	case msg.ExtendedTextMessage != nil:
+		msg.ExtendedTextMessage.ContextInfo = contextInfo
+	case msg.ImageMessage != nil:
+		msg.ImageMessage.ContextInfo = contextInfo
+	case msg.VideoMessage != nil:
+		msg.VideoMessage.ContextInfo = contextInfo
+	case msg.AudioMessage != nil:
+		msg.AudioMessage.ContextInfo = contextInfo
+	case msg.DocumentMessage != nil:
+		msg.DocumentMessage.ContextInfo = contextInfo
+	case msg.StickerMessage != nil:
+		msg.StickerMessage.ContextInfo = contextInfo
+	default:
+		return false
+	}
+
+	return true
+}
+
+func ToQuotedMessage(msg *waE2E.Message) *waE2E.Message {
+	quoted := proto.Clone(msg).(*waE2E.Message)
+
+	// drop context, to not nest quotes of quotes
+	quoted.MessageContextInfo = nil
+	SetMessageContextInfo(quoted, nil)
+
+	return quoted
+}
+
+// rebuilds a message from the media references stored in its file id, or from its text if
+// it has no media, for forwarding messages no longer present in the recent message cache
+// original file name, or target path without the message id prefix for older file ids
+func GetDownloadInfoFileName(info DownloadInfo) string {
+	if len(info.FileName) > 0 {
+		return info.FileName
+	}
+
+	return strings.TrimPrefix(filepath.Base(info.TargetPath), info.MsgId+"-")
+}
+
+func FileIdToMessage(connId int, msgId string, fileId string, fileType string, text string) *waE2E.Message {
+	waText := MarkdownToWaText(connId, text)
+	if len(fileId) == 0 {
+		if len(text) == 0 {
+			return nil
+		}
+
+		return &waE2E.Message{
+			ExtendedTextMessage: &waE2E.ExtendedTextMessage{Text: &waText},
+		}
+	}
+
+	var info DownloadInfo
+	if err := json.Unmarshal([]byte(fileId), &info); err != nil {
+		LOG_WARNING(fmt.Sprintf("json decode failed %#v", err))
+		return nil
+	}
+
+	// older file ids do not hold message id
+	if len(info.MsgId) == 0 {
+		info.MsgId = msgId
+	}
+
+	// messages require direct path, which is part of the url when not stored separately
+	directPath := info.DirectPath
+	if (len(directPath) == 0) && (len(info.Url) > 0) {
+		if parsedUrl, err := url.Parse(info.Url); err == nil {
+			directPath = parsedUrl.RequestURI()
+		}
+	}
+
+	if (len(info.MediaKey) == 0) || (len(directPath) == 0) {
+		LOG_WARNING("media key or path not present")
+		return nil
+	}
+
+	var caption *string
+	if len(waText) > 0 {
+		caption = &waText
+	}
+
+	var mediaUrl *string
+	if len(info.Url) > 0 {
+		mediaUrl = proto.String(info.Url)
+	}
+
+	// optional fields of the original message, not present in older file ids
+	var width, height, seconds *uint32
+	if (info.Width > 0) && (info.Height > 0) {
+		width = proto.Uint32(info.Width)
+		height = proto.Uint32(info.Height)
+	}
+
+	if info.Seconds > 0 {
+		seconds = proto.Uint32(info.Seconds)
+	}
+
+	var thumbnail []byte
+	if thumbPath := GetCachedThumbnail(connId, info.MsgId); filepath.Ext(thumbPath) == ".jpg" {
+		thumbnail, _ = os.ReadFile(thumbPath)
+	}
+
+	fileLength := proto.Uint64(uint64(info.Size))
+	switch info.MediaType {
+	case whatsmeow.MediaImage:
+		return &waE2E.Message{ImageMessage: &waE2E.ImageMessage{
+			URL:           mediaUrl,
+			DirectPath:    &directPath,
+			MediaKey:      info.MediaKey,
+			Mimetype:      proto.String(fileType),
+			FileEncSHA256: info.FileEncSha256,
+			FileSHA256:    info.FileSha256,
+			FileLength:    fileLength,
+			Caption:       caption,
+			Width:         width,
+			Height:        height,
+			JPEGThumbnail: thumbnail,
+		}}
+
+	case whatsmeow.MediaVideo:
+		return &waE2E.Message{VideoMessage: &waE2E.VideoMessage{
+			URL:           mediaUrl,
+			DirectPath:    &directPath,
+			MediaKey:      info.MediaKey,
+			Mimetype:      proto.String(fileType),
+			FileEncSHA256: info.FileEncSha256,
+			FileSHA256:    info.FileSha256,
+			FileLength:    fileLength,
+			Caption:       caption,
+			Width:         width,
+			Height:        height,
+			Seconds:       seconds,
+			JPEGThumbnail: thumbnail,
+		}}
+
+	case whatsmeow.MediaAudio:
+		return &waE2E.Message{AudioMessage: &waE2E.AudioMessage{
+			URL:           mediaUrl,
+			DirectPath:    &directPath,
+			MediaKey:      info.MediaKey,
+			Mimetype:      proto.String(fileType),
+			FileEncSHA256: info.FileEncSha256,
+			FileSHA256:    info.FileSha256,
+			FileLength:    fileLength,
+			PTT:           proto.Bool(info.IsVoiceNote),
+			Seconds:       seconds,
+		}}
+
+	case whatsmeow.MediaDocument:
+		return &waE2E.Message{DocumentMessage: &waE2E.DocumentMessage{
+			URL:           mediaUrl,
+			DirectPath:    &directPath,
+			MediaKey:      info.MediaKey,
+			Mimetype:      proto.String(fileType),
+			FileEncSHA256: info.FileEncSha256,
+			FileSHA256:    info.FileSha256,
+			FileLength:    fileLength,
+			Caption:       caption,
+			FileName:      proto.String(GetDownloadInfoFileName(info)),
+			JPEGThumbnail: thumbnail,
+		}}
+
+	default:
+		LOG_WARNING(fmt.Sprintf("unsupported media type %s", info.MediaType))
+		return nil
+	}
+}
+
+func ToForwardedMessage(msg *waE2E.Message) *waE2E.Message {
+	forwarded := proto.Clone(msg).(*waE2E.Message)
+	forwarded.MessageContextInfo = nil
+
+	// plain text cannot hold context info, convert to extended text
+	if forwarded.Conversation != nil {
+		forwarded.ExtendedTextMessage = &waE2E.ExtendedTextMessage{
+			Text: forwarded.Conversation,
+		}
+		forwarded.Conversation = nil
+	}
+
+	// keep media keys and paths, only replace context
+	score := GetMessageContextInfo(msg).GetForwardingScore() + 1
+	contextInfo := waE2E.ContextInfo{
+		IsForwarded:     proto.Bool(true),
+		ForwardingScore: proto.Uint32(score),
+	}
+
+	if !SetMessageContextInfo(forwarded, &contextInfo) {
+		return nil
+	}
+
+	return forwarded
+}
+
+func (handler *WmEventHandler) HandleMessageLinks(messageInfo types.MessageInfo, msg *waE2E.Message) {
+	// only resolve links in incoming text messages
+	if messageInfo.IsFromMe {
+		return
+	}
+
+	text := msg.GetConversation()
+	if msg.GetExtendedTextMessage() != nil {
+		text = msg.GetExtendedTextMessage().GetText()
+	}
+
+	if !waLinkRegexp.MatchString(text) {
+		return
+	}
+
+	chatId := GetChatId(messageInfo.Chat, messageInfo.Sender)
+	ResolveWaLinks(handler.connId, chatId, messageInfo.ID, text)
+}
+
+func (handler *WmEventHandler) HandleTextMessage(messageInfo types.MessageInfo, msg *waE2E.Message, isSyncRead bool) {
+	LOG_TRACE(fmt.Sprintf("TextMessage"))
+
+	connId := handler.connId
+	var client *whatsmeow.Client = GetClient(handler.connId)
+	text := ""
+
+	// text
+	quotedId := ""
+	if msg.GetExtendedTextMessage() == nil {
+		text = msg.GetConversation()
+	} else {
+		text = msg.GetExtendedTextMessage().GetText()
+		ci := msg.GetExtendedTextMessage().GetContextInfo()
+		if ci != nil {
+			quotedId = ci.GetStanzaId()
+		}
+	}
+
+	text = WaTextToMarkdown(connId, text)
+
+	// file id, path and status
+	fileId := ""
+	filePath := ""
+	thumbPath := ""
+	fileStatus := FileStatusNone
+
+	// general
+	chatId := GetChatId(messageInfo.Chat, messageInfo.Sender)
+	msgId := messageInfo.ID
+	fromMe := messageInfo.IsFromMe
+	senderId := JidToStr(messageInfo.Sender)
+	selfId := JidToStr(*client.Store.ID)
+	isSelfChat := (chatId == selfId)
+	timeSent := int(messageInfo.Timestamp.Unix())
+	isRead := IsRead(isSyncRead, isSelfChat, fromMe, messageInfo.Timestamp, GetTimeRead(connId, chatId))
+
+	// reset typing if needed
+	UpdateTypingStatus(connId, chatId, senderId, fromMe, isSyncRead)
+
+	LOG_TRACE(fmt.Sprintf("Call CWmNewMessagesNotify %s: %s", chatId, text))
+	CWmNewMessagesNotify(connId, chatId, msgId, senderId, text, BoolToInt(fromMe), quotedId, fileId, filePath, thumbPath, fileStatus, timeSent, BoolToInt(isRead))
+}
+
+func (handler *WmEventHandler) HandleImageMessage(messageInfo types.MessageInfo, msg *waE2E.Message, isSyncRead bool, isHistorySync bool) {
+	LOG_TRACE(fmt.Sprintf("ImageMessage"))
+
+	connId := handler.connId
+	var client *whatsmeow.Client = GetClient(handler.connId)
+
+	// get image part
+	img := msg.GetImageMessage()
+	if img == nil {
+		LOG_WARNING(fmt.Sprintf("get image message failed"))
+		return
+	}
+
+	// get extension
+	ext := "jpg"
+	exts, extErr := mime.ExtensionsByType(img.GetMimetype())
+	if extErr != nil && len(exts) > 0 {
+		ext = exts[0]
+	}
+
+	// text
+	text := WaTextToMarkdown(connId, img.GetCaption())
+
+	// context
+	quotedId := ""
+	ci := img.GetContextInfo()
+	if ci != nil {
+		quotedId = ci.GetStanzaId()
+	}
+
+	// file id, path and status
+	var tmpPath string = GetPath(connId) + "/tmp"
+	filePath := fmt.Sprintf("%s/%s.%s", tmpPath, messageInfo.ID, ext)
+	fileId := DownloadableMessageToFileId(client, img, messageInfo, filePath)
+	thumbPath := GetMessageThumbnail(connId, messageInfo.ID, img)
+	fileStatus := FileStatusNotDownloaded
+
+	// general
+	chatId := GetChatId(messageInfo.Chat, messageInfo.Sender)
+	msgId := messageInfo.ID
+	fromMe := messageInfo.IsFromMe
+	senderId := JidToStr(messageInfo.Sender)
+	selfId := JidToStr(*client.Store.ID)
+	isSelfChat := (chatId == selfId)
+	timeSent := int(messageInfo.Timestamp.Unix())
+	isRead := IsRead(isSyncRead, isSelfChat, fromMe, messageInfo.Timestamp, GetTimeRead(connId, chatId))
+
+	// reset typing if needed
+	UpdateTypingStatus(connId, chatId, senderId, fromMe, isSyncRead)
+
+	LOG_TRACE(fmt.Sprintf("Call CWmNewMessagesNotify %s: image", chatId))
+	CWmNewMessagesNotify(connId, chatId, msgId, senderId, text, BoolToInt(fromMe), quotedId, fileId, filePath, thumbPath, fileStatus, timeSent, BoolToInt(isRead))
+
+	if len(thumbPath) == 0 {
+		FetchMessageThumbnail(connId, chatId, msgId, fileId, filePath, img, whatsmeow.MediaImage, isHistorySync)
+	}
+}
+
+func (handler *WmEventHandler) HandleVideoMessage(messageInfo types.MessageInfo, msg *waE2E.Message, isSyncRead bool, isHistorySync bool) {
+	LOG_TRACE(fmt.Sprintf("VideoMessage"))
+
+	connId := handler.connId
+	var client *whatsmeow.Client = GetClient(handler.connId)
+
+	// get video part
+	vid := msg.GetVideoMessage()
+	if vid == nil {
+		LOG_WARNING(fmt.Sprintf("get video message failed"))
+		return
+	}
+
+	// get extension
+	ext := "mp4"
+	exts, extErr := mime.ExtensionsByType(vid.GetMimetype())
+	if extErr != nil && len(exts) > 0 {
+		ext = exts[0]
+	}
+
+	// text
+	text := WaTextToMarkdown(connId, vid.GetCaption())
+
+	// context
+	quotedId := ""
+	ci := vid.GetContextInfo()
+	if ci != nil {
+		quotedId = ci.GetStanzaId()
+	}
+
+	// file id, path and status
+	var tmpPath string = GetPath(connId) + "/tmp"
+	filePath := fmt.Sprintf("%s/%s.%s", tmpPath, messageInfo.ID, ext)
+	fileId := DownloadableMessageToFileId(client, vid, messageInfo, filePath)
+	thumbPath := GetMessageThumbnail(connId, messageInfo.ID, vid)
+	fileStatus := FileStatusNotDownloaded
+
+	// general
+	chatId := GetChatId(messageInfo.Chat, messageInfo.Sender)
+	msgId := messageInfo.ID
+	fromMe := messageInfo.IsFromMe
+	senderId := JidToStr(messageInfo.Sender)
+	selfId := JidToStr(*client.Store.ID)
+	isSelfChat := (chatId == selfId)
+	timeSent := int(messageInfo.Timestamp.Unix())
+	isRead := IsRead(isSyncRead, isSelfChat, fromMe, messageInfo.Timestamp, GetTimeRead(connId, chatId))
+
+	// reset typing if needed
+	UpdateTypingStatus(connId, chatId, senderId, fromMe, isSyncRead)
+
+	LOG_TRACE(fmt.Sprintf("Call CWmNewMessagesNotify %s: video", chatId))
+	CWmNewMessagesNotify(connId, chatId, msgId, senderId, text, BoolToInt(fromMe), quotedId, fileId, filePath, thumbPath, fileStatus, timeSent, BoolToInt(isRead))
+
+	if len(thumbPath) == 0 {
+		FetchMessageThumbnail(connId, chatId, msgId, fileId, filePath, vid, whatsmeow.MediaVideo, isHistorySync)
+	}
+}
+
+func (handler *WmEventHandler) HandleAudioMessage(messageInfo types.MessageInfo, msg *waE2E.Message, isSyncRead bool) {
+	LOG_TRACE(fmt.Sprintf("AudioMessage"))
+
+	connId := handler.connId
+	var client *whatsmeow.Client = GetClient(handler.connId)
+
+	// get audio part
+	aud := msg.GetAudioMessage()
+	if aud == nil {
+		LOG_WARNING(fmt.Sprintf("get audio message failed"))
+		return
+	}
+
+	// get extension
+	ext := "ogg"
+	exts, extErr := mime.ExtensionsByType(aud.GetMimetype())
+	if extErr != nil && len(exts) > 0 {
+		ext = exts[0]
+	}
+
+	// text
+	text := ""
+	if aud.GetPTT() {
+		text = "[Voice Message " + FormatDuration(aud.GetSeconds()) + "]"
+	} else if aud.GetSeconds() > 0 {
+		text = "[Audio " + FormatDuration(aud.GetSeconds()) + "]"
+	}
+
+	// context
+	quotedId := ""
+	ci := aud.GetContextInfo()
+	if ci != nil {
+		quotedId = ci.GetStanzaId()
+	}
+
+	// file id, path and status
+	var tmpPath string = GetPath(connId) + "/tmp"
+	filePath := fmt.Sprintf("%s/%s.%s", tmpPath, messageInfo.ID, ext)
+	fileId := DownloadableMessageToFileId(client, aud, messageInfo, filePath)
+	thumbPath := ""
+	fileStatus := FileStatusNotDownloaded
+
+	// general
+	chatId := GetChatId(messageInfo.Chat, messageInfo.Sender)
+	msgId := messageInfo.ID
+	fromMe := messageInfo.IsFromMe
+	senderId := JidToStr(messageInfo.Sender)
+	selfId := JidToStr(*client.Store.ID)
+	isSelfChat := (chatId == selfId)
+	timeSent := int(messageInfo.Timestamp.Unix())
+	isRead := IsRead(isSyncRead, isSelfChat, fromMe, messageInfo.Timestamp, GetTimeRead(connId, chatId))
+
+	// reset typing if needed
+	UpdateTypingStatus(connId, chatId, senderId, fromMe, isSyncRead)
+
+	LOG_TRACE(fmt.Sprintf("Call CWmNewMessagesNotify %s: audio", chatId))
+	CWmNewMessagesNotify(connId, chatId, msgId, senderId, text, BoolToInt(fromMe), quotedId, fileId, filePath, thumbPath, fileStatus, timeSent, BoolToInt(isRead))
+}
+
+func (handler *WmEventHandler) HandleDocumentMessage(messageInfo types.MessageInfo, msg *waE2E.Message, isSyncRead bool) {
+	LOG_TRACE(fmt.Sprintf("DocumentMessage"))
+
+	connId := handler.connId
+	var client *whatsmeow.Client = GetClient(handler.connId)
+
+	// get doc part
+	doc := msg.GetDocumentMessage()
+	if doc == nil {
+		LOG_WARNING(fmt.Sprintf("get document message failed"))
+		return
+	}
+
+	// text
+	text := WaTextToMarkdown(connId, doc.GetCaption())
+
+	// context
+	quotedId := ""
+	ci := doc.GetContextInfo()
+	if ci != nil {
+		quotedId = ci.GetStanzaId()
+	}
+
+	// file id, path and status
+	var tmpPath string = GetPath(connId) + "/tmp"
+	filePath := fmt.Sprintf("%s/%s-%s", tmpPath, messageInfo.ID, *doc.FileName)
+	fileId := DownloadableMessageToFileId(client, doc, messageInfo, filePath)
+	thumbPath := ""
+	fileStatus := FileStatusNotDownloaded
+
+	// general
+	chatId := GetChatId(messageInfo.Chat, messageInfo.Sender)
+	msgId := messageInfo.ID
+	fromMe := messageInfo.IsFromMe
+	senderId := JidToStr(messageInfo.Sender)
+	selfId := JidToStr(*client.Store.ID)
+	isSelfChat := (chatId == selfId)
+	timeSent := int(messageInfo.Timestamp.Unix())
+	isRead := IsRead(isSyncRead, isSelfChat, fromMe, messageInfo.Timestamp, GetTimeRead(connId, chatId))
+
+	// reset typing if needed
+	UpdateTypingStatus(connId, chatId, senderId, fromMe, isSyncRead)
+
+	LOG_TRACE(fmt.Sprintf("Call CWmNewMessagesNotify %s: document", chatId))
+	CWmNewMessagesNotify(connId, chatId, msgId, senderId, text, BoolToInt(fromMe), quotedId, fileId, filePath, thumbPath, fileStatus, timeSent, BoolToInt(isRead))
+}
+
+func (handler *WmEventHandler) HandleStickerMessage(messageInfo types.MessageInfo, msg *waE2E.Message, isSyncRead bool) {
+	LOG_TRACE(fmt.Sprintf("StickerMessage"))
+
+	connId := handler.connId
+	var client *whatsmeow.Client = GetClient(handler.connId)
+
+	// get sticker part
+	sticker := msg.GetStickerMessage()
+	if sticker == nil {
+		LOG_WARNING(fmt.Sprintf("get sticker message failed"))
+		return
+	}
+
+	// get extension
+	ext := "webp"
+	exts, extErr := mime.ExtensionsByType(sticker.GetMimetype())
+	if extErr != nil && len(exts) > 0 {
+		ext = exts[0]
+	}
+
+	// text
+	text := "[Sticker]"
+	if sticker.GetIsAnimated() {
+		text = "[Animated Sticker]"
+	}
+
+	// context
+	quotedId := ""
+	ci := sticker.GetContextInfo()
+	if ci != nil {
+		quotedId = ci.GetStanzaId()
+	}
+
+	// file id, path and status
+	var tmpPath string = GetPath(connId) + "/tmp"
+	filePath := fmt.Sprintf("%s/%s.%s", tmpPath, messageInfo.ID, ext)
+	fileId := DownloadableMessageToFileId(client, sticker, messageInfo, filePath)
+	thumbPath := SaveThumbnail(connId, messageInfo.ID, "png", sticker.GetPngThumbnail())
+	fileStatus := FileStatusNotDownloaded
+
+	// general
+	chatId := GetChatId(messageInfo.Chat, messageInfo.Sender)
+	msgId := messageInfo.ID
+	fromMe := messageInfo.IsFromMe
+	senderId := JidToStr(messageInfo.Sender)
+	selfId := JidToStr(*client.Store.ID)
+	isSelfChat := (chatId == selfId)
+	timeSent := int(messageInfo.Timestamp.Unix())
+	isRead := IsRead(isSyncRead, isSelfChat, fromMe, messageInfo.Timestamp, GetTimeRead(connId, chatId))
+
+	// reset typing if needed
+	UpdateTypingStatus(connId, chatId, senderId, fromMe, isSyncRead)
+
+	LOG_TRACE(fmt.Sprintf("Call CWmNewMessagesNotify %s: sticker", chatId))
+	CWmNewMessagesNotify(connId, chatId, msgId, senderId, text, BoolToInt(fromMe), quotedId, fileId, filePath, thumbPath, fileStatus, timeSent, BoolToInt(isRead))
+}
+
+func (handler *WmEventHandler) HandleTemplateMessage(messageInfo types.MessageInfo, msg *waE2E.Message, isSyncRead bool) {
+	LOG_TRACE(fmt.Sprintf("TemplateMessage"))
+
+	connId := handler.connId
+	var client *whatsmeow.Client = GetClient(handler.connId)
+
+	// get template part
+	tpl := msg.GetTemplateMessage()
+	if tpl == nil {
+		LOG_WARNING(fmt.Sprintf("get template message failed"))
+		return
+	}
+
+	// handle hydrated template
+	hydtpl := tpl.GetHydratedTemplate()
+	if hydtpl == nil {
+		LOG_TRACE(fmt.Sprintf("unhandled template type"))
+		return
+	}
+
+	// text slice
+	var texts []string
+
+	// title
+	switch hydtitle := hydtpl.GetTitle().(type) {
+	case *waE2E.TemplateMessage_HydratedFourRowTemplate_DocumentMessage:
+		texts = append(texts, "[Document]")
+	case *waE2E.TemplateMessage_HydratedFourRowTemplate_ImageMessage:
+		texts = append(texts, "[Image]")
+	case *waE2E.TemplateMessage_HydratedFourRowTemplate_VideoMessage:
+		texts = append(texts, "[Video]")
+	case *waE2E.TemplateMessage_HydratedFourRowTemplate_LocationMessage:
+		texts = append(texts, "[Location]")
+	case *waE2E.TemplateMessage_HydratedFourRowTemplate_HydratedTitleText:
+		if hydtitle.HydratedTitleText != "" {
+			texts = append(texts, hydtitle.HydratedTitleText)
+		}
+	}
+
+	// content
+	content := hydtpl.GetHydratedContentText()
+	if content != "" {
+		texts = append(texts, content)
+	}
+
+	// buttons
+	buttons := hydtpl.GetHydratedButtons()
+	for _, button := range buttons {
+		switch hydbutton := button.GetHydratedButton().(type) {
+		case *waE2E.HydratedTemplateButton_QuickReplyButton:
+			texts = append(texts, fmt.Sprintf("%s", hydbutton.QuickReplyButton.GetDisplayText()))
+		case *waE2E.HydratedTemplateButton_CallButton:
+			texts = append(texts, fmt.Sprintf("%s: %s", hydbutton.CallButton.GetDisplayText(), hydbutton.CallButton.GetPhoneNumber()))
+		}
+	}
+
+	// footer
+	footer := hydtpl.GetHydratedFooterText()
+	if footer != "" {
+		texts = append(texts, footer)
+	}
+
+	// text
+	text := strings.Join(texts, "\n")
+
+	// context
+	quotedId := ""
+	ci := tpl.GetContextInfo()
+	if ci != nil {
+		quotedId = ci.GetStanzaId()
+	}
+
+	// file id, path and status
+	fileId := ""
+	filePath := ""
+	thumbPath := ""
+	fileStatus := FileStatusNone
+
+	// general
+	chatId := GetChatId(messageInfo.Chat, messageInfo.Sender)
+	msgId := messageInfo.ID
+	fromMe := messageInfo.IsFromMe
+	senderId := JidToStr(messageInfo.Sender)
+	selfId := JidToStr(*client.Store.ID)
+	isSelfChat := (chatId == selfId)
+	timeSent := int(messageInfo.Timestamp.Unix())
+	isRead := IsRead(isSyncRead, isSelfChat, fromMe, messageInfo.Timestamp, GetTimeRead(connId, chatId))
+
+	// reset typing if needed
+	UpdateTypingStatus(connId, chatId, senderId, fromMe, isSyncRead)
+
+	LOG_TRACE(fmt.Sprintf("Call CWmNewMessagesNotify %s: template", chatId))
+	CWmNewMessagesNotify(connId, chatId, msgId, senderId, text, BoolToInt(fromMe), quotedId, fileId, filePath, thumbPath, fileStatus, timeSent, BoolToInt(isRead))
+}
+
+func (handler *WmEventHandler) HandleReactionMessage(messageInfo types.MessageInfo, msg *waE2E.Message, isSyncRead bool) {
+	LOG_TRACE(fmt.Sprintf("ReactionMessage"))
+
+	// get reaction part
+	reaction := msg.GetReactionMessage()
+	if reaction == nil {
+		LOG_WARNING(fmt.Sprintf("get reaction message failed"))
+		return
+	}
+
+	// general
+	chatId := GetChatId(messageInfo.Chat, messageInfo.Sender)
+	fromMe := messageInfo.IsFromMe
+	senderId := JidToStr(messageInfo.Sender)
+	text := reaction.GetText()
+	msgId := reaction.GetKey().GetID()
+
+	handler.HandleReaction(chatId, msgId, senderId, fromMe, text)
+
+	// @todo: add auto-marking reactions of read, investigate why below does not work
+	//reMsgId := messageInfo.ID
+	//WmMarkMessageRead(connId, chatId, senderId, reMsgId)
+}
+
+func (handler *WmEventHandler) HandleEncReactionMessage(messageInfo types.MessageInfo, msg *waE2E.Message, isSyncRead bool) {
+	LOG_TRACE(fmt.Sprintf("EncReactionMessage"))
+
+	var client *whatsmeow.Client = GetClient(handler.connId)
+
+	// decrypt using secret of reacted message
+	reaction, err := client.DecryptReaction(&events.Message{Info: messageInfo, Message: msg})
+	if err != nil {
+		LOG_WARNING(fmt.Sprintf("decrypt reaction error %#v", err))
+		return
+	}
+
+	// general
+	chatId := GetChatId(messageInfo.Chat, messageInfo.Sender)
+	fromMe := messageInfo.IsFromMe
+	senderId := JidToStr(messageInfo.Sender)
+	text := reaction.GetText()
+	msgId := msg.GetEncReactionMessage().GetTargetMessageKey().GetID()
+
+	handler.HandleReaction(chatId, msgId, senderId, fromMe, text)
+}
+
+func (handler *WmEventHandler) HandleReaction(chatId string, msgId string, senderId string, fromMe bool, text string) {
+	connId := handler.connId
+	var client *whatsmeow.Client = GetClient(connId)
+	selfId := JidToStr(*client.Store.ID)
+	if fromMe {
+		senderId = selfId
+	}
+
+	UpdateReaction(connId, chatId, msgId, senderId, text)
+
+	// empty reaction text means reaction was removed
+	removedSenderId := ""
+	if len(text) == 0 {
+		LOG_TRACE(fmt.Sprintf("reaction removed %s %s %s", chatId, msgId, senderId))
+		removedSenderId = senderId
+	}
+
+	emojiSenders := FormatReactions(GetReactions(connId, chatId, msgId))
+	LOG_TRACE(fmt.Sprintf("Call CWmNewMessageReactionsNotify %s %s %q %s", chatId, msgId, emojiSenders, removedSenderId))
+	CWmNewMessageReactionsNotify(connId, chatId, msgId, selfId, emojiSenders, removedSenderId)
+}
+
+func (handler *WmEventHandler) HandleSyncReactions(chatJid types.JID, messageInfo types.MessageInfo, syncReactions []*waWeb.Reaction) {
+	var client *whatsmeow.Client = GetClient(handler.connId)
+	selfId := JidToStr(*client.Store.ID)
+	chatId := GetChatId(chatJid, messageInfo.Sender)
+
+	for _, syncReaction := range syncReactions {
+		// sender from reaction key
+		key := syncReaction.GetKey()
+		senderId := JidToStr(chatJid)
+		if key.GetFromMe() {
+			senderId = selfId
+		} else if len(key.GetParticipant()) > 0 {
+			participantJid, _ := types.ParseJID(key.GetParticipant())
+			senderId = JidToStr(participantJid)
+		}
+
+		fromMe := (senderId == selfId)
+		handler.HandleReaction(chatId, messageInfo.ID, senderId, fromMe, syncReaction.GetText())
+	}
+}
+
+func (handler *WmEventHandler) HandleProtocolMessage(messageInfo types.MessageInfo, msg *waE2E.Message, isSyncRead bool) {
+	LOG_TRACE(fmt.Sprintf("ProtocolMessage"))
+
+	// get protocol part
+	protocol := msg.GetProtocolMessage()
+	if protocol == nil {
+		LOG_WARNING(fmt.Sprintf("get protocol message failed"))
+		return
+	}
+
+	if protocol.GetType() == waE2E.ProtocolMessage_MESSAGE_EDIT {
+		// handle message edit
+		editedMsg := protocol.GetEditedMessage()
+		if editedMsg != nil {
+			newMessageInfo := messageInfo
+			newMessageInfo.ID = protocol.GetKey().GetId()
+			timeEdited := messageInfo.Timestamp
+			if protocol.GetTimestampMS() > 0 {
+				timeEdited = time.UnixMilli(protocol.GetTimestampMS())
+			}
+
+			handler.HandleMessageEdit(newMessageInfo, editedMsg, timeEdited, isSyncRead)
+		} else {
+			LOG_WARNING(fmt.Sprintf("get edited message failed"))
+		}
+	} else if protocol.GetType() == waE2E.ProtocolMessage_REVOKE {
+		// handle message revoke
+		handler.HandleMessageRevoke(messageInfo, protocol, isSyncRead)
+	} else {
+		LOG_TRACE(fmt.Sprintf("ProtocolMessage %#v ignore", protocol.GetType()))
+	}
+}
+
+func (handler *WmEventHandler) HandleMessageEdit(messageInfo types.MessageInfo, editedMsg *waE2E.Message, timeEdited time.Time, isSyncRead bool) {
+	connId := handler.connId
+	chatId := GetChatId(messageInfo.Chat, messageInfo.Sender)
+	msgId := messageInfo.ID
+
+	// keep prior version, if known
+	priorText := ""
+	priorMsg := GetRecentMessage(connId, chatId, msgId)
+	if priorMsg != nil {
+		priorText = GetMessageText(priorMsg)
+		AddEditVersion(connId, chatId, msgId, priorText, timeEdited)
+	}
+
+	handler.HandleMessage(messageInfo, editedMsg, isSyncRead, false /*isHistorySync*/)
+
+	LOG_TRACE(fmt.Sprintf("Call CWmNewMessageEditNotify %s %s %d", chatId, msgId, timeEdited.Unix()))
+	CWmNewMessageEditNotify(connId, chatId, msgId, BoolToInt(true), int(timeEdited.Unix()), WaTextToMarkdown(connId, priorText))
+}
+
+func (handler *WmEventHandler) HandleMessageRevoke(messageInfo types.MessageInfo, protocol *waE2E.ProtocolMessage, isSyncRead bool) {
+	connId := handler.connId
+	var client *whatsmeow.Client = GetClient(handler.connId)
+	chatId := GetChatId(messageInfo.Chat, messageInfo.Sender)
+	selfId := JidToStr(*client.Store.ID)
+	key := protocol.GetKey()
+	msgId := key.GetId()
+
+	// original sender differs from revoker for group admin revokes
+	revokerId := JidToStr(messageInfo.Sender)
+	senderId := revokerId
+	timeSent := messageInfo.Timestamp
+	if originalInfo, ok := GetRecentMessageInfo(connId, chatId, msgId); ok {
+		senderId = JidToStr(originalInfo.Sender)
+		timeSent = originalInfo.Timestamp
+	} else if key.GetFromMe() {
+		senderId = selfId
+	} else if len(key.GetParticipant()) > 0 {
+		participantJid, _ := types.ParseJID(key.GetParticipant())
+		senderId = JidToStr(participantJid)
+	} else {
+		senderId = chatId
+	}
+
+	RemoveRecentMessage(connId, chatId, msgId)
+	RemoveMessageMedia(connId, msgId)
+
+	if !IsTombstonesEnabled(connId) {
+		LOG_TRACE(fmt.Sprintf("Call CWmDeleteMessageNotify %s %s", chatId, msgId))
+		CWmDeleteMessageNotify(connId, chatId, msgId)
+		return
+	}
+
+	// replace message with tombstone
+	revokerName := "you"
+	if revokerId != selfId {
+		revokerName = GetContactName(connId, revokerId)
+	}
+
+	text := ""
+	if revokerId == senderId {
+		text = fmt.Sprintf("[This message was deleted by %s]", revokerName)
+	} else {
+		text = fmt.Sprintf("[This message was deleted by admin %s]", revokerName)
+	}
+
+	fromMe := (senderId == selfId)
+	isSelfChat := (chatId == selfId)
+	isRead := IsRead(isSyncRead, isSelfChat, fromMe, timeSent, GetTimeRead(connId, chatId))
+
+	LOG_TRACE(fmt.Sprintf("Call CWmNewMessagesNotify %s: %s", chatId, text))
+	CWmNewMessagesNotify(connId, chatId, msgId, senderId, text, BoolToInt(fromMe), "", "", "", "", FileStatusNone, int(timeSent.Unix()), BoolToInt(isRead))
+}
+
+func RemoveMessageMedia(connId int, msgId string) {
+	// media, partial downloads and thumbnails are named by message id
+	var tmpPath string = GetPath(connId) + "/tmp"
+	for _, pattern := range []string{msgId + ".*", msgId + "-*"} {
+		matches, _ := filepath.Glob(tmpPath + "/" + pattern)
+		for _, match := range matches {
+			LOG_TRACE(fmt.Sprintf("remove deleted message media %s", match))
+			err := os.Remove(match)
+			if err != nil {
+				LOG_WARNING(fmt.Sprintf("remove media error %#v", err))
+			}
+		}
+	}
+}
+
+func (handler *WmEventHandler) HandleUnsupportedMessage(messageInfo types.MessageInfo, msg *waE2E.Message, isSyncRead bool) {
+	// list from type Message struct in def.pb.go
+	msgType := "Unknown"
+	msgNotify := false
+	switch {
+	case msg.ImageMessage != nil:
+		msgType = "ImageMessage"
+
+	case msg.ExtendedTextMessage != nil:
+		msgType = "ExtendedTextMessage"
+
+	case msg.DocumentMessage != nil:
+		msgType = "DocumentMessage"
+
+	case msg.AudioMessage != nil:
+		msgType = "AudioMessage"
+
+	case msg.VideoMessage != nil:
+		msgType = "VideoMessage"
+
+	case msg.StickerMessage != nil:
+		msgType = "StickerMessage"
+
+	case msg.SenderKeyDistributionMessage != nil:
+		msgType = "SenderKeyDistributionMessage"
+
+	case msg.ContactMessage != nil:
+		msgType = "Contact"
+		msgNotify = true
+
+	case msg.LocationMessage != nil:
+		msgType = "Location"
+		msgNotify = true
+
+	case msg.Call != nil:
+		msgType = "Call"
+		msgNotify = true
+
+	case msg.Chat != nil:
+		msgType = "Chat"
+
+	case msg.ContactsArrayMessage != nil:
+		msgType = "ContactsArrayMessage"
+
+	case msg.HighlyStructuredMessage != nil:
+		msgType = "HighlyStructuredMessage"
+
+	case msg.FastRatchetKeySenderKeyDistributionMessage != nil:
+		msgType = "FastRatchetKeySenderKeyDistributionMessage"
+
+	case msg.SendPaymentMessage != nil:
+		msgType = "SendPaymentMessage"
+
+	case msg.LiveLocationMessage != nil:
+		msgType = "LiveLocation"
+		msgNotify = true
+
+	case msg.RequestPaymentMessage != nil:
+		msgType = "RequestPaymentMessage"
+
+	case msg.DeclinePaymentRequestMessage != nil:
+		msgType = "DeclinePaymentRequestMessage"
+
+	case msg.CancelPaymentRequestMessage != nil:
+		msgType = "CancelPaymentRequestMessage"
+
+	case msg.GroupInviteMessage != nil:
+		msgType = "GroupInviteMessage"
+
+	case msg.TemplateButtonReplyMessage != nil:
+		msgType = "TemplateButtonReplyMessage"
+
+	case msg.ProductMessage != nil:
+		msgType = "ProductMessage"
+
+	case msg.DeviceSentMessage != nil:
+		msgType = "DeviceSentMessage"
+
+	case msg.MessageContextInfo != nil:
+		msgType = "MessageContextInfo"
+
+	case msg.ListMessage != nil:
+		msgType = "ListMessage"
+
+	case msg.ViewOnceMessage != nil:
+		msgType = "ViewOnceMessage"
+
+	case msg.OrderMessage != nil:
+		msgType = "OrderMessage"
+
+	case msg.ListResponseMessage != nil:
+		msgType = "ListResponseMessage"
+
+	case msg.EphemeralMessage != nil:
+		msgType = "EphemeralMessage"
+
+	case msg.InvoiceMessage != nil:
+		msgType = "InvoiceMessage"
+
+	case msg.ButtonsMessage != nil:
+		msgType = "ButtonsMessage"
+
+	case msg.ButtonsResponseMessage != nil:
+		msgType = "ButtonsResponseMessage"
+
+	case msg.PaymentInviteMessage != nil:
+		msgType = "PaymentInviteMessage"
+
+	case msg.InteractiveMessage != nil:
+		msgType = "InteractiveMessage"
+
+	case msg.ReactionMessage != nil:
+		msgType = "ReactionMessage"
+
+	case msg.StickerSyncRmrMessage != nil:
+		msgType = "StickerSyncRmrMessage"
+
+	case msg.InteractiveResponseMessage != nil:
+		msgType = "InteractiveResponseMessage"
+
+	case msg.PollCreationMessage != nil:
+		msgType = "PollCreationMessage"
+
+	case msg.PollUpdateMessage != nil:
+		msgType = "PollUpdateMessage"
+
+	case msg.KeepInChatMessage != nil:
+		msgType = "KeepInChatMessage"
+
+	case msg.DocumentWithCaptionMessage != nil:
+		msgType = "DocumentWithCaptionMessage"
+
+	case msg.RequestPhoneNumberMessage != nil:
+		msgType = "RequestPhoneNumberMessage"
+
+	case msg.ViewOnceMessageV2 != nil:
+		msgType = "ViewOnceMessageV2"
+
+	case msg.EncReactionMessage != nil:
+		msgType = "EncReactionMessage"
+
+	case msg.EditedMessage != nil:
+		msgType = "EditedMessage"
+
+	case msg.ViewOnceMessageV2Extension != nil:
+		msgType = "ViewOnceMessageV2Extension"
+
+	case msg.PollCreationMessageV2 != nil:
+		msgType = "PollCreationMessageV2"
+
+	case msg.ScheduledCallCreationMessage != nil:
+		msgType = "ScheduledCallCreationMessage"
+
+	case msg.GroupMentionedMessage != nil:
+		msgType = "GroupMentionedMessage"
+
+	case msg.PollCreationMessageV3 != nil:
+		msgType = "PollCreationMessageV3"
+
+	case msg.ScheduledCallEditMessage != nil:
+		msgType = "ScheduledCallEditMessage"
+
+	case msg.PtvMessage != nil:
+		msgType = "PtvMessage"
+	}
+
+	if !msgNotify {
+		LOG_TRACE(fmt.Sprintf("%s ignore", msgType))
+		return
+	} else {
+		LOG_TRACE(fmt.Sprintf("%s notify", msgType))
+	}
+
+	connId := handler.connId
+	var client *whatsmeow.Client = GetClient(handler.connId)
+
+	// text
+	text := "[" + msgType + "]"
+
+	// context
+	quotedId := ""
+
+	// file id, path and status
+	fileId := ""
+	filePath := ""
+	thumbPath := ""
+	fileStatus := FileStatusNone
+
+	// general
+	chatId := GetChatId(messageInfo.Chat, messageInfo.Sender)
+	msgId := messageInfo.ID
+	fromMe := messageInfo.IsFromMe
+	senderId := JidToStr(messageInfo.Sender)
+	selfId := JidToStr(*client.Store.ID)
+	isSelfChat := (chatId == selfId)
+	timeSent := int(messageInfo.Timestamp.Unix())
+	isRead := IsRead(isSyncRead, isSelfChat, fromMe, messageInfo.Timestamp, GetTimeRead(connId, chatId))
+
+	// reset typing if needed
+	UpdateTypingStatus(connId, chatId, senderId, fromMe, isSyncRead)
+
+	LOG_TRACE(fmt.Sprintf("Call CWmNewMessagesNotify %s: %s", chatId, text))
+	CWmNewMessagesNotify(connId, chatId, msgId, senderId, text, BoolToInt(fromMe), quotedId, fileId, filePath, thumbPath, fileStatus, timeSent, BoolToInt(isRead))
+}
+
+func UpdateTypingStatus(connId int, chatId string, userId string, fromMe bool, isSyncRead bool) {
+
+	// ignore new messages from self and during initial sync
+	if fromMe || isSyncRead {
+		return
+	}
+
+	LOG_TRACE("update typing status " + strconv.Itoa(connId) + ", " + chatId + ", " + userId)
+
+	// update
+	isOnline := true
+	StopTypingTimeout(connId, chatId, userId)
+
+	LOG_TRACE(fmt.Sprintf("Call CWmNewStatusNotify"))
+	CWmNewStatusNotify(connId, chatId, userId, BoolToInt(isOnline), TypingNone, -1)
+}
+
+func WmInit(path string, sendType int) int {
+
+	LOG_DEBUG("init " + filepath.Base(path))
+
+	// create tmp dir
+	var tmpPath string = path + "/tmp"
+	tmpErr := os.MkdirAll(tmpPath, os.ModePerm)
+	if tmpErr != nil {
+		LOG_WARNING(fmt.Sprintf("mkdir error %#v", tmpErr))
+		return -1
+	}
+
+	var ncLogger logger.Loggable = &ncSignalLogger{}
+	logger.Setup(&ncLogger)
+
+	dbLog := NcLogger()
+	sessionPath := path + "/session.db"
+	sqlAddress := fmt.Sprintf("file:%s?_foreign_keys=on", sessionPath)
+	container, sqlErr := sqlstore.New("sqlite3", sqlAddress, dbLog)
+	if sqlErr != nil {
+		LOG_WARNING(fmt.Sprintf("sqlite error %#v", sqlErr))
+		return -1
+	}
+
+	deviceStore, devErr := container.GetFirstDevice()
+	if devErr != nil {
+		LOG_WARNING(fmt.Sprintf("dev store error %#v", devErr))
+		return -1
+	}
+
+	store.DeviceProps.RequireFullSync = proto.Bool(true)
+	store.DeviceProps.HistorySyncConfig = &waCompanionReg.DeviceProps_HistorySyncConfig{
+		FullSyncDaysLimit:   proto.Uint32(3650),
+		FullSyncSizeMbLimit: proto.Uint32(102400),
+		StorageQuotaMb:      proto.Uint32(102400),
+	}
+
+	store.DeviceProps.PlatformType = waCompanionReg.DeviceProps_FIREFOX.Enum()
+	switch runtime.GOOS {
+	case "linux":
+		store.DeviceProps.Os = proto.String("Linux")
+	case "darwin":
+		store.DeviceProps.Os = proto.String("Mac OS")
+	default:
+		store.DeviceProps.Os = proto.String("Linux")
+	}
+
+	// create new whatsapp connection
+	clientLog := NcLogger()
+	client := whatsmeow.NewClient(deviceStore, clientLog)
+	if client == nil {
+		LOG_WARNING("client error")
+		return -1
+	}
+
+	// store connection and get id
+	var connId int = AddConn(client, path, sendType)
+
+	// stop auto reconnect when it would only repeat a ban, replace or logout
+	client.AutoReconnectHook = func(err error) bool {
+		return !IsTerminalState(GetState(connId))
+	}
+
+	LOG_DEBUG("connId " + strconv.Itoa(connId))
+
+	return connId
+}
+
+func WmLogin(connId int) int {
+
+	LOG_DEBUG("login " + strconv.Itoa(connId) + " whatsmeow " + strconv.Itoa(whatsmeowDate))
+
+	// sanity check arg
+	if connId == -1 {
+		LOG_WARNING("invalid connId")
+		return -1
+	}
+
+	// get path and conn
+	var path string = GetPath(connId)
+	var cli *whatsmeow.Client = GetClient(connId)
+
+	// authenticate if needed, otherwise just connect
+	SetConnState(connId, Connecting, "")
+	var timeout time.Duration = 10 * time.Second // timeout by default (regular connect)
+
+	ch, err := cli.GetQRChannel(context.Background())
+	if err != nil {
+		if errors.Is(err, whatsmeow.ErrQRStoreContainsID) {
+			// This error means that we're already logged in, so ignore it.
+		} else {
+			LOG_WARNING(fmt.Sprintf("failed to get qr channel %#v", err))
+			SetConnState(connId, Disconnected, "")
+		}
+	} else {
+		timeout = 60 * time.Second // timeout during setup / qr code scan
+		go func() {
+			hasGUI := HasGUI()
+
+			LOG_TRACE(fmt.Sprintf("acquire console"))
+			CWmSetProtocolUiControl(connId, 1)
+			fmt.Printf("Scan the Qr code to authenticate, or press CTRL-C to abort.\n")
+
+			for evt := range ch {
+				if evt.Event == whatsmeow.QRChannelEventCode {
+					ShowQrCode(evt.Code, path+"/tmp/qr.png", hasGUI)
+				} else if evt == whatsmeow.QRChannelSuccess {
+					LOG_DEBUG("qr channel event success")
+				} else if evt == whatsmeow.QRChannelClientOutdated {
+					LOG_WARNING(fmt.Sprintf("qr channel result %#v", evt.Event))
+					GetHandler(connId).HandleClientOutdated()
+				} else {
+					LOG_WARNING(fmt.Sprintf("qr channel result %#v", evt.Event))
+					message := fmt.Sprintf("Linking this device failed (%s).", evt.Event)
+					SetConnState(connId, Disconnected, message)
+					NotifyConnError(connId, message, true /*isReconnectable*/)
+				}
+			}
+
+			LOG_TRACE(fmt.Sprintf("release console"))
+			CWmSetProtocolUiControl(connId, 0)
+		}()
+	}
+
+	eventHandler := GetHandler(connId)
+	cli.AddEventHandler(eventHandler.HandleEvent)
+	err = cli.Connect()
+	if err != nil {
+		LOG_WARNING(fmt.Sprintf("failed to connect %#v", err))
+		message := fmt.Sprintf("Unable to connect to WhatsApp (%s), please check the network connection.", err.Error())
+		SetConnState(connId, Disconnected, message)
+		NotifyConnError(connId, message, true /*isReconnectable*/)
+		return -1
+	}
+
+	LOG_DEBUG("connect ok")
+
+	// wait for connection events (up to timeout)
+	LOG_DEBUG("wait start")
+	state := WaitState(connId, timeout, func(state State) bool {
+		return (state != Connecting) && (state != Reconnecting)
+	})
+	LOG_DEBUG("wait done")
+
+	// delete temporary image file
+	_ = os.Remove(path + "/tmp/qr.png")
+
+	// notify error, unless already notified with a reason by event handlers
+	if !IsConnectedState(state) {
+		LOG_WARNING(fmt.Sprintf("state not connected %#v", state))
+
+		if len(GetStateReason(connId)) == 0 {
+			NotifyConnError(connId, "Unable to connect to WhatsApp, please check the network connection.", true /*isReconnectable*/)
+		}
+
+		if !IsTerminalState(state) {
+			SetConnState(connId, Disconnected, "")
+		}
+		return -1
+	}
+
+	LOG_DEBUG("login ok")
+	return 0
+}
+
+func WmLogout(connId int) int {
+
+	LOG_DEBUG("logout " + strconv.Itoa(connId))
+
+	// sanity check arg
+	if connId == -1 {
+		LOG_WARNING("invalid connId")
+		return -1
+	}
+
+	// get client
+	var client *whatsmeow.Client = GetClient(connId)
+
+	// disconnect
+	client.Disconnect()
+
+	// set state
+	SetConnState(connId, Disconnected, "")
+
+	LOG_DEBUG("logout ok")
+
+	return 0
+}
+
+func WmCleanup(connId int) int {
+
+	LOG_DEBUG("cleanup " + strconv.Itoa(connId))
+	RemoveConn(connId)
+	return 0
+}
+
+func WmGetVersion() int {
+	return whatsmeowDate
+}
 
-	case msg.ReactionMessage != nil:
-		msgType = "ReactionMessage"
+func WmGetMessages(connId int, chatId string, limit int, fromMsgId string, owner int) int {
+	// not supported in multi-device
+	return -1
+}
 
-	case msg.StickerSyncRmrMessage != nil:
-		msgType = "StickerSyncRmrMessage"
+func WmSendMessage(connId int, chatId string, text string, quotedId string, quotedText string, quotedSender string, filePath string, fileType string, editMsgId string, editMsgSent int) int {
 
-	case msg.InteractiveResponseMessage != nil:
-		msgType = "InteractiveResponseMessage"
+	LOG_TRACE("send message " + strconv.Itoa(connId) + ", " + chatId + ", " + text + ", " + quotedId + ", " + filePath + ", " + editMsgId)
 
-	case msg.PollCreationMessage != nil:
-		msgType = "PollCreationMessage"
+	// sanity check arg
+	if connId == -1 {
+		LOG_WARNING("invalid connId")
+		return -1
+	}
 
-	case msg.PollUpdateMessage != nil:
-		msgType = "PollUpdateMessage"
+	// get conn
+	var client *whatsmeow.Client = GetClient(connId)
 
-	case msg.KeepInChatMessage != nil:
-		msgType = "KeepInChatMessage"
+	// convert markdown formatting
+	text = MarkdownToWaText(connId, text)
+	quotedText = MarkdownToWaText(connId, quotedText)
 
-	case msg.DocumentWithCaptionMessage != nil:
-		msgType = "DocumentWithCaptionMessage"
+	// local vars
+	var sendErr error
+	var message waE2E.Message
+	var sendResponse whatsmeow.SendResponse
+
+	// recipient
+	chatJid, jidErr := types.ParseJID(chatId)
+	if jidErr != nil {
+		LOG_WARNING(fmt.Sprintf("jid err %#v", jidErr))
+		return -1
+	}
+
+	isSend := false
+
+	// enforce edit window
+	if len(editMsgId) > 0 {
+		editAge := time.Since(time.Unix(int64(editMsgSent), 0))
+		if editAge > whatsmeow.EditWindow {
+			LOG_WARNING(fmt.Sprintf("edit message error: messages can only be edited within %s after sent, %s has passed",
+				whatsmeow.EditWindow, editAge.Truncate(time.Second)))
+			errorMessage := fmt.Sprintf("Messages can only be edited within %d minutes after sent.", int(whatsmeow.EditWindow.Minutes()))
+			LOG_TRACE(fmt.Sprintf("Call CWmErrorNotify %s", errorMessage))
+			CWmErrorNotify(connId, errorMessage)
+			return -1
+		}
+	}
+
+	// quote context
+	contextInfo := waE2E.ContextInfo{}
+	if len(quotedId) > 0 {
+		// embed original message if known, otherwise only its text
+		var quotedMessage *waE2E.Message
+		if originalMessage := GetRecentMessage(connId, chatId, quotedId); originalMessage != nil {
+			quotedMessage = ToQuotedMessage(originalMessage)
+		} else {
+			quotedMessage = &waE2E.Message{
+				Conversation: &quotedText,
+			}
+		}
+
+		quotedSender = strings.Replace(quotedSender, "@c.us", "@s.whatsapp.net", 1)
+
+		LOG_TRACE("send quoted " + quotedId + ", " + quotedText + ", " + quotedSender)
+		contextInfo = waE2E.ContextInfo{
+			QuotedMessage: quotedMessage,
+			StanzaID:      &quotedId,
+			Participant:   &quotedSender,
+		}
+	}
+
+	// check message type
+	if len(filePath) == 0 {
+
+		// text message
+		extendedTextMessage := waE2E.ExtendedTextMessage{
+			Text:        &text,
+			ContextInfo: &contextInfo,
+		}
+
+		message.ExtendedTextMessage = &extendedTextMessage
+
+		isSend = true
+	} else {
+
+		var isSendType bool = IntToBool(GetSendType(connId))
+
+		// media type
+		mimeType := strings.Split(fileType, "/")[0] // image, text, application, etc.
+		mediaType := whatsmeow.MediaDocument
+		if isSendType && (mimeType == "audio") {
+			mediaType = whatsmeow.MediaAudio
+		} else if isSendType && (mimeType == "video") {
+			mediaType = whatsmeow.MediaVideo
+		} else if isSendType && (mimeType == "image") {
+			mediaType = whatsmeow.MediaImage
+		}
+
+		// check size limits before upload
+		stat, statErr := os.Stat(filePath)
+		if statErr != nil {
+			LOG_WARNING(fmt.Sprintf("stat file %s err %#v", filePath, statErr))
+			return -1
+		}
+
+		fileSize := stat.Size()
+		if fileSize > uploadSizeLimits[mediaType] {
+			LOG_WARNING(fmt.Sprintf("file size %d exceeds limit %d", fileSize, uploadSizeLimits[mediaType]))
+			errorMessage := fmt.Sprintf("File is too large to send as %s (%d MB, limit %d MB).", mimeType,
+				fileSize/(1024*1024), uploadSizeLimits[mediaType]/(1024*1024))
+			if mediaType != whatsmeow.MediaDocument {
+				errorMessage += " Disable attachment_send_type to send it as a document."
+			}
+
+			LOG_TRACE(fmt.Sprintf("Call CWmErrorNotify %s", errorMessage))
+			CWmErrorNotify(connId, errorMessage)
+			return -1
+		}
+
+		// webp images without caption are sent as stickers
+		isSticker := false
+		var stickerWidth, stickerHeight uint32
+		var isAnimated bool
+		if (mediaType == whatsmeow.MediaImage) && (len(text) == 0) {
+			var webpErr error
+			stickerWidth, stickerHeight, isAnimated, webpErr = GetWebpInfo(filePath)
+			if webpErr == nil {
+				isSticker = IsValidSticker(stickerWidth, stickerHeight, isAnimated, fileSize)
+				if !isSticker && isAnimated {
+					// animated webp cannot be shown as image
+					mediaType = whatsmeow.MediaDocument
+				}
+			}
+		}
+
+		// upload
+		uploaded, upErr := UploadFromFile(connId, chatId, filePath, mediaType)
+		if upErr != nil {
+			LOG_WARNING(fmt.Sprintf("upload error %#v", upErr))
+			return -1
+		}
+
+		switch mediaType {
+		case whatsmeow.MediaAudio:
+			LOG_TRACE("send audio " + fileType)
+
+			audioMessage := waE2E.AudioMessage{
+				URL:           proto.String(uploaded.URL),
+				DirectPath:    proto.String(uploaded.DirectPath),
+				MediaKey:      uploaded.MediaKey,
+				Mimetype:      proto.String(fileType),
+				FileEncSHA256: uploaded.FileEncSHA256,
+				FileSHA256:    uploaded.FileSHA256,
+				FileLength:    proto.Uint64(uploaded.FileLength),
+				ContextInfo:   &contextInfo,
+			}
+
+			// ogg/opus is sent as voice note
+			packets, seconds, opusErr := ReadOggOpusPackets(filePath)
+			if opusErr == nil {
+				LOG_TRACE(fmt.Sprintf("send voice note %d seconds", seconds))
+				audioMessage.Mimetype = proto.String("audio/ogg; codecs=opus")
+				audioMessage.PTT = proto.Bool(true)
+				audioMessage.Seconds = proto.Uint32(seconds)
+				audioMessage.Waveform = DecodeWaveform(filePath)
+				if audioMessage.Waveform == nil {
+					audioMessage.Waveform = EstimateWaveform(packets)
+				}
+			}
+
+			message.AudioMessage = &audioMessage
+
+		case whatsmeow.MediaVideo:
+			LOG_TRACE("send video " + fileType)
+
+			videoMessage := waE2E.VideoMessage{
+				Caption:       proto.String(text),
+				URL:           proto.String(uploaded.URL),
+				DirectPath:    proto.String(uploaded.DirectPath),
+				MediaKey:      uploaded.MediaKey,
+				Mimetype:      proto.String(fileType),
+				FileEncSHA256: uploaded.FileEncSHA256,
+				FileSHA256:    uploaded.FileSHA256,
+				FileLength:    proto.Uint64(uploaded.FileLength),
+				ContextInfo:   &contextInfo,
+			}
+
+			width, height, seconds, infoErr := GetVideoInfo(filePath)
+			if infoErr != nil {
+				LOG_WARNING(fmt.Sprintf("video info error %#v", infoErr))
+			} else {
+				videoMessage.Width = proto.Uint32(width)
+				videoMessage.Height = proto.Uint32(height)
+			}
+
+			if seconds > 0 {
+				videoMessage.Seconds = proto.Uint32(seconds)
+			}
+
+			message.VideoMessage = &videoMessage
+
+		case whatsmeow.MediaImage:
+			if isSticker {
+				LOG_TRACE("send sticker " + fileType)
+
+				stickerMessage := waE2E.StickerMessage{
+					URL:           proto.String(uploaded.URL),
+					DirectPath:    proto.String(uploaded.DirectPath),
+					MediaKey:      uploaded.MediaKey,
+					Mimetype:      proto.String("image/webp"),
+					FileEncSHA256: uploaded.FileEncSHA256,
+					FileSHA256:    uploaded.FileSHA256,
+					FileLength:    proto.Uint64(uploaded.FileLength),
+					Width:         proto.Uint32(stickerWidth),
+					Height:        proto.Uint32(stickerHeight),
+					IsAnimated:    proto.Bool(isAnimated),
+					ContextInfo:   &contextInfo,
+				}
+
+				message.StickerMessage = &stickerMessage
+			} else {
+				LOG_TRACE("send image " + fileType)
+
+				imageMessage := waE2E.ImageMessage{
+					Caption:       proto.String(text),
+					URL:           proto.String(uploaded.URL),
+					DirectPath:    proto.String(uploaded.DirectPath),
+					MediaKey:      uploaded.MediaKey,
+					Mimetype:      proto.String(fileType),
+					FileEncSHA256: uploaded.FileEncSHA256,
+					FileSHA256:    uploaded.FileSHA256,
+					FileLength:    proto.Uint64(uploaded.FileLength),
+					ContextInfo:   &contextInfo,
+				}
+
+				width, height, thumbnail, infoErr := GetImageInfo(filePath)
+				if infoErr != nil {
+					LOG_WARNING(fmt.Sprintf("image info error %#v", infoErr))
+				} else {
+					imageMessage.Width = proto.Uint32(width)
+					imageMessage.Height = proto.Uint32(height)
+					imageMessage.JPEGThumbnail = thumbnail
+				}
+
+				message.ImageMessage = &imageMessage
+			}
+
+		default:
+			LOG_TRACE("send document " + fileType)
+
+			fileName := filepath.Base(filePath)
+
+			documentMessage := waE2E.DocumentMessage{
+				Caption:       proto.String(text),
+				URL:           proto.String(uploaded.URL),
+				DirectPath:    proto.String(uploaded.DirectPath),
+				MediaKey:      uploaded.MediaKey,
+				Mimetype:      proto.String(fileType),
+				FileEncSHA256: uploaded.FileEncSHA256,
+				FileSHA256:    uploaded.FileSHA256,
+				FileLength:    proto.Uint64(uploaded.FileLength),
+				FileName:      proto.String(fileName),
+				ContextInfo:   &contextInfo,
+			}
+
+			message.DocumentMessage = &documentMessage
+		}
+
+		isSend = true
+	}
+
+	if isSend {
+
+		if len(editMsgId) > 0 {
+			// edit message
+			sendResponse, sendErr =
+				client.SendMessage(context.Background(), chatJid, client.BuildEdit(chatJid, editMsgId, &message))
+
+		} else {
+			// send message
+			sendResponse, sendErr = client.SendMessage(context.Background(), chatJid, &message)
+
+		}
+	}
+
+	// log any error
+	if sendErr != nil {
+		LOG_WARNING(fmt.Sprintf("send message error %#v", sendErr))
+		if len(editMsgId) > 0 {
+			LOG_TRACE("Call CWmErrorNotify edit failed")
+			CWmErrorNotify(connId, "Failed to edit message.")
+		}
+		return -1
+	} else {
+		LOG_TRACE(fmt.Sprintf("send message ok"))
+
+		// messageInfo
+		var messageInfo types.MessageInfo
+		messageInfo.Chat = chatJid
+		messageInfo.IsFromMe = true
+		messageInfo.Sender = *client.Store.ID
+
+		isSyncRead := false
+		handler := GetHandler(connId)
+		if len(editMsgId) > 0 {
+			messageInfo.ID = editMsgId
+			messageInfo.Timestamp = time.Unix(int64(editMsgSent), 0)
+			handler.HandleMessageEdit(messageInfo, &message, sendResponse.Timestamp, isSyncRead)
+		} else {
+			messageInfo.ID = sendResponse.ID
+			messageInfo.Timestamp = sendResponse.Timestamp
+			handler.HandleMessage(messageInfo, &message, isSyncRead, false /*isHistorySync*/)
+		}
+	}
+
+	return 0
+}
+
+func WmSetTombstonesEnabled(connId int, isEnabled int) int {
+
+	LOG_TRACE("set tombstones enabled " + strconv.Itoa(connId) + ", " + strconv.Itoa(isEnabled))
+
+	// sanity check arg
+	if connId == -1 {
+		LOG_WARNING("invalid connId")
+		return -1
+	}
+
+	SetTombstonesEnabled(connId, IntToBool(isEnabled))
+
+	return 0
+}
+
+type ClientProxy struct {
+	httpProxy   whatsmeow.Proxy
+	socksDialer proxy.Dialer
+}
+
+func ParseClientProxy(proxyUrl string) (*ClientProxy, error) {
+	// no proxy configured, keep default of using proxy from environment
+	if len(proxyUrl) == 0 {
+		return &ClientProxy{httpProxy: http.ProxyFromEnvironment}, nil
+	}
+
+	// explicitly no proxy, also ignoring environment
+	if proxyUrl == "direct" {
+		return &ClientProxy{}, nil
+	}
+
+	parsedUrl, err := url.Parse(proxyUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(parsedUrl.Host) == 0 {
+		return nil, errors.New("missing proxy host")
+	}
+
+	switch parsedUrl.Scheme {
+	case "http", "https":
+		// credentials in url are passed on in proxy-authorization header for connect
+		return &ClientProxy{httpProxy: http.ProxyURL(parsedUrl)}, nil
+
+	case "socks5", "socks5h":
+		var auth *proxy.Auth
+		if parsedUrl.User != nil {
+			password, _ := parsedUrl.User.Password()
+			auth = &proxy.Auth{User: parsedUrl.User.Username(), Password: password}
+		}
+
+		dialer, err := proxy.SOCKS5("tcp", parsedUrl.Host, auth, proxy.Direct)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ClientProxy{socksDialer: dialer}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", parsedUrl.Scheme)
+	}
+}
+
+func SetClientProxy(client *whatsmeow.Client, clientProxy *ClientProxy, opts whatsmeow.SetProxyOptions) {
+	if clientProxy.socksDialer != nil {
+		client.SetSOCKSProxy(clientProxy.socksDialer, opts)
+	} else {
+		client.SetProxy(clientProxy.httpProxy, opts)
+	}
+}
+
+// whatsmeow socks media proxy always uses the websocket socks dialer, so media gets own transport
+func NewMediaTransport(clientProxy *ClientProxy) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if clientProxy.socksDialer != nil {
+		transport.Proxy = nil
+		if contextDialer, ok := clientProxy.socksDialer.(proxy.ContextDialer); ok {
+			transport.DialContext = contextDialer.DialContext
+		} else {
+			transport.DialContext = func(ctx context.Context, network string, addr string) (net.Conn, error) {
+				return clientProxy.socksDialer.Dial(network, addr)
+			}
+		}
+	} else {
+		transport.Proxy = clientProxy.httpProxy
+	}
+
+	return transport
+}
 
-	case msg.RequestPhoneNumberMessage != nil:
-		msgType = "RequestPhoneNumberMessage"
+func WmSetProxy(connId int, proxyUrl string, mediaProxyUrl string, isLoginOnly int) int {
 
-	case msg.ViewOnceMessageV2 != nil:
-		msgType = "ViewOnceMessageV2"
+	LOG_TRACE("set proxy " + strconv.Itoa(connId) + ", " + strconv.Itoa(isLoginOnly))
 
-	case msg.EncReactionMessage != nil:
-		msgType = "EncReactionMessage"
+	// sanity check arg
+	if connId == -1 {
+		LOG_WARNING("invalid connId")
+		return -1
+	}
 
-	case msg.EditedMessage != nil:
-		msgType = "EditedMessage"
+	// get client
+	var client *whatsmeow.Client = GetClient(connId)
 
-	case msg.ViewOnceMessageV2Extension != nil:
-		msgType = "ViewOnceMessageV2Extension"
+	// validate both before applying any, to not connect without the intended proxy
+	websocketProxy, err := ParseClientProxy(proxyUrl)
+	if err != nil {
+		LOG_WARNING(fmt.Sprintf("proxy error %#v", err))
+		return -1
+	}
 
-	case msg.PollCreationMessageV2 != nil:
-		msgType = "PollCreationMessageV2"
+	mediaProxy, err := ParseClientProxy(mediaProxyUrl)
+	if err != nil {
+		LOG_WARNING(fmt.Sprintf("media proxy error %#v", err))
+		return -1
+	}
 
-	case msg.ScheduledCallCreationMessage != nil:
-		msgType = "ScheduledCallCreationMessage"
+	SetClientProxy(client, websocketProxy, whatsmeow.SetProxyOptions{NoMedia: true})
+	client.SetMediaTransport(NewMediaTransport(mediaProxy))
 
-	case msg.GroupMentionedMessage != nil:
-		msgType = "GroupMentionedMessage"
+	client.ToggleProxyOnlyForLogin(IntToBool(isLoginOnly))
 
-	case msg.PollCreationMessageV3 != nil:
-		msgType = "PollCreationMessageV3"
+	return 0
+}
 
-	case msg.ScheduledCallEditMessage != nil:
-		msgType = "ScheduledCallEditMessage"
+func WmForwardMessage(connId int, chatId string, msgId string, fileId string, fileType string, text string, toChatIds string) int {
 
-	case msg.PtvMessage != nil:
-		msgType = "PtvMessage"
-	}
+	LOG_TRACE("forward message " + strconv.Itoa(connId) + ", " + chatId + ", " + msgId + ", " + toChatIds)
 
-	if !msgNotify {
-		LOG_TRACE(fmt.Sprintf("%s ignore", msgType))
-		return
-	} else {
-		LOG_TRACE(fmt.Sprintf("%s notify", msgType))
+	// sanity check arg
+	if connId == -1 {
+		LOG_WARNING("invalid connId")
+		return -1
 	}
 
-	connId := handler.connId
-	var client *whatsmeow.Client = GetClient(handler.connId)
+	// get client
+	client := GetClient(connId)
 
-	// text
-	text := "[" + msgType + "]"
+	// destination chat ids, separated by comma
+	destinations := strings.FieldsFunc(toChatIds, func(r rune) bool {
+		return r == ','
+	})
 
-	// context
-	quotedId := ""
+	// get original message, or rebuild it from stored media references
+	originalMessage := GetRecentMessage(connId, chatId, msgId)
+	if originalMessage == nil {
+		LOG_DEBUG(fmt.Sprintf("forward message %s not recent, rebuild from file id", msgId))
+		originalMessage = FileIdToMessage(connId, msgId, fileId, fileType, text)
+	}
 
-	// file id, path and status
-	fileId := ""
-	filePath := ""
-	fileStatus := FileStatusNone
+	var message *waE2E.Message
+	if originalMessage == nil {
+		LOG_WARNING(fmt.Sprintf("forward message %s not found", msgId))
+	} else if message = ToForwardedMessage(originalMessage); message == nil {
+		LOG_WARNING(fmt.Sprintf("forward message %s unsupported type", msgId))
+	}
 
-	// general
-	chatId := GetChatId(messageInfo.Chat, messageInfo.Sender)
-	msgId := messageInfo.ID
-	fromMe := messageInfo.IsFromMe
-	senderId := JidToStr(messageInfo.Sender)
-	selfId := JidToStr(*client.Store.ID)
-	isSelfChat := (chatId == selfId)
-	timeSent := int(messageInfo.Timestamp.Unix())
-	isRead := IsRead(isSyncRead, isSelfChat, fromMe, messageInfo.Timestamp, GetTimeRead(connId, chatId))
+	// send to each destination, reporting result per destination
+	rv := 0
+	for _, toChatId := range destinations {
+		if (message == nil) || !ForwardMessageTo(connId, client, message, toChatId) {
+			LOG_TRACE(fmt.Sprintf("Call CWmForwardMessageNotify %s failed", toChatId))
+			CWmForwardMessageNotify(connId, chatId, msgId, toChatId, BoolToInt(false))
+			rv = -1
+			continue
+		}
 
-	// reset typing if needed
-	UpdateTypingStatus(connId, chatId, senderId, fromMe, isSyncRead)
+		LOG_TRACE(fmt.Sprintf("Call CWmForwardMessageNotify %s ok", toChatId))
+		CWmForwardMessageNotify(connId, chatId, msgId, toChatId, BoolToInt(true))
+	}
 
-	LOG_TRACE(fmt.Sprintf("Call CWmNewMessagesNotify %s: %s", chatId, text))
-	CWmNewMessagesNotify(connId, chatId, msgId, senderId, text, BoolToInt(fromMe), quotedId, fileId, filePath, fileStatus, timeSent, BoolToInt(isRead))
+	return rv
 }
 
-func UpdateTypingStatus(connId int, chatId string, userId string, fromMe bool, isSyncRead bool) {
+func ForwardMessageTo(connId int, client *whatsmeow.Client, message *waE2E.Message, toChatId string) bool {
+	toChatJid, jidErr := types.ParseJID(toChatId)
+	if jidErr != nil {
+		LOG_WARNING(fmt.Sprintf("jid err %#v", jidErr))
+		return false
+	}
 
-	// ignore new messages from self and during initial sync
-	if fromMe || isSyncRead {
-		return
+	sendResponse, sendErr := client.SendMessage(context.Background(), toChatJid, message)
+	if sendErr != nil {
+		LOG_WARNING(fmt.Sprintf("forward message error %#v", sendErr))
+		return false
 	}
 
-	LOG_TRACE("update typing status " + strconv.Itoa(connId) + ", " + chatId + ", " + userId)
+	LOG_TRACE(fmt.Sprintf("forward message ok %s", toChatId))
 
-	// update
-	isOnline := true
-	isTyping := false
+	// messageInfo
+	var messageInfo types.MessageInfo
+	messageInfo.Chat = toChatJid
+	messageInfo.IsFromMe = true
+	messageInfo.Sender = *client.Store.ID
+	messageInfo.ID = sendResponse.ID
+	messageInfo.Timestamp = sendResponse.Timestamp
 
-	LOG_TRACE(fmt.Sprintf("Call CWmNewStatusNotify"))
-	CWmNewStatusNotify(connId, chatId, userId, BoolToInt(isOnline), BoolToInt(isTyping), -1)
+	isSyncRead := false
+	handler := GetHandler(connId)
+	handler.HandleMessage(messageInfo, message, isSyncRead, false /*isHistorySync*/)
+
+	return true
 }
 
-func WmInit(path string, proxy string, sendType int) int {
+func WmSetMarkdownEnabled(connId int, isEnabled int) int {
 
-	LOG_DEBUG("init " + filepath.Base(path))
+	LOG_TRACE("set markdown enabled " + strconv.Itoa(connId) + ", " + strconv.Itoa(isEnabled))
 
-	// create tmp dir
-	var tmpPath string = path + "/tmp"
-	tmpErr := os.MkdirAll(tmpPath, os.ModePerm)
-	if tmpErr != nil {
-		LOG_WARNING(fmt.Sprintf("mkdir error %#v", tmpErr))
+	// sanity check arg
+	if connId == -1 {
+		LOG_WARNING("invalid connId")
 		return -1
 	}
 
-	var ncLogger logger.Loggable = &ncSignalLogger{}
-	logger.Setup(&ncLogger)
+	SetMarkdownEnabled(connId, IntToBool(isEnabled))
 
-	dbLog := NcLogger()
-	sessionPath := path + "/session.db"
-	sqlAddress := fmt.Sprintf("file:%s?_foreign_keys=on", sessionPath)
-	container, sqlErr := sqlstore.New("sqlite3", sqlAddress, dbLog)
-	if sqlErr != nil {
-		LOG_WARNING(fmt.Sprintf("sqlite error %#v", sqlErr))
+	return 0
+}
+
+func WmGetStatus(connId int, userId string) int {
+
+	LOG_TRACE("get status " + strconv.Itoa(connId) + ", " + userId)
+
+	// sanity check arg
+	if connId == -1 {
+		LOG_WARNING("invalid connId")
 		return -1
 	}
 
-	deviceStore, devErr := container.GetFirstDevice()
-	if devErr != nil {
-		LOG_WARNING(fmt.Sprintf("dev store error %#v", devErr))
+	// get client
+	client := GetClient(connId)
+
+	// get user
+	userJid, _ := types.ParseJID(userId)
+	if userJid.Server == types.GroupServer {
+		// ignore presence requests for groups, participants subscribed when opened
 		return -1
 	}
 
-	store.DeviceProps.RequireFullSync = proto.Bool(true)
-	store.DeviceProps.HistorySyncConfig = &waCompanionReg.DeviceProps_HistorySyncConfig{
-		FullSyncDaysLimit:   proto.Uint32(3650),
-		FullSyncSizeMbLimit: proto.Uint32(102400),
-		StorageQuotaMb:      proto.Uint32(102400),
+	// do not subscribe self
+	if userId == JidToStr(*client.Store.ID) {
+		return 0
 	}
 
-	store.DeviceProps.PlatformType = waCompanionReg.DeviceProps_FIREFOX.Enum()
-	switch runtime.GOOS {
-	case "linux":
-		store.DeviceProps.Os = proto.String("Linux")
-	case "darwin":
-		store.DeviceProps.Os = proto.String("Mac OS")
-	default:
-		store.DeviceProps.Os = proto.String("Linux")
+	// report cached last seen
+	if lastSeen, ok := GetLastSeen(connId, userId); ok {
+		timeSeen := -1
+		if !lastSeen.TimeSeen.IsZero() {
+			timeSeen = int(lastSeen.TimeSeen.Unix())
+		}
+
+		LOG_TRACE(fmt.Sprintf("Call CWmNewStatusNotify %s cached", userId))
+		CWmNewStatusNotify(connId, "", userId, BoolToInt(lastSeen.IsOnline), TypingNone, timeSeen)
 	}
 
-	// create new whatsapp connection
-	clientLog := NcLogger()
-	client := whatsmeow.NewClient(deviceStore, clientLog)
-	if client == nil {
-		LOG_WARNING("client error")
+	// subscribe user presence
+	QueuePresenceSubscriptions(connId, []string{userId})
+
+	return 0
+}
+
+func WmSetCurrentChat(connId int, chatId string) int {
+
+	LOG_TRACE("set current chat " + strconv.Itoa(connId) + ", " + chatId)
+
+	// sanity check arg
+	if connId == -1 {
+		LOG_WARNING("invalid connId")
 		return -1
 	}
 
-	// set proxy details
-	if len(proxy) > 0 {
-		client.SetProxyAddress(proxy)
+	// get client
+	client := GetClient(connId)
+
+	chatJid, _ := types.ParseJID(chatId)
+	if chatJid.Server != types.GroupServer {
+		return 0
 	}
 
-	// store connection and get id
-	var connId int = AddConn(client, path, sendType)
+	// subscribe presence of group participants
+	go func() {
+		groupInfo, err := client.GetGroupInfo(chatJid)
+		if err != nil {
+			LOG_WARNING(fmt.Sprintf("get group info error %#v", err))
+			return
+		}
 
-	LOG_DEBUG("connId " + strconv.Itoa(connId))
+		selfId := JidToStr(*client.Store.ID)
+		var userIds []string
+		for _, participant := range groupInfo.Participants {
+			userId := JidToStr(participant.JID)
+			if userId != selfId {
+				userIds = append(userIds, userId)
+			}
+		}
 
-	return connId
+		QueuePresenceSubscriptions(connId, userIds)
+	}()
+
+	return 0
 }
 
-func WmLogin(connId int) int {
+func WmMarkMessageRead(connId int, chatId string, senderId string, msgId string) int {
 
-	LOG_DEBUG("login " + strconv.Itoa(connId) + " whatsmeow " + strconv.Itoa(whatsmeowDate))
+	LOG_TRACE("mark message read " + strconv.Itoa(connId) + ", " + chatId + ", " + senderId + ", " + msgId)
 
 	// sanity check arg
 	if connId == -1 {
@@ -1779,111 +5508,119 @@ func WmLogin(connId int) int {
 		return -1
 	}
 
-	// get path and conn
-	var path string = GetPath(connId)
-	var cli *whatsmeow.Client = GetClient(connId)
+	// get client
+	client := GetClient(connId)
 
-	// authenticate if needed, otherwise just connect
-	SetState(connId, Connecting)
-	var timeoutMs int = 10000 // 10 sec timeout by default (regular connect)
+	// mark read
+	msgIds := []types.MessageID{
+		msgId,
+	}
+	timeRead := time.Now()
+	chatJid, _ := types.ParseJID(chatId)
+	senderJid, _ := types.ParseJID(senderId)
 
-	ch, err := cli.GetQRChannel(context.Background())
+	// only sync read status to own devices if read receipts are disabled
+	var receiptType types.ReceiptType = types.ReceiptTypeRead
+	if client.GetPrivacySettings().ReadReceipts == types.PrivacySettingNone {
+		receiptType = types.ReceiptTypeReadSelf
+	}
+
+	err := client.MarkRead(msgIds, timeRead, chatJid, senderJid, receiptType)
+
+	// store time
+	SetTimeRead(connId, chatId, timeRead)
+
+	// log any error
 	if err != nil {
-		if errors.Is(err, whatsmeow.ErrQRStoreContainsID) {
-			// This error means that we're already logged in, so ignore it.
-		} else {
-			LOG_WARNING(fmt.Sprintf("failed to get qr channel %#v", err))
-			SetState(connId, Disconnected)
-		}
+		LOG_WARNING(fmt.Sprintf("mark message read error %#v", err))
+		return -1
 	} else {
-		timeoutMs = 60000 // 60 sec timeout during setup / qr code scan
-		go func() {
-			hasGUI := HasGUI()
+		LOG_TRACE(fmt.Sprintf("mark message read ok %#v", msgId))
+	}
 
-			LOG_TRACE(fmt.Sprintf("acquire console"))
-			CWmSetProtocolUiControl(connId, 1)
-			fmt.Printf("Scan the Qr code to authenticate, or press CTRL-C to abort.\n")
+	return 0
+}
 
-			for evt := range ch {
-				if evt.Event == whatsmeow.QRChannelEventCode {
-					if hasGUI {
-						qrPath := path + "/tmp/qr.png"
-						qrcode.WriteFile(evt.Code, qrcode.Medium, 512, qrPath)
-						ShowImage(qrPath)
-					} else {
-						qrterminal.GenerateHalfBlock(evt.Code, qrterminal.L, os.Stdout)
-					}
-				} else if evt == whatsmeow.QRChannelSuccess {
-					LOG_DEBUG("qr channel event success")
-				} else if evt == whatsmeow.QRChannelClientOutdated {
-					LOG_WARNING(fmt.Sprintf("qr channel result %#v", evt.Event))
-					SetState(connId, Outdated)
-				} else {
-					LOG_WARNING(fmt.Sprintf("qr channel result %#v", evt.Event))
-					SetState(connId, Disconnected)
-				}
-			}
+func WmDeleteMessage(connId int, chatId string, senderId string, msgId string) int {
 
-			LOG_TRACE(fmt.Sprintf("release console"))
-			CWmSetProtocolUiControl(connId, 0)
-		}()
+	LOG_TRACE("delete message " + strconv.Itoa(connId) + ", " + chatId + ", " + msgId)
+
+	// sanity check arg
+	if connId == -1 {
+		LOG_WARNING("invalid connId")
+		return -1
 	}
 
-	eventHandler := GetHandler(connId)
-	cli.AddEventHandler(eventHandler.HandleEvent)
-	err = cli.Connect()
+	// get client
+	client := GetClient(connId)
+
+	chatJid, _ := types.ParseJID(chatId)
+	senderJid, _ := types.ParseJID(senderId)
+
+	// skip deleting messages sent by others in private chat
+	selfId := JidToStr(*client.Store.ID)
+	isGroup := (chatJid.Server == types.GroupServer)
+	isFromSelf := (senderId == selfId)
+	if !isFromSelf && !isGroup {
+		LOG_TRACE(fmt.Sprintf("delete message isGroup %t isFromSelf %t skip %#v",
+			isGroup, isFromSelf, msgId))
+		return -1
+	}
+
+	// delete message
+	_, err := client.SendMessage(context.Background(), chatJid, client.BuildRevoke(chatJid, senderJid, msgId),
+		whatsmeow.SendRequestExtra{Peer: false, Timeout: 3 * time.Second})
+
+	// log any error
 	if err != nil {
-		LOG_WARNING(fmt.Sprintf("failed to connect %#v", err))
-		CWmClearStatus(FlagConnecting)
+		LOG_WARNING(fmt.Sprintf("delete message error %#v", err))
 		return -1
+	} else {
+		LOG_TRACE(fmt.Sprintf("delete message ok %#v", msgId))
 	}
 
-	LOG_DEBUG("connect ok")
+	return 0
+}
 
-	// wait for result (up to timeout, 100 ms at a time)
-	LOG_DEBUG("wait start")
-	waitedMs := 0
-	for (waitedMs < timeoutMs) && (GetState(connId) == Connecting) {
-		time.Sleep(100 * time.Millisecond)
-		waitedMs += 100
+func WmDeleteChat(connId int, chatId string) int {
+
+	LOG_TRACE("delete chat " + strconv.Itoa(connId) + ", " + chatId)
+
+	// sanity check arg
+	if connId == -1 {
+		LOG_WARNING("invalid connId")
+		return -1
 	}
-	LOG_DEBUG("wait done")
 
-	// delete temporary image file
-	_ = os.Remove(path + "/tmp/qr.png")
+	// get client
+	client := GetClient(connId)
 
-	// log error on stdout
-	if GetState(connId) != Connected {
-		LOG_WARNING(fmt.Sprintf("state not connected %#v", GetState(connId)))
+	// get chat jid
+	chatJid, _ := types.ParseJID(chatId)
 
-		LOG_TRACE(fmt.Sprintf("acquire console"))
-		CWmSetProtocolUiControl(connId, 1)
+	// leave / delete
+	if chatJid.Server == types.GroupServer {
+		// if group, exit it
+		err := client.LeaveGroup(chatJid)
 
-		fmt.Printf("\n")
-		if GetState(connId) == Outdated {
-			fmt.Printf("ERROR:\n")
-			fmt.Printf("WhatsApp client is outdated, please update nchat to a newer version. See:\n")
-			fmt.Printf("https://github.com/d99kris/nchat/blob/master/doc/WMOUTDATED.md\n")
+		// log any error
+		if err != nil {
+			LOG_WARNING(fmt.Sprintf("leave group error %s %#v", chatId, err))
+			return -1
 		} else {
-			fmt.Printf("ERROR:\n")
-			fmt.Printf("Please see the log for details.\n")
+			LOG_TRACE(fmt.Sprintf("leave group ok (but not deleted) %s", chatId))
 		}
-		fmt.Printf("\n")
-
-		LOG_TRACE(fmt.Sprintf("release console"))
-		CWmSetProtocolUiControl(connId, 0)
-
-		CWmClearStatus(FlagConnecting)
-		return -1
+	} else {
+		// if private, log warning (function not supported by underlying library)
+		LOG_WARNING(fmt.Sprintf("delete chat not supported %s", chatId))
 	}
 
-	LOG_DEBUG("login ok")
 	return 0
 }
 
-func WmLogout(connId int) int {
+func WmSendTyping(connId int, chatId string, isTyping int) int {
 
-	LOG_DEBUG("logout " + strconv.Itoa(connId))
+	LOG_TRACE("send typing " + strconv.Itoa(connId) + ", " + chatId + ", " + strconv.Itoa(isTyping))
 
 	// sanity check arg
 	if connId == -1 {
@@ -1892,38 +5629,41 @@ func WmLogout(connId int) int {
 	}
 
 	// get client
-	var client *whatsmeow.Client = GetClient(connId)
-
-	// disconnect
-	client.Disconnect()
+	client := GetClient(connId)
 
-	// set state
-	SetState(connId, Disconnected)
+	// do not send typing to self chat
+	selfId := JidToStr(*client.Store.ID)
+	if chatId == selfId {
+		return 0
+	}
 
-	LOG_DEBUG("logout ok")
+	// set presence
+	var chatPresence types.ChatPresence = types.ChatPresencePaused
+	var chatPresenceMedia types.ChatPresenceMedia = types.ChatPresenceMediaText
+	if isTyping == TypingText {
+		chatPresence = types.ChatPresenceComposing
+	} else if isTyping == TypingAudio {
+		chatPresence = types.ChatPresenceComposing
+		chatPresenceMedia = types.ChatPresenceMediaAudio
+	}
 
-	return 0
-}
+	chatJid, _ := types.ParseJID(chatId)
+	err := client.SendChatPresence(chatJid, chatPresence, chatPresenceMedia)
 
-func WmCleanup(connId int) int {
+	// log any error
+	if err != nil {
+		LOG_WARNING(fmt.Sprintf("send typing error %#v", err))
+		return -1
+	} else {
+		LOG_TRACE(fmt.Sprintf("send typing ok"))
+	}
 
-	LOG_DEBUG("cleanup " + strconv.Itoa(connId))
-	RemoveConn(connId)
 	return 0
 }
 
-func WmGetVersion() int {
-	return whatsmeowDate
-}
-
-func WmGetMessages(connId int, chatId string, limit int, fromMsgId string, owner int) int {
-	// not supported in multi-device
-	return -1
-}
-
-func WmSendMessage(connId int, chatId string, text string, quotedId string, quotedText string, quotedSender string, filePath string, fileType string, editMsgId string, editMsgSent int) int {
+func WmSendStatus(connId int, isOnline int) int {
 
-	LOG_TRACE("send message " + strconv.Itoa(connId) + ", " + chatId + ", " + text + ", " + quotedId + ", " + filePath + ", " + editMsgId)
+	LOG_TRACE("send status " + strconv.Itoa(connId) + ", " + strconv.Itoa(isOnline))
 
 	// sanity check arg
 	if connId == -1 {
@@ -1931,228 +5671,139 @@ func WmSendMessage(connId int, chatId string, text string, quotedId string, quot
 		return -1
 	}
 
-	// get conn
-	var client *whatsmeow.Client = GetClient(connId)
-
-	// local vars
-	var sendErr error
-	var message waE2E.Message
-	var sendResponse whatsmeow.SendResponse
+	// get client
+	client := GetClient(connId)
 
-	// recipient
-	chatJid, jidErr := types.ParseJID(chatId)
-	if jidErr != nil {
-		LOG_WARNING(fmt.Sprintf("jid err %#v", jidErr))
+	// bail out if no push name
+	if len(client.Store.PushName) == 0 {
+		LOG_WARNING("tmp")
 		return -1
 	}
 
-	isSend := false
-
-	// quote context
-	contextInfo := waE2E.ContextInfo{}
-	if len(quotedId) > 0 {
-		quotedMessage := waE2E.Message{
-			Conversation: &quotedText,
-		}
-
-		quotedSender = strings.Replace(quotedSender, "@c.us", "@s.whatsapp.net", 1)
-
-		LOG_TRACE("send quoted " + quotedId + ", " + quotedText + ", " + quotedSender)
-		contextInfo = waE2E.ContextInfo{
-			QuotedMessage: &quotedMessage,
-			StanzaID:      &quotedId,
-			Participant:   &quotedSender,
-		}
+	// set presence
+	var presence types.Presence = types.PresenceUnavailable
+	if isOnline == 1 {
+		presence = types.PresenceAvailable
 	}
 
-	// check message type
-	if len(filePath) == 0 {
-
-		// text message
-		extendedTextMessage := waE2E.ExtendedTextMessage{
-			Text:        &text,
-			ContextInfo: &contextInfo,
-		}
-
-		message.ExtendedTextMessage = &extendedTextMessage
-
-		isSend = true
+	err := client.SendPresence(presence)
+	if err != nil {
+		LOG_WARNING("Failed to send presence")
 	} else {
+		LOG_TRACE("Sent presence ok")
+		if isOnline == 1 {
+			CWmClearStatus(FlagAway)
+		} else {
+			CWmSetStatus(FlagAway)
+		}
+	}
 
-		var isSendType bool = IntToBool(GetSendType(connId))
-
-		mimeType := strings.Split(fileType, "/")[0] // image, text, application, etc.
-		if isSendType && (mimeType == "audio") {
-			LOG_TRACE("send audio " + fileType)
-
-			data, err := os.ReadFile(filePath)
-			if err != nil {
-				LOG_WARNING(fmt.Sprintf("read file %s err %#v", filePath, err))
-				return -1
-			}
-
-			uploaded, upErr := client.Upload(context.Background(), data, whatsmeow.MediaAudio)
-			if upErr != nil {
-				LOG_WARNING(fmt.Sprintf("upload error %#v", upErr))
-				return -1
-			}
-
-			audioMessage := waE2E.AudioMessage{
-				URL:           proto.String(uploaded.URL),
-				DirectPath:    proto.String(uploaded.DirectPath),
-				MediaKey:      uploaded.MediaKey,
-				Mimetype:      proto.String(fileType),
-				FileEncSHA256: uploaded.FileEncSHA256,
-				FileSHA256:    uploaded.FileSHA256,
-				FileLength:    proto.Uint64(uint64(len(data))),
-				ContextInfo:   &contextInfo,
-			}
+	return 0
+}
 
-			message.AudioMessage = &audioMessage
+func WmDownloadFile(connId int, chatId string, msgId string, fileId string, senderId string, isFromMe int, action int) int {
 
-			isSend = true
-		} else if isSendType && (mimeType == "video") {
-			LOG_TRACE("send video " + fileType)
+	LOG_TRACE("download file " + strconv.Itoa(connId) + ", " + chatId + ", " + msgId + ", " + fileId)
 
-			data, err := os.ReadFile(filePath)
-			if err != nil {
-				LOG_WARNING(fmt.Sprintf("read file %s err %#v", filePath, err))
-				return -1
-			}
+	// sanity check arg
+	if connId == -1 {
+		LOG_WARNING("invalid connId")
+		return -1
+	}
 
-			uploaded, upErr := client.Upload(context.Background(), data, whatsmeow.MediaVideo)
-			if upErr != nil {
-				LOG_WARNING(fmt.Sprintf("upload error %#v", upErr))
-				return -1
-			}
+	// download file
+	filePath, fileStatus, newFileId := DownloadFromFileId(connId, chatId, msgId, senderId, IntToBool(isFromMe), fileId)
 
-			videoMessage := waE2E.VideoMessage{
-				Caption:       proto.String(text),
-				URL:           proto.String(uploaded.URL),
-				DirectPath:    proto.String(uploaded.DirectPath),
-				MediaKey:      uploaded.MediaKey,
-				Mimetype:      proto.String(fileType),
-				FileEncSHA256: uploaded.FileEncSHA256,
-				FileSHA256:    uploaded.FileSHA256,
-				FileLength:    proto.Uint64(uint64(len(data))),
-				ContextInfo:   &contextInfo,
-			}
+	// resume interrupted download upon reconnect
+	if fileStatus == FileStatusDownloading {
+		LOG_DEBUG("download interrupted, resume upon reconnect " + msgId)
+		AddPendingDownload(connId, PendingDownload{chatId, msgId, newFileId, action})
+		return 0
+	}
 
-			message.VideoMessage = &videoMessage
+	RemovePendingDownload(connId, msgId)
 
-			isSend = true
-		} else if isSendType && (mimeType == "image") {
-			LOG_TRACE("send image " + fileType)
+	// notify result
+	thumbPath := GetCachedThumbnail(connId, msgId)
+	CWmNewMessageFileNotify(connId, chatId, msgId, newFileId, filePath, thumbPath, fileStatus, action)
 
-			data, err := os.ReadFile(filePath)
-			if err != nil {
-				LOG_WARNING(fmt.Sprintf("read file %s err %#v", filePath, err))
-				return -1
-			}
+	return 0
+}
 
-			uploaded, upErr := client.Upload(context.Background(), data, whatsmeow.MediaImage)
-			if upErr != nil {
-				LOG_WARNING(fmt.Sprintf("upload error %#v", upErr))
-				return -1
-			}
+func WmSendReaction(connId int, chatId string, senderId string, msgId string, emoji string) int {
 
-			imageMessage := waE2E.ImageMessage{
-				Caption:       proto.String(text),
-				URL:           proto.String(uploaded.URL),
-				DirectPath:    proto.String(uploaded.DirectPath),
-				MediaKey:      uploaded.MediaKey,
-				Mimetype:      proto.String(fileType),
-				FileEncSHA256: uploaded.FileEncSHA256,
-				FileSHA256:    uploaded.FileSHA256,
-				FileLength:    proto.Uint64(uint64(len(data))),
-				ContextInfo:   &contextInfo,
-			}
+	LOG_TRACE("send reaction " + strconv.Itoa(connId) + ", " + chatId + ", " + msgId + ", \"" + emoji + "\"")
 
-			message.ImageMessage = &imageMessage
+	// sanity check arg
+	if connId == -1 {
+		LOG_WARNING("invalid connId")
+		return -1
+	}
 
-			isSend = true
-		} else {
-			LOG_TRACE("send document " + fileType)
+	// get client
+	client := GetClient(connId)
 
-			data, err := os.ReadFile(filePath)
-			if err != nil {
-				LOG_WARNING(fmt.Sprintf("read file %s err %#v", filePath, err))
-				return -1
-			}
+	// send reaction
+	chatJid, _ := types.ParseJID(chatId)
+	senderJid, _ := types.ParseJID(senderId)
+	_, sendErr :=
+		client.SendMessage(context.Background(), chatJid, client.BuildReaction(chatJid, senderJid, msgId, emoji))
 
-			uploaded, upErr := client.Upload(context.Background(), data, whatsmeow.MediaDocument)
-			if upErr != nil {
-				LOG_WARNING(fmt.Sprintf("upload error %#v", upErr))
-				return -1
-			}
+	if sendErr != nil {
+		LOG_WARNING(fmt.Sprintf("send reaction error %#v", sendErr))
+		return -1
+	} else {
+		LOG_TRACE(fmt.Sprintf("send reaction ok"))
+		fromMe := true
+		GetHandler(connId).HandleReaction(chatId, msgId, senderId, fromMe, emoji)
+	}
 
-			fileName := filepath.Base(filePath)
+	return 0
+}
 
-			documentMessage := waE2E.DocumentMessage{
-				Caption:       proto.String(text),
-				URL:           proto.String(uploaded.URL),
-				DirectPath:    proto.String(uploaded.DirectPath),
-				MediaKey:      uploaded.MediaKey,
-				Mimetype:      proto.String(fileType),
-				FileEncSHA256: uploaded.FileEncSHA256,
-				FileSHA256:    uploaded.FileSHA256,
-				FileLength:    proto.Uint64(uint64(len(data))),
-				FileName:      proto.String(fileName),
-				ContextInfo:   &contextInfo,
-			}
+func WmSetBlocked(connId int, userId string, isBlocked int) int {
 
-			message.DocumentMessage = &documentMessage
+	LOG_TRACE("set blocked " + strconv.Itoa(connId) + ", " + userId + ", " + strconv.Itoa(isBlocked))
 
-			isSend = true
-		}
+	// sanity check arg
+	if connId == -1 {
+		LOG_WARNING("invalid connId")
+		return -1
 	}
 
-	if isSend {
-
-		if len(editMsgId) > 0 {
-			// edit message
-			sendResponse, sendErr =
-				client.SendMessage(context.Background(), chatJid, client.BuildEdit(chatJid, editMsgId, &message))
+	// get client
+	client := GetClient(connId)
 
-		} else {
-			// send message
-			sendResponse, sendErr = client.SendMessage(context.Background(), chatJid, &message)
+	// get user
+	userJid, jidErr := types.ParseJID(userId)
+	if jidErr != nil {
+		LOG_WARNING(fmt.Sprintf("jid err %#v", jidErr))
+		return -1
+	}
 
-		}
+	// block / unblock
+	var action events.BlocklistChangeAction = events.BlocklistChangeActionUnblock
+	if isBlocked == 1 {
+		action = events.BlocklistChangeActionBlock
 	}
 
+	blocklist, err := client.UpdateBlocklist(userJid, action)
+
 	// log any error
-	if sendErr != nil {
-		LOG_WARNING(fmt.Sprintf("send message error %#v", sendErr))
+	if err != nil {
+		LOG_WARNING(fmt.Sprintf("set blocked error %#v", err))
 		return -1
 	} else {
-		LOG_TRACE(fmt.Sprintf("send message ok"))
-
-		// messageInfo
-		var messageInfo types.MessageInfo
-		messageInfo.Chat = chatJid
-		messageInfo.IsFromMe = true
-		messageInfo.Sender = *client.Store.ID
-
-		if len(editMsgId) > 0 {
-			messageInfo.ID = editMsgId
-			messageInfo.Timestamp = time.Unix(int64(editMsgSent), 0)
-		} else {
-			messageInfo.ID = sendResponse.ID
-			messageInfo.Timestamp = sendResponse.Timestamp
-		}
-
-		isSyncRead := false
-		handler := GetHandler(connId)
-		handler.HandleMessage(messageInfo, &message, isSyncRead)
+		LOG_TRACE(fmt.Sprintf("set blocked ok"))
+		UpdateBlocklist(connId, blocklist)
 	}
 
 	return 0
 }
 
-func WmGetStatus(connId int, userId string) int {
+func WmGetPrivacySettings(connId int) int {
 
-	LOG_TRACE("get status " + strconv.Itoa(connId) + ", " + userId)
+	LOG_TRACE("get privacy settings " + strconv.Itoa(connId))
 
 	// sanity check arg
 	if connId == -1 {
@@ -2163,34 +5814,24 @@ func WmGetStatus(connId int, userId string) int {
 	// get client
 	client := GetClient(connId)
 
-	// get user
-	userJid, _ := types.ParseJID(userId)
-	if userJid.Server == types.GroupServer {
-		// ignore presence requests for groups
-		return -1
-	}
-
-	// subscribe user presence
-	err := client.SubscribePresence(userJid)
+	// fetch from server
+	settings, err := client.TryFetchPrivacySettings(true)
 
 	// log any error
 	if err != nil {
-		LOG_WARNING(fmt.Sprintf("get user status error %#v", err))
+		LOG_WARNING(fmt.Sprintf("get privacy settings error %#v", err))
 		return -1
 	} else {
-		LOG_TRACE(fmt.Sprintf("get user status ok"))
+		LOG_TRACE(fmt.Sprintf("get privacy settings ok %#v", settings))
+		NotifyPrivacySettings(connId, settings)
 	}
 
 	return 0
 }
 
-func WmMarkMessageRead(connId int, chatId string, senderId string, msgId string) int {
-	name := os.Getenv("NCHAT_NO_READ")
-	if name == "YES" {
-		return 0
-	} 
+func WmSetPrivacySetting(connId int, name string, value string) int {
 
-	LOG_TRACE("mark message read " + strconv.Itoa(connId) + ", " + chatId + ", " + senderId + ", " + msgId)
+	LOG_TRACE("set privacy setting " + strconv.Itoa(connId) + ", " + name + ", " + value)
 
 	// sanity check arg
 	if connId == -1 {
@@ -2198,35 +5839,61 @@ func WmMarkMessageRead(connId int, chatId string, senderId string, msgId string)
 		return -1
 	}
 
+	settingName := types.PrivacySettingType(name)
+	settingValue := types.PrivacySetting(value)
+	if !IsValidPrivacySetting(settingName, settingValue) {
+		LOG_WARNING(fmt.Sprintf("invalid privacy setting %s %s", name, value))
+		return -1
+	}
+
 	// get client
 	client := GetClient(connId)
 
-	// mark read
-	msgIds := []types.MessageID{
-		msgId,
+	// set privacy setting
+	_, err := client.SetPrivacySetting(settingName, settingValue)
+
+	// log any error
+	if err != nil {
+		LOG_WARNING(fmt.Sprintf("set privacy setting error %#v", err))
+		return -1
+	} else {
+		LOG_TRACE(fmt.Sprintf("set privacy setting ok"))
+		NotifyPrivacySetting(connId, settingName, settingValue)
 	}
-	timeRead := time.Now()
-	chatJid, _ := types.ParseJID(chatId)
-	senderJid, _ := types.ParseJID(senderId)
-	err := client.MarkRead(msgIds, timeRead, chatJid, senderJid)
 
-	// store time
-	SetTimeRead(connId, chatId, timeRead)
+	return 0
+}
+
+func WmGetProfilePicture(connId int, chatId string) int {
+
+	LOG_TRACE("get profile picture " + strconv.Itoa(connId) + ", " + chatId)
+
+	// sanity check arg
+	if connId == -1 {
+		LOG_WARNING("invalid connId")
+		return -1
+	}
+
+	// download picture
+	CWmSetStatus(FlagFetching)
+	filePath, err := DownloadProfilePicture(connId, chatId)
+	CWmClearStatus(FlagFetching)
 
 	// log any error
 	if err != nil {
-		LOG_WARNING(fmt.Sprintf("mark message read error %#v", err))
+		LOG_WARNING(fmt.Sprintf("get profile picture error %#v", err))
 		return -1
 	} else {
-		LOG_TRACE(fmt.Sprintf("mark message read ok %#v", msgId))
+		LOG_TRACE(fmt.Sprintf("get profile picture ok %s", filePath))
+		NotifyProfilePicture(connId, chatId, filePath)
 	}
 
 	return 0
 }
 
-func WmDeleteMessage(connId int, chatId string, senderId string, msgId string) int {
+func WmGetSelfProfile(connId int) int {
 
-	LOG_TRACE("delete message " + strconv.Itoa(connId) + ", " + chatId + ", " + msgId)
+	LOG_TRACE("get self profile " + strconv.Itoa(connId))
 
 	// sanity check arg
 	if connId == -1 {
@@ -2236,38 +5903,76 @@ func WmDeleteMessage(connId int, chatId string, senderId string, msgId string) i
 
 	// get client
 	client := GetClient(connId)
+	selfJid := client.Store.ID.ToNonAD()
+	selfId := JidToStr(selfJid)
 
-	chatJid, _ := types.ParseJID(chatId)
-	senderJid, _ := types.ParseJID(senderId)
+	// push name
+	pushName := client.Store.PushName
+	LOG_TRACE(fmt.Sprintf("Call CWmUpdateSelfProfileNotify pushname %s", pushName))
+	CWmUpdateSelfProfileNotify(connId, ProfileKeyPushName, pushName)
 
-	// skip deleting messages sent by others in private chat
-	selfId := JidToStr(*client.Store.ID)
-	isGroup := (chatJid.Server == types.GroupServer)
-	isFromSelf := (senderId == selfId)
-	if !isFromSelf && !isGroup {
-		LOG_TRACE(fmt.Sprintf("delete message isGroup %t isFromSelf %t skip %#v",
-			isGroup, isFromSelf, msgId))
+	// about
+	userInfos, err := client.GetUserInfo([]types.JID{selfJid})
+	if err != nil {
+		LOG_WARNING(fmt.Sprintf("get user info error %#v", err))
 		return -1
 	}
 
-	// delete message
-	_, err := client.SendMessage(context.Background(), chatJid, client.BuildRevoke(chatJid, senderJid, msgId),
-		whatsmeow.SendRequestExtra{Peer: false, Timeout: 3 * time.Second})
+	if userInfo, ok := userInfos[selfJid]; ok {
+		LOG_TRACE(fmt.Sprintf("Call CWmUpdateSelfProfileNotify about %s", userInfo.Status))
+		CWmUpdateSelfProfileNotify(connId, ProfileKeyAbout, userInfo.Status)
+	}
+
+	// profile picture
+	filePath, err := DownloadProfilePicture(connId, selfId)
+	if err != nil {
+		LOG_WARNING(fmt.Sprintf("get profile picture error %#v", err))
+		return -1
+	}
+
+	NotifyProfilePicture(connId, selfId, filePath)
+
+	LOG_TRACE(fmt.Sprintf("get self profile ok"))
+
+	return 0
+}
+
+func WmSetPushName(connId int, pushName string) int {
+
+	LOG_TRACE("set push name " + strconv.Itoa(connId) + ", " + pushName)
+
+	// sanity check arg
+	if connId == -1 {
+		LOG_WARNING("invalid connId")
+		return -1
+	}
+
+	if len(pushName) == 0 {
+		LOG_WARNING("empty push name")
+		return -1
+	}
+
+	// get client
+	client := GetClient(connId)
+
+	// send app state patch
+	err := client.SendAppState(appstate.BuildSettingPushName(pushName))
 
 	// log any error
 	if err != nil {
-		LOG_WARNING(fmt.Sprintf("delete message error %#v", err))
+		LOG_WARNING(fmt.Sprintf("set push name error %#v", err))
 		return -1
 	} else {
-		LOG_TRACE(fmt.Sprintf("delete message ok %#v", msgId))
+		LOG_TRACE(fmt.Sprintf("set push name ok"))
+		CWmUpdateSelfProfileNotify(connId, ProfileKeyPushName, pushName)
 	}
 
 	return 0
 }
 
-func WmDeleteChat(connId int, chatId string) int {
+func WmSetAbout(connId int, about string) int {
 
-	LOG_TRACE("delete chat " + strconv.Itoa(connId) + ", " + chatId)
+	LOG_TRACE("set about " + strconv.Itoa(connId) + ", " + about)
 
 	// sanity check arg
 	if connId == -1 {
@@ -2278,32 +5983,24 @@ func WmDeleteChat(connId int, chatId string) int {
 	// get client
 	client := GetClient(connId)
 
-	// get chat jid
-	chatJid, _ := types.ParseJID(chatId)
-
-	// leave / delete
-	if chatJid.Server == types.GroupServer {
-		// if group, exit it
-		err := client.LeaveGroup(chatJid)
+	// set status message
+	err := client.SetStatusMessage(about)
 
-		// log any error
-		if err != nil {
-			LOG_WARNING(fmt.Sprintf("leave group error %s %#v", chatId, err))
-			return -1
-		} else {
-			LOG_TRACE(fmt.Sprintf("leave group ok (but not deleted) %s", chatId))
-		}
+	// log any error
+	if err != nil {
+		LOG_WARNING(fmt.Sprintf("set about error %#v", err))
+		return -1
 	} else {
-		// if private, log warning (function not supported by underlying library)
-		LOG_WARNING(fmt.Sprintf("delete chat not supported %s", chatId))
+		LOG_TRACE(fmt.Sprintf("set about ok"))
+		CWmUpdateSelfProfileNotify(connId, ProfileKeyAbout, about)
 	}
 
 	return 0
 }
 
-func WmSendTyping(connId int, chatId string, isTyping int) int {
+func WmSetSelfProfilePicture(connId int, filePath string) int {
 
-	LOG_TRACE("send typing " + strconv.Itoa(connId) + ", " + chatId + ", " + strconv.Itoa(isTyping))
+	LOG_TRACE("set self profile picture " + strconv.Itoa(connId) + ", " + filePath)
 
 	// sanity check arg
 	if connId == -1 {
@@ -2313,37 +6010,47 @@ func WmSendTyping(connId int, chatId string, isTyping int) int {
 
 	// get client
 	client := GetClient(connId)
+	selfId := JidToStr(client.Store.ID.ToNonAD())
 
-	// do not send typing to self chat
-	selfId := JidToStr(*client.Store.ID)
-	if chatId == selfId {
-		return 0
-	}
+	// read picture, empty path removes current picture
+	var data []byte = nil
+	if len(filePath) > 0 {
+		jpegData, err := ImageFileToProfilePicture(filePath)
+		if err != nil {
+			LOG_WARNING(fmt.Sprintf("read picture %s err %#v", filePath, err))
+			return -1
+		}
 
-	// set presence
-	var chatPresence types.ChatPresence = types.ChatPresencePaused
-	if isTyping == 1 {
-		chatPresence = types.ChatPresenceComposing
+		data = jpegData
 	}
 
-	var chatPresenceMedia types.ChatPresenceMedia = types.ChatPresenceMediaText
-	chatJid, _ := types.ParseJID(chatId)
-	err := client.SendChatPresence(chatJid, chatPresence, chatPresenceMedia)
+	// empty jid targets own profile
+	pictureId, err := client.SetGroupPhoto(types.EmptyJID, data)
 
 	// log any error
 	if err != nil {
-		LOG_WARNING(fmt.Sprintf("send typing error %#v", err))
+		LOG_WARNING(fmt.Sprintf("set self profile picture error %#v", err))
 		return -1
 	} else {
-		LOG_TRACE(fmt.Sprintf("send typing ok"))
+		LOG_TRACE(fmt.Sprintf("set self profile picture ok %s", pictureId))
+		RemoveProfilePicture(connId, selfId)
+		if data != nil {
+			newPath := ProfilePicturePath(connId, selfId, pictureId)
+			if writeErr := os.WriteFile(newPath, data, 0644); writeErr == nil {
+				SetPictureId(connId, selfId, pictureId)
+				NotifyProfilePicture(connId, selfId, newPath)
+			}
+		} else {
+			NotifyProfilePicture(connId, selfId, "")
+		}
 	}
 
 	return 0
 }
 
-func WmSendStatus(connId int, isOnline int) int {
+func WmGetUserDetails(connId int, userId string) int {
 
-	LOG_TRACE("send status " + strconv.Itoa(connId) + ", " + strconv.Itoa(isOnline))
+	LOG_TRACE("get user details " + strconv.Itoa(connId) + ", " + userId)
 
 	// sanity check arg
 	if connId == -1 {
@@ -2354,36 +6061,72 @@ func WmSendStatus(connId int, isOnline int) int {
 	// get client
 	client := GetClient(connId)
 
-	// bail out if no push name
-	if len(client.Store.PushName) == 0 {
-		LOG_WARNING("tmp")
+	// get user
+	userJid, jidErr := types.ParseJID(userId)
+	if jidErr != nil {
+		LOG_WARNING(fmt.Sprintf("jid err %#v", jidErr))
 		return -1
 	}
 
-	// set presence
-	var presence types.Presence = types.PresenceUnavailable
-	if isOnline == 1 {
-		presence = types.PresenceAvailable
+	if userJid.Server != types.DefaultUserServer {
+		LOG_TRACE(fmt.Sprintf("ignore user details request for %s", userId))
+		return -1
 	}
 
-	err := client.SendPresence(presence)
+	// user info
+	userInfos, err := client.GetUserInfo([]types.JID{userJid})
 	if err != nil {
-		LOG_WARNING("Failed to send presence")
-	} else {
-		LOG_TRACE("Sent presence ok")
-		if isOnline == 1 {
-			CWmClearStatus(FlagAway)
+		LOG_WARNING(fmt.Sprintf("get user info error %#v", err))
+		return -1
+	}
+
+	userInfo, ok := userInfos[userJid]
+	if !ok {
+		LOG_WARNING(fmt.Sprintf("user info missing %s", userId))
+		return -1
+	}
+
+	about := userInfo.Status
+	verifiedName := ""
+	if userInfo.VerifiedName != nil {
+		verifiedName = userInfo.VerifiedName.Details.GetVerifiedName()
+	}
+
+	deviceCount := len(userInfo.Devices)
+
+	// business profile
+	isBusiness := (userInfo.VerifiedName != nil)
+	address := ""
+	email := ""
+	categories := ""
+	businessHours := ""
+	if isBusiness {
+		businessProfile, bizErr := client.GetBusinessProfile(userJid)
+		if bizErr != nil {
+			LOG_WARNING(fmt.Sprintf("get business profile error %#v", bizErr))
 		} else {
-			CWmSetStatus(FlagAway)
+			address = businessProfile.Address
+			email = businessProfile.Email
+
+			var categoryNames []string
+			for _, category := range businessProfile.Categories {
+				categoryNames = append(categoryNames, category.Name)
+			}
+
+			categories = strings.Join(categoryNames, ", ")
+			businessHours = FormatBusinessHours(businessProfile.BusinessHours)
 		}
 	}
 
+	LOG_TRACE(fmt.Sprintf("Call CWmNewUserDetailsNotify %s", userId))
+	CWmNewUserDetailsNotify(connId, userId, about, verifiedName, deviceCount, BoolToInt(isBusiness), address, email, categories, businessHours)
+
 	return 0
 }
 
-func WmDownloadFile(connId int, chatId string, msgId string, fileId string, action int) int {
+func WmLookupPhones(connId int, phones string) int {
 
-	LOG_TRACE("download file " + strconv.Itoa(connId) + ", " + chatId + ", " + msgId + ", " + fileId)
+	LOG_TRACE("lookup phones " + strconv.Itoa(connId) + ", " + phones)
 
 	// sanity check arg
 	if connId == -1 {
@@ -2394,18 +6137,99 @@ func WmDownloadFile(connId int, chatId string, msgId string, fileId string, acti
 	// get client
 	client := GetClient(connId)
 
-	// download file
-	filePath, fileStatus := DownloadFromFileId(client, fileId)
+	// normalize phone numbers, separated by comma, semicolon or newline
+	var queries []string
+	originals := make(map[string]string)
+	fields := strings.FieldsFunc(phones, func(r rune) bool {
+		return (r == ',') || (r == ';') || (r == '\n')
+	})
+	for _, field := range fields {
+		phone := NormalizePhone(field)
+		if len(phone) == 0 {
+			LOG_WARNING(fmt.Sprintf("invalid phone number \"%s\"", field))
+			CWmLookupPhoneNotify(connId, strings.TrimSpace(field), "", "", BoolToInt(false))
+			continue
+		}
 
-	// notify result
-	CWmNewMessageFileNotify(connId, chatId, msgId, filePath, fileStatus, action)
+		queries = append(queries, phone)
+		originals[strings.TrimPrefix(phone, "+")] = phone
+	}
+
+	if len(queries) == 0 {
+		LOG_WARNING("no valid phone numbers")
+		return -1
+	}
+
+	// check registration
+	responses, err := client.IsOnWhatsApp(queries)
+	if err != nil {
+		LOG_WARNING(fmt.Sprintf("lookup phones error %#v", err))
+		errorMessage := fmt.Sprintf("Failed to look up phone number (%s), please check the network connection.", err.Error())
+		LOG_TRACE(fmt.Sprintf("Call CWmErrorNotify %s", errorMessage))
+		CWmErrorNotify(connId, errorMessage)
+		return -1
+	}
+
+	for _, response := range responses {
+		phone, ok := originals[strings.TrimPrefix(response.Query, "+")]
+		if !ok {
+			phone = response.Query
+		}
+
+		if !response.IsIn {
+			LOG_TRACE(fmt.Sprintf("Call CWmLookupPhoneNotify %s not registered", phone))
+			CWmLookupPhoneNotify(connId, phone, "", "", BoolToInt(false))
+			continue
+		}
+
+		userId := JidToStr(response.JID.ToNonAD())
+		verifiedName := ""
+		if response.VerifiedName != nil {
+			verifiedName = response.VerifiedName.Details.GetVerifiedName()
+		}
+
+		// add as contact if not already known, to make chat usable right away
+		name := verifiedName
+		if len(name) == 0 {
+			name = phone
+		}
+
+		AddUnknownContact(connId, userId, name)
+
+		LOG_TRACE(fmt.Sprintf("Call CWmLookupPhoneNotify %s %s", phone, userId))
+		CWmLookupPhoneNotify(connId, phone, userId, verifiedName, BoolToInt(true))
+	}
 
 	return 0
 }
 
-func WmSendReaction(connId int, chatId string, senderId string, msgId string, emoji string) int {
+func WmResolveLinks(connId int, text string) int {
 
-	LOG_TRACE("send reaction " + strconv.Itoa(connId) + ", " + chatId + ", " + msgId + ", \"" + emoji + "\"")
+	LOG_TRACE("resolve links " + strconv.Itoa(connId) + ", " + text)
+
+	// sanity check arg
+	if connId == -1 {
+		LOG_WARNING("invalid connId")
+		return -1
+	}
+
+	// resolve
+	chatId := ""
+	msgId := ""
+	count := ResolveWaLinks(connId, chatId, msgId, text)
+	if count == 0 {
+		LOG_WARNING("no links resolved")
+		return -1
+	}
+
+	LOG_TRACE(fmt.Sprintf("resolve links ok %d", count))
+
+	return 0
+}
+
+func WmGetContactQrLink(connId int, revoke int, show int) int {
+
+	LOG_TRACE("get contact qr link " + strconv.Itoa(connId) + ", " + strconv.Itoa(revoke) + ", " + strconv.Itoa(show))
 
 	// sanity check arg
 	if connId == -1 {
@@ -2416,20 +6240,29 @@ func WmSendReaction(connId int, chatId string, senderId string, msgId string, em
 	// get client
 	client := GetClient(connId)
 
-	// send reaction
-	chatJid, _ := types.ParseJID(chatId)
-	senderJid, _ := types.ParseJID(senderId)
-	_, sendErr :=
-		client.SendMessage(context.Background(), chatJid, client.BuildReaction(chatJid, senderJid, msgId, emoji))
-
-	if sendErr != nil {
-		LOG_WARNING(fmt.Sprintf("send reaction error %#v", sendErr))
+	// get link code
+	code, err := client.GetContactQRLink(IntToBool(revoke))
+	if err != nil {
+		LOG_WARNING(fmt.Sprintf("get contact qr link error %#v", err))
 		return -1
-	} else {
-		LOG_TRACE(fmt.Sprintf("send reaction ok"))
-		fromMe := true //messageInfo.IsFromMe
-		CWmNewMessageReactionNotify(connId, chatId, msgId, senderId, emoji, BoolToInt(fromMe))
 	}
 
+	link := "https://wa.me/qr/" + code
+	LOG_TRACE(fmt.Sprintf("get contact qr link ok %s", link))
+
+	// render in image viewer, console rendering is not possible as the ui owns it
+	// while the request is made, the link itself is always provided in the notify
+	if IntToBool(show) {
+		if HasGUI() {
+			qrPath := GetPath(connId) + "/tmp/contactqr.png"
+			ShowQrCode(link, qrPath, true)
+		} else {
+			LOG_DEBUG("no gui, skip showing contact qr code")
+		}
+	}
+
+	LOG_TRACE(fmt.Sprintf("Call CWmNewContactQrLinkNotify %s", link))
+	CWmNewContactQrLinkNotify(connId, link)
+
 	return 0
 }
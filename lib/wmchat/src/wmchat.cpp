@@ -21,6 +21,15 @@
 #include "strutil.h"
 #include "timeutil.h"
 
+// keep in sync with self profile keys in gowm.go
+static const std::string s_ProfileKeyPushName = "pushname";
+static const std::string s_ProfileKeyAbout = "about";
+static const std::string s_ProfileKeyPicture = "picture";
+static const std::string s_ProfileKeyContactQrLink = "contactqrlink";
+static const std::string s_ContactQrLinkShow = "show";
+static const std::string s_ContactQrLinkRevoke = "revoke";
+static const std::string s_PrivacyKeyPrefix = "privacy_";
+
 std::mutex WmChat::s_ConnIdMapMutex;
 std::map<int, WmChat*> WmChat::s_ConnIdMap;
 
@@ -52,7 +61,9 @@ std::string WmChat::GetProfileDisplayName() const
 
 bool WmChat::HasFeature(ProtocolFeature p_ProtocolFeature) const
 {
-  ProtocolFeature customFeatures = FeatureEditMessagesWithinFifteenMins;
+  static int customFeatures = FeatureEditMessagesWithinFifteenMins | FeatureStatusVisibleChats |
+    FeatureProfileSettings | FeatureProfilePictures | FeatureUserDetails | FeatureResolveLinks |
+    FeatureForwardMessages;
   return (p_ProtocolFeature & customFeatures);
 }
 
@@ -84,9 +95,8 @@ bool WmChat::SetupProfile(const std::string& p_ProfilesDir, std::string& p_Profi
 
   p_ProfileId = m_ProfileId;
 
-  std::string proxyUrl = GetProxyUrl();
   int32_t sendType = AppConfig::GetBool("attachment_send_type") ? 1 : 0;
-  int connId = CWmInit(const_cast<char*>(profileDir.c_str()), const_cast<char*>(proxyUrl.c_str()), sendType);
+  int connId = CWmInit(const_cast<char*>(profileDir.c_str()), sendType);
   if (connId == -1)
   {
     m_IsSetup = false;
@@ -131,9 +141,8 @@ bool WmChat::LoadProfile(const std::string& p_ProfilesDir, const std::string& p_
     FileUtil::RmDir(m_ProfileDir);
   }
 
-  std::string proxyUrl = GetProxyUrl();
   int32_t sendType = AppConfig::GetBool("attachment_send_type") ? 1 : 0;
-  m_ConnId = CWmInit(const_cast<char*>(m_ProfileDir.c_str()), const_cast<char*>(proxyUrl.c_str()), sendType);
+  m_ConnId = CWmInit(const_cast<char*>(m_ProfileDir.c_str()), sendType);
   if (m_ConnId == -1) return false;
 
   AddInstance(m_ConnId, this);
@@ -179,13 +188,35 @@ bool WmChat::CloseProfile()
 
 void WmChat::Init()
 {
+  const bool markdownEnabled = (m_Config.Get("markdown_enabled") == "1");
+  CWmSetMarkdownEnabled(m_ConnId, markdownEnabled ? 1 : 0);
+
+  const bool tombstonesEnabled = (m_Config.Get("tombstones_enabled") == "1");
+  CWmSetTombstonesEnabled(m_ConnId, tombstonesEnabled ? 1 : 0);
+
+  // media proxy defaults to the general proxy, "direct" disables any proxy for media
+  const std::string proxyUrl = GetProxyUrl();
+  const std::string mediaProxy = m_Config.Get("media_proxy_url");
+  const std::string mediaProxyUrl = mediaProxy.empty() ? proxyUrl : mediaProxy;
+  const bool proxyLoginOnly = (m_Config.Get("proxy_login_only") == "1");
+  int rv = CWmSetProxy(m_ConnId, const_cast<char*>(proxyUrl.c_str()), const_cast<char*>(mediaProxyUrl.c_str()),
+                       proxyLoginOnly ? 1 : 0);
+  m_ProxyError = (rv != 0);
+  if (m_ProxyError)
+  {
+    LOG_WARNING("failed to set proxy, check proxy settings");
+  }
 }
 
 void WmChat::InitConfig()
 {
   const std::map<std::string, std::string> defaultConfig =
   {
+    { "markdown_enabled", "0" },
+    { "media_proxy_url", "" },
     { "profile_display_name", "" },
+    { "proxy_login_only", "0" },
+    { "tombstones_enabled", "0" },
   };
   const std::string configPath(m_ProfileDir + std::string("/whatsappmd.conf"));
   m_Config = Config(configPath, defaultConfig);
@@ -202,6 +233,21 @@ void WmChat::CleanupConfig()
 
 bool WmChat::Login()
 {
+  // do not connect without the configured proxy
+  if (m_ProxyError)
+  {
+    LOG_WARNING("login aborted, invalid proxy settings");
+
+    std::shared_ptr<ConnErrorNotify> connErrorNotify = std::make_shared<ConnErrorNotify>(m_ProfileId);
+    connErrorNotify->message = "Unable to set proxy, please check the proxy settings.";
+    connErrorNotify->isReconnectable = false;
+
+    std::shared_ptr<DeferNotifyRequest> deferNotifyRequest = std::make_shared<DeferNotifyRequest>();
+    deferNotifyRequest->serviceMessage = connErrorNotify;
+    SendRequest(deferNotifyRequest);
+    return false;
+  }
+
   int rv = 0;
   if (!m_Running)
   {
@@ -387,6 +433,7 @@ void WmChat::PerformRequest(std::shared_ptr<RequestMessage> p_RequestMessage)
                          const_cast<char*>(fileType.c_str()), const_cast<char*>(editMsgId.c_str()),
                          editMsgSent);
         Status::Clear(Status::FlagSending);
+        Status::SetProgress(-1);
 
         std::shared_ptr<SendMessageNotify> sendMessageNotify = std::make_shared<SendMessageNotify>(m_ProfileId);
         sendMessageNotify->success = (rv == 0);
@@ -497,7 +544,8 @@ void WmChat::PerformRequest(std::shared_ptr<RequestMessage> p_RequestMessage)
         std::shared_ptr<SendTypingRequest> sendTypingRequest =
           std::static_pointer_cast<SendTypingRequest>(p_RequestMessage);
         std::string chatId = sendTypingRequest->chatId;
-        int32_t isTyping = sendTypingRequest->isTyping ? 1 : 0;
+        // keep in sync with typing states in gowm.go
+        int32_t isTyping = sendTypingRequest->isTyping ? (sendTypingRequest->isRecordingAudio ? 2 : 1) : 0;
 
         int rv = CWmSendTyping(m_ConnId, const_cast<char*>(chatId.c_str()), isTyping);
 
@@ -533,6 +581,15 @@ void WmChat::PerformRequest(std::shared_ptr<RequestMessage> p_RequestMessage)
           std::static_pointer_cast<CreateChatRequest>(p_RequestMessage);
         std::string userId = createChatRequest->userId;
 
+        if (userId.find("@") == std::string::npos)
+        {
+          // phone number, chat is created upon successful lookup
+          Status::Set(Status::FlagFetching);
+          CWmLookupPhones(m_ConnId, const_cast<char*>(userId.c_str()));
+          Status::Clear(Status::FlagFetching);
+          break;
+        }
+
         std::shared_ptr<CreateChatNotify> createChatNotify = std::make_shared<CreateChatNotify>(m_ProfileId);
         createChatNotify->success = true;
         createChatNotify->chatInfo.id = userId;
@@ -540,6 +597,22 @@ void WmChat::PerformRequest(std::shared_ptr<RequestMessage> p_RequestMessage)
       }
       break;
 
+    case DeferGetUserDetailsRequestType:
+      {
+        LOG_DEBUG("get user details");
+
+        std::shared_ptr<DeferGetUserDetailsRequest> deferGetUserDetailsRequest =
+          std::static_pointer_cast<DeferGetUserDetailsRequest>(p_RequestMessage);
+
+        Status::Set(Status::FlagFetching);
+        for (const auto& userId : deferGetUserDetailsRequest->userIds)
+        {
+          CWmGetUserDetails(m_ConnId, const_cast<char*>(userId.c_str()));
+        }
+        Status::Clear(Status::FlagFetching);
+      }
+      break;
+
     case DownloadFileRequestType:
       {
         std::shared_ptr<DownloadFileRequest> downloadFileRequest =
@@ -547,14 +620,19 @@ void WmChat::PerformRequest(std::shared_ptr<RequestMessage> p_RequestMessage)
         std::string chatId = downloadFileRequest->chatId;
         std::string msgId = downloadFileRequest->msgId;
         std::string fileId = downloadFileRequest->fileId;
+        std::string senderId = downloadFileRequest->senderId;
+        int isFromMe = downloadFileRequest->isOutgoing ? 1 : 0;
         DownloadFileAction downloadFileAction = downloadFileRequest->downloadFileAction;
 
         CWmDownloadFile(m_ConnId,
                         const_cast<char*>(chatId.c_str()),
                         const_cast<char*>(msgId.c_str()),
                         const_cast<char*>(fileId.c_str()),
+                        const_cast<char*>(senderId.c_str()),
+                        isFromMe,
                         downloadFileAction
                         );
+        Status::SetProgress(-1);
       }
       break;
 
@@ -600,7 +678,11 @@ void WmChat::PerformRequest(std::shared_ptr<RequestMessage> p_RequestMessage)
 
     case SetCurrentChatRequestType:
       {
-        // No handling needed
+        std::shared_ptr<SetCurrentChatRequest> setCurrentChatRequest =
+          std::static_pointer_cast<SetCurrentChatRequest>(p_RequestMessage);
+        std::string chatId = setCurrentChatRequest->chatId;
+
+        CWmSetCurrentChat(m_ConnId, const_cast<char*>(chatId.c_str()));
       }
       break;
 
@@ -619,6 +701,123 @@ void WmChat::PerformRequest(std::shared_ptr<RequestMessage> p_RequestMessage)
       }
       break;
 
+    case GetProfileSettingsRequestType:
+      {
+        LOG_DEBUG("get profile settings");
+
+        Status::Set(Status::FlagFetching);
+        CWmGetSelfProfile(m_ConnId);
+        CWmGetPrivacySettings(m_ConnId);
+        CWmGetContactQrLink(m_ConnId, 0 /* revoke */, 0 /* show */);
+        Status::Clear(Status::FlagFetching);
+      }
+      break;
+
+    case SetProfileSettingRequestType:
+      {
+        LOG_DEBUG("set profile setting");
+
+        std::shared_ptr<SetProfileSettingRequest> setProfileSettingRequest =
+          std::static_pointer_cast<SetProfileSettingRequest>(p_RequestMessage);
+        std::string key = setProfileSettingRequest->key;
+        std::string value = setProfileSettingRequest->value;
+
+        int rv = -1;
+        Status::Set(Status::FlagUpdating);
+        if (key.rfind(s_PrivacyKeyPrefix, 0) == 0)
+        {
+          std::string name = key.substr(s_PrivacyKeyPrefix.size());
+          rv = CWmSetPrivacySetting(m_ConnId, const_cast<char*>(name.c_str()), const_cast<char*>(value.c_str()));
+        }
+        else if (key == s_ProfileKeyPushName)
+        {
+          rv = CWmSetPushName(m_ConnId, const_cast<char*>(value.c_str()));
+        }
+        else if (key == s_ProfileKeyAbout)
+        {
+          rv = CWmSetAbout(m_ConnId, const_cast<char*>(value.c_str()));
+        }
+        else if (key == s_ProfileKeyPicture)
+        {
+          rv = CWmSetSelfProfilePicture(m_ConnId, const_cast<char*>(value.c_str()));
+        }
+        else if (key == s_ProfileKeyContactQrLink)
+        {
+          int revoke = (value == s_ContactQrLinkRevoke) ? 1 : 0;
+          rv = CWmGetContactQrLink(m_ConnId, revoke, 1 /* show */);
+        }
+        else
+        {
+          LOG_WARNING("unknown profile setting %s", key.c_str());
+        }
+        Status::Clear(Status::FlagUpdating);
+
+        if (rv != 0)
+        {
+          std::shared_ptr<ErrorNotify> errorNotify = std::make_shared<ErrorNotify>(m_ProfileId);
+          errorNotify->message = "Failed to update profile setting \"" + key + "\".";
+          CallMessageHandler(errorNotify);
+        }
+      }
+      break;
+
+    case GetProfilePictureRequestType:
+      {
+        LOG_DEBUG("get profile picture");
+
+        std::shared_ptr<GetProfilePictureRequest> getProfilePictureRequest =
+          std::static_pointer_cast<GetProfilePictureRequest>(p_RequestMessage);
+        std::string chatId = getProfilePictureRequest->chatId;
+
+        CWmGetProfilePicture(m_ConnId, const_cast<char*>(chatId.c_str()));
+      }
+      break;
+
+    case ForwardMessageRequestType:
+      {
+        LOG_DEBUG("forward message");
+        Status::Set(Status::FlagSending);
+        std::shared_ptr<ForwardMessageRequest> forwardMessageRequest =
+          std::static_pointer_cast<ForwardMessageRequest>(p_RequestMessage);
+        std::string chatId = forwardMessageRequest->chatId;
+        std::string msgId = forwardMessageRequest->msgId;
+        std::string text = forwardMessageRequest->chatMessage.text;
+        std::string toChatIds = StrUtil::Join(forwardMessageRequest->toChatIds, ",");
+        std::string fileId;
+        std::string fileType;
+        if (!forwardMessageRequest->chatMessage.fileInfo.empty())
+        {
+          FileInfo fileInfo = ProtocolUtil::FileInfoFromHex(forwardMessageRequest->chatMessage.fileInfo);
+          fileId = fileInfo.fileId;
+          fileType = FileUtil::GetMimeType(fileInfo.filePath);
+        }
+
+        CWmForwardMessage(m_ConnId, const_cast<char*>(chatId.c_str()), const_cast<char*>(msgId.c_str()),
+                          const_cast<char*>(fileId.c_str()), const_cast<char*>(fileType.c_str()),
+                          const_cast<char*>(text.c_str()), const_cast<char*>(toChatIds.c_str()));
+        Status::Clear(Status::FlagSending);
+      }
+      break;
+
+    case ResolveLinksRequestType:
+      {
+        LOG_DEBUG("resolve links");
+
+        std::shared_ptr<ResolveLinksRequest> resolveLinksRequest =
+          std::static_pointer_cast<ResolveLinksRequest>(p_RequestMessage);
+        std::string text = resolveLinksRequest->text;
+
+        Status::Set(Status::FlagFetching);
+        int rv = CWmResolveLinks(m_ConnId, const_cast<char*>(text.c_str()));
+        Status::Clear(Status::FlagFetching);
+
+        std::shared_ptr<ResolveLinksNotify> resolveLinksNotify = std::make_shared<ResolveLinksNotify>(m_ProfileId);
+        resolveLinksNotify->success = (rv == 0);
+        resolveLinksNotify->text = text;
+        CallMessageHandler(resolveLinksNotify);
+      }
+      break;
+
     default:
       LOG_DEBUG("unknown request %d", p_RequestMessage->GetMessageType());
       break;
@@ -630,18 +829,40 @@ void WmChat::PerformRequest(std::shared_ptr<RequestMessage> p_RequestMessage)
   }
 }
 
+static std::string UrlEncode(const std::string& p_Str)
+{
+  static const std::string unreserved = "-._~";
+  std::string encoded;
+  for (const unsigned char ch : p_Str)
+  {
+    if (isalnum(ch) || (unreserved.find(ch) != std::string::npos))
+    {
+      encoded += ch;
+    }
+    else
+    {
+      char hex[4];
+      snprintf(hex, sizeof(hex), "%%%02X", ch);
+      encoded += hex;
+    }
+  }
+
+  return encoded;
+}
+
 std::string WmChat::GetProxyUrl() const
 {
   const std::string proxyHost = AppConfig::GetStr("proxy_host");
   const int proxyPort = AppConfig::GetNum("proxy_port");
   if (!proxyHost.empty() && (proxyPort != 0))
   {
-    std::string proxyUrl = "socks5://";
+    const std::string proxyType = AppConfig::GetStr("proxy_type");
+    std::string proxyUrl = (proxyType == "http") ? "http://" : "socks5://";
     const std::string proxyUser = AppConfig::GetStr("proxy_user");
     const std::string proxyPass = AppConfig::GetStr("proxy_pass");
     if (!proxyUser.empty())
     {
-      proxyUrl += proxyUser + ":" + proxyPass + "@";
+      proxyUrl += UrlEncode(proxyUser) + ":" + UrlEncode(proxyPass) + "@";
     }
 
     proxyUrl += proxyHost + ":" + std::to_string(proxyPort);
@@ -696,7 +917,7 @@ WmChat* WmChat::GetInstance(int p_ConnId)
   return (it != s_ConnIdMap.end()) ? it->second : nullptr;
 }
 
-void WmNewContactsNotify(int p_ConnId, char* p_ChatId, char* p_Name, char* p_Phone, int p_IsSelf)
+void WmNewContactsNotify(int p_ConnId, char* p_ChatId, char* p_Name, char* p_Phone, int p_IsSelf, int p_IsBlocked)
 {
   WmChat* instance = WmChat::GetInstance(p_ConnId);
   if (instance == nullptr) return;
@@ -706,6 +927,7 @@ void WmNewContactsNotify(int p_ConnId, char* p_ChatId, char* p_Name, char* p_Pho
   contactInfo.name = std::string(p_Name);
   contactInfo.phone = std::string(p_Phone);
   contactInfo.isSelf = (p_IsSelf == 1) ? true : false;
+  contactInfo.isBlocked = (p_IsBlocked == 1) ? true : false;
 
   std::shared_ptr<NewContactsNotify> newContactsNotify = std::make_shared<NewContactsNotify>(instance->GetProfileId());
   newContactsNotify->contactInfos = std::vector<ContactInfo>({ contactInfo });
@@ -716,6 +938,7 @@ void WmNewContactsNotify(int p_ConnId, char* p_ChatId, char* p_Name, char* p_Pho
 
   free(p_ChatId);
   free(p_Name);
+  free(p_Phone);
 }
 
 void WmNewChatsNotify(int p_ConnId, char* p_ChatId, int p_IsUnread, int p_IsMuted, int p_IsPinned, int p_LastMessageTime)
@@ -743,8 +966,8 @@ void WmNewChatsNotify(int p_ConnId, char* p_ChatId, int p_IsUnread, int p_IsMute
 }
 
 void WmNewMessagesNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, char* p_SenderId, char* p_Text, int p_FromMe,
-                         char* p_QuotedId, char* p_FileId, char* p_FilePath, int p_FileStatus, int p_TimeSent,
-                         int p_IsRead)
+                         char* p_QuotedId, char* p_FileId, char* p_FilePath, char* p_ThumbPath, int p_FileStatus,
+                         int p_IsVoiceNote, int p_DurationSec, int p_TimeSent, int p_IsRead)
 {
   LOG_DEBUG("WaNewMessagesNotify");
 
@@ -759,6 +982,9 @@ void WmNewMessagesNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, char* p_Se
     fileInfo.fileStatus = (FileStatus)p_FileStatus;
     fileInfo.fileId = fileId;
     fileInfo.filePath = std::string(p_FilePath);
+    fileInfo.thumbPath = std::string(p_ThumbPath);
+    fileInfo.isVoiceNote = (p_IsVoiceNote == 1);
+    fileInfo.durationSec = p_DurationSec;
     fileInfoStr = ProtocolUtil::FileInfoToHex(fileInfo);
   }
 
@@ -789,6 +1015,8 @@ void WmNewMessagesNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, char* p_Se
   free(p_Text);
   free(p_QuotedId);
   free(p_FileId);
+  free(p_FilePath);
+  free(p_ThumbPath);
 }
 
 void WmNewStatusNotify(int p_ConnId, char* p_ChatId, char* p_UserId, int p_IsOnline, int p_IsTyping, int p_TimeSeen)
@@ -818,7 +1046,8 @@ void WmNewStatusNotify(int p_ConnId, char* p_ChatId, char* p_UserId, int p_IsOnl
       std::make_shared<ReceiveTypingNotify>(instance->GetProfileId());
     receiveTypingNotify->chatId = chatId;
     receiveTypingNotify->userId = userId;
-    receiveTypingNotify->isTyping = (p_IsTyping == 1);
+    receiveTypingNotify->isTyping = (p_IsTyping != 0);
+    receiveTypingNotify->isRecordingAudio = (p_IsTyping == 2);
 
     std::shared_ptr<DeferNotifyRequest> deferNotifyRequest =
       std::make_shared<DeferNotifyRequest>();
@@ -851,16 +1080,23 @@ void WmNewMessageStatusNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, int p
   free(p_MsgId);
 }
 
-void WmNewMessageFileNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, char* p_FilePath, int p_FileStatus,
+void WmNewMessageFileNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, char* p_FileId, char* p_FilePath,
+                            char* p_ThumbPath, int p_FileStatus, int p_IsVoiceNote, int p_DurationSec,
                             int p_Action)
 {
   WmChat* instance = WmChat::GetInstance(p_ConnId);
   if (instance == nullptr) return;
 
+  Status::SetProgress(-1);
+
   {
     FileInfo fileInfo;
     fileInfo.fileStatus = static_cast<FileStatus>(p_FileStatus);
+    fileInfo.fileId = std::string(p_FileId); // may be updated by media retry
     fileInfo.filePath = std::string(p_FilePath);
+    fileInfo.thumbPath = std::string(p_ThumbPath);
+    fileInfo.isVoiceNote = (p_IsVoiceNote == 1);
+    fileInfo.durationSec = p_DurationSec;
 
     std::shared_ptr<NewMessageFileNotify> newMessageFileNotify =
       std::make_shared<NewMessageFileNotify>(instance->GetProfileId());
@@ -876,23 +1112,123 @@ void WmNewMessageFileNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, char* p
 
   free(p_ChatId);
   free(p_MsgId);
+  free(p_FileId);
   free(p_FilePath);
+  free(p_ThumbPath);
+}
+
+void WmNewMessageFileProgressNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, int p_Percent)
+{
+  WmChat* instance = WmChat::GetInstance(p_ConnId);
+  if (instance == nullptr) return;
+
+  LOG_DEBUG("download progress %s %s %d%%", p_ChatId, p_MsgId, p_Percent);
+  Status::SetProgress(p_Percent);
+
+  free(p_ChatId);
+  free(p_MsgId);
+}
+
+void WmSendMessageProgressNotify(int p_ConnId, char* p_ChatId, int p_Percent)
+{
+  WmChat* instance = WmChat::GetInstance(p_ConnId);
+  if (instance == nullptr) return;
+
+  LOG_DEBUG("upload progress %s %d%%", p_ChatId, p_Percent);
+  Status::SetProgress(p_Percent);
+
+  free(p_ChatId);
+}
+
+void WmNewMessageEditNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, int p_IsEdited, int p_TimeEdited,
+                            char* p_PriorText)
+{
+  WmChat* instance = WmChat::GetInstance(p_ConnId);
+  if (instance == nullptr) return;
+
+  LOG_DEBUG("message %s %s edited %d at %d", p_ChatId, p_MsgId, p_IsEdited, p_TimeEdited);
+
+  {
+    std::shared_ptr<NewMessageEditNotify> newMessageEditNotify =
+      std::make_shared<NewMessageEditNotify>(instance->GetProfileId());
+    newMessageEditNotify->chatId = std::string(p_ChatId);
+    newMessageEditNotify->msgId = std::string(p_MsgId);
+    newMessageEditNotify->timeEdited = (p_IsEdited == 1) ? (static_cast<int64_t>(p_TimeEdited) * 1000) : -1;
+    newMessageEditNotify->priorText = std::string(p_PriorText);
+
+    std::shared_ptr<DeferNotifyRequest> deferNotifyRequest = std::make_shared<DeferNotifyRequest>();
+    deferNotifyRequest->serviceMessage = newMessageEditNotify;
+    instance->SendRequest(deferNotifyRequest);
+  }
+
+  free(p_ChatId);
+  free(p_MsgId);
+  free(p_PriorText);
 }
 
-void WmNewMessageReactionNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, char* p_SenderId, char* p_Text,
-                                int p_FromMe)
+void WmForwardMessageNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, char* p_ToChatId, int p_IsSuccess)
 {
   WmChat* instance = WmChat::GetInstance(p_ConnId);
   if (instance == nullptr) return;
 
+  if (p_IsSuccess == 1)
   {
-    const std::string senderId = (p_FromMe == 1) ? s_ReactionsSelfId : std::string(p_SenderId);
+    LOG_DEBUG("forwarded %s %s to %s", p_ChatId, p_MsgId, p_ToChatId);
+  }
+  else
+  {
+    LOG_WARNING("forward %s %s to %s failed", p_ChatId, p_MsgId, p_ToChatId);
+
+    std::shared_ptr<ErrorNotify> errorNotify = std::make_shared<ErrorNotify>(instance->GetProfileId());
+    errorNotify->message = "Failed to forward message to " + std::string(p_ToChatId) + ".";
+
+    std::shared_ptr<DeferNotifyRequest> deferNotifyRequest = std::make_shared<DeferNotifyRequest>();
+    deferNotifyRequest->serviceMessage = errorNotify;
+    instance->SendRequest(deferNotifyRequest);
+  }
+
+  free(p_ChatId);
+  free(p_MsgId);
+  free(p_ToChatId);
+}
+
+void WmNewMessageReactionsNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, char* p_SelfId, char* p_EmojiSenders,
+                                 char* p_RemovedSenderId)
+{
+  WmChat* instance = WmChat::GetInstance(p_ConnId);
+  if (instance == nullptr) return;
+
+  {
+    const std::string selfId = std::string(p_SelfId);
     Reactions reactions;
     // go via message cache for consolidation and count before handled by ui
     reactions.needConsolidationWithCache = true;
     reactions.updateCountBasedOnSender = true;
     reactions.replaceCount = false;
-    reactions.senderEmojis[senderId] = std::string(p_Text);
+
+    // aggregate is one "emoji<tab>sender,sender" line per emoji
+    const std::vector<std::string> lines = StrUtil::Split(std::string(p_EmojiSenders), '\n');
+    for (const auto& line : lines)
+    {
+      const std::vector<std::string> emojiSenders = StrUtil::Split(line, '\t');
+      if (emojiSenders.size() != 2) continue;
+
+      const std::string& emoji = emojiSenders.at(0);
+      const std::vector<std::string> senderIds = StrUtil::Split(emojiSenders.at(1), ',');
+      for (const auto& senderId : senderIds)
+      {
+        if (senderId.empty()) continue;
+
+        reactions.senderEmojis[(senderId == selfId) ? s_ReactionsSelfId : senderId] = emoji;
+      }
+    }
+
+    // empty emoji removes sender reaction during cache consolidation
+    const std::string removedSenderId = std::string(p_RemovedSenderId);
+    if (!removedSenderId.empty())
+    {
+      reactions.senderEmojis[(removedSenderId == selfId) ? s_ReactionsSelfId : removedSenderId] = "";
+    }
 
     std::shared_ptr<NewMessageReactionsNotify> newMessageReactionsNotify =
       std::make_shared<NewMessageReactionsNotify>(instance->GetProfileId());
@@ -907,8 +1243,9 @@ void WmNewMessageReactionNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, cha
 
   free(p_ChatId);
   free(p_MsgId);
-  free(p_SenderId);
-  free(p_Text);
+  free(p_SelfId);
+  free(p_EmojiSenders);
+  free(p_RemovedSenderId);
 }
 
 void WmDeleteChatNotify(int p_ConnId, char* p_ChatId)
@@ -980,6 +1317,299 @@ void WmUpdatePinNotify(int p_ConnId, char* p_ChatId, int p_IsPinned, int p_TimeP
   free(p_ChatId);
 }
 
+void WmUpdatePrivacySettingNotify(int p_ConnId, char* p_Name, char* p_Value)
+{
+  WmChat* instance = WmChat::GetInstance(p_ConnId);
+  if (instance == nullptr) return;
+
+  LOG_DEBUG("privacy setting %s = %s", p_Name, p_Value);
+
+  // keep in sync with IsValidPrivacySetting in gowm.go
+  static const std::vector<std::string> audienceOptions = { "all", "contacts", "contact_blacklist", "none" };
+  static const std::map<std::string, std::pair<std::string, std::vector<std::string>>> privacySettings =
+  {
+    { "groupadd", { "Privacy: Add to groups", audienceOptions } },
+    { "last", { "Privacy: Last seen", audienceOptions } },
+    { "status", { "Privacy: About", audienceOptions } },
+    { "profile", { "Privacy: Profile picture", audienceOptions } },
+    { "readreceipts", { "Privacy: Read receipts", { "all", "none" } } },
+    { "online", { "Privacy: Online", { "all", "match_last_seen" } } },
+    { "calladd", { "Privacy: Calls", { "all", "known" } } },
+  };
+
+  auto it = privacySettings.find(std::string(p_Name));
+  if (it != privacySettings.end())
+  {
+    std::shared_ptr<ProfileSettingNotify> profileSettingNotify =
+      std::make_shared<ProfileSettingNotify>(instance->GetProfileId());
+    profileSettingNotify->profileSetting.key = s_PrivacyKeyPrefix + it->first;
+    profileSettingNotify->profileSetting.label = it->second.first;
+    profileSettingNotify->profileSetting.value = std::string(p_Value);
+    profileSettingNotify->profileSetting.type = ProfileSettingTypeOption;
+    profileSettingNotify->profileSetting.options = it->second.second;
+
+    std::shared_ptr<DeferNotifyRequest> deferNotifyRequest = std::make_shared<DeferNotifyRequest>();
+    deferNotifyRequest->serviceMessage = profileSettingNotify;
+    instance->SendRequest(deferNotifyRequest);
+  }
+  else
+  {
+    LOG_WARNING("unknown privacy setting %s", p_Name);
+  }
+
+  free(p_Name);
+  free(p_Value);
+}
+
+void WmNewProfilePictureNotify(int p_ConnId, char* p_ChatId, char* p_FilePath)
+{
+  WmChat* instance = WmChat::GetInstance(p_ConnId);
+  if (instance == nullptr) return;
+
+  LOG_DEBUG("profile picture %s path %s", p_ChatId, p_FilePath);
+
+  std::shared_ptr<NewProfilePictureNotify> newProfilePictureNotify =
+    std::make_shared<NewProfilePictureNotify>(instance->GetProfileId());
+  newProfilePictureNotify->chatId = std::string(p_ChatId);
+  newProfilePictureNotify->filePath = std::string(p_FilePath);
+
+  std::shared_ptr<DeferNotifyRequest> deferNotifyRequest = std::make_shared<DeferNotifyRequest>();
+  deferNotifyRequest->serviceMessage = newProfilePictureNotify;
+  instance->SendRequest(deferNotifyRequest);
+
+  free(p_ChatId);
+  free(p_FilePath);
+}
+
+void WmUpdateSelfProfileNotify(int p_ConnId, char* p_Key, char* p_Value)
+{
+  WmChat* instance = WmChat::GetInstance(p_ConnId);
+  if (instance == nullptr) return;
+
+  LOG_DEBUG("self profile %s = %s", p_Key, p_Value);
+
+  static const std::map<std::string, std::pair<std::string, ProfileSettingType>> selfProfileSettings =
+  {
+    { s_ProfileKeyPushName, { "Name", ProfileSettingTypeText } },
+    { s_ProfileKeyAbout, { "About", ProfileSettingTypeText } },
+    { s_ProfileKeyPicture, { "Profile picture", ProfileSettingTypeFile } },
+  };
+
+  auto it = selfProfileSettings.find(std::string(p_Key));
+  if (it != selfProfileSettings.end())
+  {
+    std::shared_ptr<ProfileSettingNotify> profileSettingNotify =
+      std::make_shared<ProfileSettingNotify>(instance->GetProfileId());
+    profileSettingNotify->profileSetting.key = it->first;
+    profileSettingNotify->profileSetting.label = it->second.first;
+    profileSettingNotify->profileSetting.value = std::string(p_Value);
+    profileSettingNotify->profileSetting.type = it->second.second;
+
+    std::shared_ptr<DeferNotifyRequest> deferNotifyRequest = std::make_shared<DeferNotifyRequest>();
+    deferNotifyRequest->serviceMessage = profileSettingNotify;
+    instance->SendRequest(deferNotifyRequest);
+  }
+  else
+  {
+    LOG_WARNING("unknown self profile key %s", p_Key);
+  }
+
+  free(p_Key);
+  free(p_Value);
+}
+
+void WmNewUserDetailsNotify(int p_ConnId, char* p_UserId, char* p_About, char* p_VerifiedName, int p_DeviceCount,
+                            int p_IsBusiness, char* p_Address, char* p_Email, char* p_Categories,
+                            char* p_BusinessHours)
+{
+  WmChat* instance = WmChat::GetInstance(p_ConnId);
+  if (instance == nullptr) return;
+
+  LOG_DEBUG("user details %s about \"%s\" verified \"%s\" devices %d business %d", p_UserId, p_About,
+            p_VerifiedName, p_DeviceCount, p_IsBusiness);
+
+  std::vector<std::pair<std::string, std::string>> details;
+  auto addDetail = [&](const std::string& p_Label, const std::string& p_Value)
+  {
+    if (!p_Value.empty())
+    {
+      details.push_back(std::make_pair(p_Label, p_Value));
+    }
+  };
+
+  addDetail("About", std::string(p_About));
+  addDetail("Verified name", std::string(p_VerifiedName));
+  addDetail("Devices", std::to_string(p_DeviceCount));
+  if (p_IsBusiness == 1)
+  {
+    addDetail("Business address", std::string(p_Address));
+    addDetail("Business email", std::string(p_Email));
+    addDetail("Business categories", std::string(p_Categories));
+    addDetail("Business hours", std::string(p_BusinessHours));
+  }
+
+  std::shared_ptr<UserDetailsNotify> userDetailsNotify = std::make_shared<UserDetailsNotify>(instance->GetProfileId());
+  userDetailsNotify->userId = std::string(p_UserId);
+  userDetailsNotify->details = details;
+
+  std::shared_ptr<DeferNotifyRequest> deferNotifyRequest = std::make_shared<DeferNotifyRequest>();
+  deferNotifyRequest->serviceMessage = userDetailsNotify;
+  instance->SendRequest(deferNotifyRequest);
+
+  free(p_UserId);
+  free(p_About);
+  free(p_VerifiedName);
+  free(p_Address);
+  free(p_Email);
+  free(p_Categories);
+  free(p_BusinessHours);
+}
+
+void WmLookupPhoneNotify(int p_ConnId, char* p_Phone, char* p_UserId, char* p_VerifiedName, int p_IsRegistered)
+{
+  WmChat* instance = WmChat::GetInstance(p_ConnId);
+  if (instance == nullptr) return;
+
+  if (p_IsRegistered == 1)
+  {
+    LOG_DEBUG("phone %s registered as %s \"%s\"", p_Phone, p_UserId, p_VerifiedName);
+
+    std::shared_ptr<CreateChatNotify> createChatNotify = std::make_shared<CreateChatNotify>(instance->GetProfileId());
+    createChatNotify->success = true;
+    createChatNotify->chatInfo.id = std::string(p_UserId);
+    createChatNotify->verifiedName = std::string(p_VerifiedName);
+
+    std::shared_ptr<DeferNotifyRequest> deferNotifyRequest = std::make_shared<DeferNotifyRequest>();
+    deferNotifyRequest->serviceMessage = createChatNotify;
+    instance->SendRequest(deferNotifyRequest);
+  }
+  else
+  {
+    LOG_WARNING("phone %s not registered", p_Phone);
+
+    std::shared_ptr<ErrorNotify> errorNotify = std::make_shared<ErrorNotify>(instance->GetProfileId());
+    errorNotify->message = "Phone number " + std::string(p_Phone) + " is invalid or not registered on WhatsApp.";
+
+    std::shared_ptr<DeferNotifyRequest> deferNotifyRequest = std::make_shared<DeferNotifyRequest>();
+    deferNotifyRequest->serviceMessage = errorNotify;
+    instance->SendRequest(deferNotifyRequest);
+  }
+
+  free(p_Phone);
+  free(p_UserId);
+  free(p_VerifiedName);
+}
+
+void WmNewLinkTargetNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, char* p_Link, char* p_UserId, char* p_Name,
+                           char* p_Text)
+{
+  WmChat* instance = WmChat::GetInstance(p_ConnId);
+  if (instance == nullptr) return;
+
+  std::string chatId(p_ChatId);
+  LOG_DEBUG("link %s target %s \"%s\" text \"%s\"", p_Link, p_UserId, p_Name, p_Text);
+
+  // open chat for links not originating from a received message
+  if (chatId.empty())
+  {
+    std::shared_ptr<CreateChatNotify> createChatNotify = std::make_shared<CreateChatNotify>(instance->GetProfileId());
+    createChatNotify->success = true;
+    createChatNotify->chatInfo.id = std::string(p_UserId);
+    createChatNotify->entryText = std::string(p_Text);
+
+    std::shared_ptr<DeferNotifyRequest> deferNotifyRequest = std::make_shared<DeferNotifyRequest>();
+    deferNotifyRequest->serviceMessage = createChatNotify;
+    instance->SendRequest(deferNotifyRequest);
+  }
+
+  free(p_ChatId);
+  free(p_MsgId);
+  free(p_Link);
+  free(p_UserId);
+  free(p_Name);
+  free(p_Text);
+}
+
+void WmNewContactQrLinkNotify(int p_ConnId, char* p_Link)
+{
+  WmChat* instance = WmChat::GetInstance(p_ConnId);
+  if (instance == nullptr) return;
+
+  LOG_DEBUG("contact qr link %s", p_Link);
+
+  std::shared_ptr<ProfileSettingNotify> profileSettingNotify =
+    std::make_shared<ProfileSettingNotify>(instance->GetProfileId());
+  profileSettingNotify->profileSetting.key = s_ProfileKeyContactQrLink;
+  profileSettingNotify->profileSetting.label = "Contact QR link";
+  profileSettingNotify->profileSetting.value = std::string(p_Link);
+  profileSettingNotify->profileSetting.type = ProfileSettingTypeOption;
+  profileSettingNotify->profileSetting.options = { s_ContactQrLinkShow, s_ContactQrLinkRevoke };
+
+  std::shared_ptr<DeferNotifyRequest> deferNotifyRequest = std::make_shared<DeferNotifyRequest>();
+  deferNotifyRequest->serviceMessage = profileSettingNotify;
+  instance->SendRequest(deferNotifyRequest);
+
+  free(p_Link);
+}
+
+static std::string ConnStateToString(int p_State)
+{
+  // keep in sync with connection states in gowm.go
+  static const std::vector<std::string> names =
+  {
+    "none", "connecting", "syncing", "online", "degraded", "reconnecting",
+    "replaced", "banned", "logged out", "outdated", "disconnected",
+  };
+
+  return ((p_State >= 0) && (p_State < (int)names.size())) ? names.at(p_State) : std::to_string(p_State);
+}
+
+static uint32_t ConnStateToFlags(int p_State)
+{
+  // keep in sync with connection states in gowm.go
+  enum ConnState
+  {
+    ConnStateNone = 0,
+    ConnStateConnecting,
+    ConnStateSyncing,
+    ConnStateOnline,
+    ConnStateDegraded,
+    ConnStateReconnecting,
+  };
+
+  switch (p_State)
+  {
+    case ConnStateConnecting:
+      return Status::FlagConnecting;
+    case ConnStateSyncing:
+    case ConnStateOnline:
+      return Status::FlagOnline;
+    case ConnStateDegraded:
+      return Status::FlagOnline | Status::FlagDegraded;
+    case ConnStateReconnecting:
+      return Status::FlagConnecting | Status::FlagReconnecting;
+    default:
+      return Status::FlagNone;
+  }
+}
+
+void WmNewConnStateNotify(int p_ConnId, int p_State, char* p_Reason)
+{
+  WmChat* instance = WmChat::GetInstance(p_ConnId);
+  if (instance == nullptr) return;
+
+  LOG_INFO("connection state %s %s", ConnStateToString(p_State).c_str(), p_Reason);
+
+  // status flags controlled by connection state, syncing is controlled by history sync
+  static const uint32_t stateFlagsMask =
+    Status::FlagConnecting | Status::FlagOnline | Status::FlagReconnecting | Status::FlagDegraded;
+  const uint32_t stateFlags = ConnStateToFlags(p_State);
+  Status::Clear(stateFlagsMask & ~stateFlags);
+  Status::Set(stateFlags);
+
+  free(p_Reason);
+}
+
 void WmReinit(int p_ConnId)
 {
   WmChat* instance = WmChat::GetInstance(p_ConnId);
@@ -990,6 +1620,45 @@ void WmReinit(int p_ConnId)
   instance->SendRequest(reinitRequest);
 }
 
+void WmConnErrorNotify(int p_ConnId, char* p_Message, int p_IsReconnectable)
+{
+  WmChat* instance = WmChat::GetInstance(p_ConnId);
+  if (instance == nullptr) return;
+
+  {
+    std::shared_ptr<ConnErrorNotify> connErrorNotify =
+      std::make_shared<ConnErrorNotify>(instance->GetProfileId());
+    connErrorNotify->message = std::string(p_Message);
+    connErrorNotify->isReconnectable = p_IsReconnectable;
+
+    std::shared_ptr<DeferNotifyRequest> deferNotifyRequest =
+      std::make_shared<DeferNotifyRequest>();
+    deferNotifyRequest->serviceMessage = connErrorNotify;
+    instance->SendRequest(deferNotifyRequest);
+  }
+
+  free(p_Message);
+}
+
+void WmErrorNotify(int p_ConnId, char* p_Message)
+{
+  WmChat* instance = WmChat::GetInstance(p_ConnId);
+  if (instance == nullptr) return;
+
+  {
+    std::shared_ptr<ErrorNotify> errorNotify =
+      std::make_shared<ErrorNotify>(instance->GetProfileId());
+    errorNotify->message = std::string(p_Message);
+
+    std::shared_ptr<DeferNotifyRequest> deferNotifyRequest =
+      std::make_shared<DeferNotifyRequest>();
+    deferNotifyRequest->serviceMessage = errorNotify;
+    instance->SendRequest(deferNotifyRequest);
+  }
+
+  free(p_Message);
+}
+
 void WmSetProtocolUiControl(int p_ConnId, int p_IsTakeControl)
 {
   WmChat* instance = WmChat::GetInstance(p_ConnId);
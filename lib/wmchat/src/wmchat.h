@@ -87,27 +87,47 @@ private:
   int m_WhatsmeowDate = 0;
   int m_ProfileDirVersion = 0;
   bool m_WasOnline = false;
+  bool m_ProxyError = false;
   bool m_IsSetup = false;
   static const int s_CacheDirVersion = 0; // update MessageCache::AddProfile() once bumped to 1
 };
 
 extern "C" {
-void WmNewContactsNotify(int p_ConnId, char* p_ChatId, char* p_Name, char* p_Phone, int p_IsSelf);
+void WmNewContactsNotify(int p_ConnId, char* p_ChatId, char* p_Name, char* p_Phone, int p_IsSelf, int p_IsBlocked);
   void WmNewChatsNotify(int p_ConnId, char* p_ChatId, int p_IsUnread, int p_IsMuted, int p_IsPinned, int p_LastMessageTime);
 void WmNewMessagesNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, char* p_SenderId, char* p_Text, int p_FromMe,
-                         char* p_ReplyId, char* p_FileId, char* p_FilePath, int p_FileStatus, int p_TimeSent,
-                         int p_IsRead);
+                         char* p_ReplyId, char* p_FileId, char* p_FilePath, char* p_ThumbPath, int p_FileStatus,
+                         int p_IsVoiceNote, int p_DurationSec, int p_TimeSent, int p_IsRead);
 void WmNewStatusNotify(int p_ConnId, char* p_ChatId, char* p_UserId, int p_IsOnline, int p_IsTyping, int p_TimeSeen);
 void WmNewMessageStatusNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, int p_IsRead);
-void WmNewMessageFileNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, char* p_FilePath, int p_FileStatus,
+void WmNewMessageFileNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, char* p_FileId, char* p_FilePath,
+                            char* p_ThumbPath, int p_FileStatus, int p_IsVoiceNote, int p_DurationSec,
                             int p_Action);
-void WmNewMessageReactionNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, char* p_SenderId, char* p_Text,
-                                int p_FromMe);
+void WmNewMessageFileProgressNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, int p_Percent);
+void WmSendMessageProgressNotify(int p_ConnId, char* p_ChatId, int p_Percent);
+void WmNewMessageEditNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, int p_IsEdited, int p_TimeEdited,
+                            char* p_PriorText);
+void WmForwardMessageNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, char* p_ToChatId, int p_IsSuccess);
+void WmNewMessageReactionsNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, char* p_SelfId, char* p_EmojiSenders,
+                                 char* p_RemovedSenderId);
 void WmDeleteChatNotify(int p_ConnId, char* p_ChatId);
 void WmDeleteMessageNotify(int p_ConnId, char* p_ChatId, char* p_MsgId);
 void WmUpdateMuteNotify(int p_ConnId, char* p_ChatId, int p_IsMuted);
 void WmUpdatePinNotify(int p_ConnId, char* p_ChatId, int p_IsPinned, int p_TimePinned);
+void WmUpdatePrivacySettingNotify(int p_ConnId, char* p_Name, char* p_Value);
+void WmNewProfilePictureNotify(int p_ConnId, char* p_ChatId, char* p_FilePath);
+void WmUpdateSelfProfileNotify(int p_ConnId, char* p_Key, char* p_Value);
+void WmNewUserDetailsNotify(int p_ConnId, char* p_UserId, char* p_About, char* p_VerifiedName, int p_DeviceCount,
+                            int p_IsBusiness, char* p_Address, char* p_Email, char* p_Categories,
+                            char* p_BusinessHours);
+void WmLookupPhoneNotify(int p_ConnId, char* p_Phone, char* p_UserId, char* p_VerifiedName, int p_IsRegistered);
+void WmNewLinkTargetNotify(int p_ConnId, char* p_ChatId, char* p_MsgId, char* p_Link, char* p_UserId, char* p_Name,
+                           char* p_Text);
+void WmNewContactQrLinkNotify(int p_ConnId, char* p_Link);
+void WmNewConnStateNotify(int p_ConnId, int p_State, char* p_Reason);
 void WmReinit(int p_ConnId);
+void WmConnErrorNotify(int p_ConnId, char* p_Message, int p_IsReconnectable);
+void WmErrorNotify(int p_ConnId, char* p_Message);
 void WmSetProtocolUiControl(int p_ConnId, int p_IsTakeControl);
 void WmSetStatus(int p_Flags);
 void WmClearStatus(int p_Flags);
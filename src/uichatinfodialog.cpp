@@ -0,0 +1,83 @@
+// uichatinfodialog.cpp
+//
+// Copyright (c) 2024 Kristofer Berggren
+// All rights reserved.
+//
+// nchat is distributed under the MIT license, see LICENSE for details.
+
+#include "uichatinfodialog.h"
+
+#include <algorithm>
+
+#include "strutil.h"
+#include "uimodel.h"
+
+UiChatInfoDialog::UiChatInfoDialog(const UiDialogParams& p_Params, const std::string& p_ProfileId,
+                                   const std::string& p_ChatId)
+  : UiListDialog(p_Params, false /*p_ShadeHidden*/)
+  , m_ProfileId(p_ProfileId)
+  , m_ChatId(p_ChatId)
+{
+  UpdateList();
+}
+
+UiChatInfoDialog::~UiChatInfoDialog()
+{
+}
+
+std::pair<std::string, std::string> UiChatInfoDialog::GetSelectedChatDetail()
+{
+  return m_SelectedChatDetail;
+}
+
+void UiChatInfoDialog::OnSelect()
+{
+  if (m_ChatDetailVec.empty()) return;
+
+  m_SelectedChatDetail = m_ChatDetailVec[m_Index];
+  m_Result = true;
+  m_Running = false;
+}
+
+void UiChatInfoDialog::OnBack()
+{
+}
+
+bool UiChatInfoDialog::OnTimer()
+{
+  int64_t modelChatDetailsUpdateTime = m_Model->GetChatDetailsUpdateTime();
+  if (m_DialogChatDetailsUpdateTime != modelChatDetailsUpdateTime)
+  {
+    int index = m_Index;
+    UpdateList();
+    m_Index = std::min(index, std::max((int)m_Items.size() - 1, 0));
+    return true;
+  }
+
+  return false;
+}
+
+void UiChatInfoDialog::UpdateList()
+{
+  int64_t modelChatDetailsUpdateTime = m_Model->GetChatDetailsUpdateTime();
+  if (m_DialogChatDetailsUpdateTime != modelChatDetailsUpdateTime)
+  {
+    m_DialogChatDetailsUpdateTime = modelChatDetailsUpdateTime;
+    m_DialogChatDetails = m_Model->GetChatDetails(m_ProfileId, m_ChatId);
+  }
+
+  m_Index = 0;
+  m_Items.clear();
+  m_ChatDetailVec.clear();
+
+  for (const auto& chatDetail : m_DialogChatDetails)
+  {
+    const std::string item = chatDetail.first + ": " + chatDetail.second;
+    if (m_FilterStr.empty() ||
+        (StrUtil::ToLower(item).find(StrUtil::ToLower(StrUtil::ToString(m_FilterStr))) != std::string::npos))
+    {
+      m_Items.push_back(StrUtil::TrimPadWString(StrUtil::ToWString(item), m_W));
+      m_ChatDetailVec.push_back(chatDetail);
+    }
+  }
+}
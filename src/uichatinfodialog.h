@@ -0,0 +1,38 @@
+// uichatinfodialog.h
+//
+// Copyright (c) 2024 Kristofer Berggren
+// All rights reserved.
+//
+// nchat is distributed under the MIT license, see LICENSE for details.
+
+#pragma once
+
+#include <string>
+#include <utility>
+#include <vector>
+
+#include "uilistdialog.h"
+
+class UiChatInfoDialog : public UiListDialog
+{
+public:
+  UiChatInfoDialog(const UiDialogParams& p_Params, const std::string& p_ProfileId, const std::string& p_ChatId);
+  virtual ~UiChatInfoDialog();
+
+  std::pair<std::string, std::string> GetSelectedChatDetail();
+
+protected:
+  virtual void OnSelect();
+  virtual void OnBack();
+  virtual bool OnTimer();
+
+  void UpdateList();
+
+private:
+  std::string m_ProfileId;
+  std::string m_ChatId;
+  std::vector<std::pair<std::string, std::string>> m_DialogChatDetails;
+  int64_t m_DialogChatDetailsUpdateTime = 0;
+  std::vector<std::pair<std::string, std::string>> m_ChatDetailVec;
+  std::pair<std::string, std::string> m_SelectedChatDetail;
+};
@@ -82,6 +82,8 @@ void UiHelpView::Draw()
     AppendHelpItem("find", "Find", helpItems);
     AppendHelpItem("find_next", "FindNext", helpItems);
     AppendHelpItem("goto_chat", "GotoChat", helpItems);
+    AppendHelpItem("edit_profile", "EditProf", helpItems);
+    AppendHelpItem("chat_info", "ChatInfo", helpItems);
     AppendHelpItem("spell", "ExtSpell", helpItems);
     AppendHelpItem("decrease_list_width", "DecListW", helpItems);
     AppendHelpItem("increase_list_width", "IncListW", helpItems);
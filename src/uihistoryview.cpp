@@ -220,10 +220,28 @@ void UiHistoryView::Draw()
         fileStatus = statusDownloadFailed;
       }
 
-      std::wstring fileStr = attachmentIndicator + StrUtil::ToWString(fileName + fileStatus);
+      std::string fileDetails;
+      if (fileInfo.durationSec >= 0)
+      {
+        const std::string duration =
+          std::to_string(fileInfo.durationSec / 60) + ":" + (((fileInfo.durationSec % 60) < 10) ? "0" : "") +
+          std::to_string(fileInfo.durationSec % 60);
+        fileDetails = " (" + std::string(fileInfo.isVoiceNote ? "voice message " : "") + duration + ")";
+      }
+
+      std::wstring fileStr = attachmentIndicator + StrUtil::ToWString(fileName + fileDetails + fileStatus);
       wlines.insert(wlines.begin(), fileStr);
     }
 
+    // Edit history, for selected message
+    if (isSelectedMessage && !msg.editHistory.empty())
+    {
+      for (const auto& priorText : msg.editHistory)
+      {
+        wlines.push_back(quoteIndicator + L"edited from: " + StrUtil::ToWString(priorText));
+      }
+    }
+
     // Reactions
     int reactionLines = 0;
     static bool reactionsEnabled = UiConfig::GetBool("reactions_enabled");
@@ -392,7 +410,8 @@ void UiHistoryView::Draw()
     std::wstring wtime;
     if (msg.timeSent != std::numeric_limits<int64_t>::max())
     {
-      wtime = L" (" + StrUtil::ToWString(TimeUtil::GetTimeString(msg.timeSent, false /* p_IsExport */)) + L")";
+      std::wstring wedited = (msg.timeEdited != -1) ? L", edited" : L"";
+      wtime = L" (" + StrUtil::ToWString(TimeUtil::GetTimeString(msg.timeSent, false /* p_IsExport */)) + wedited + L")";
     }
 
     m_Model->MarkRead(currentChat.first, currentChat.second, *it, (!msg.isOutgoing && !msg.isRead));
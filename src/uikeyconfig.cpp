@@ -247,6 +247,8 @@ void UiKeyConfig::Init(bool p_MapKeys)
     { "select_contact", "KEY_CTRLN" },
     { "forward_msg", "\\33\\162" }, // alt/opt-r
     { "goto_chat", "\\33\\156" }, // alt/opt-n
+    { "edit_profile", "\\33\\160" }, // alt/opt-p
+    { "chat_info", "\\33\\151" }, // alt/opt-i
     { "other_commands_help", "KEY_CTRLO" },
     { "decrease_list_width", "\\33\\54" }, // alt/opt-,
     { "increase_list_width", "\\33\\56" }, // alt/opt-.
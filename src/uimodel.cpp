@@ -22,6 +22,7 @@
 #include "strutil.h"
 #include "timeutil.h"
 #include "uidialog.h"
+#include "uichatinfodialog.h"
 #include "uichatlistdialog.h"
 #include "uiconfig.h"
 #include "uicontactlistdialog.h"
@@ -31,11 +32,15 @@
 #include "uikeyconfig.h"
 #include "uikeyinput.h"
 #include "uimessagedialog.h"
+#include "uioptionlistdialog.h"
+#include "uiprofiledialog.h"
 #include "uitextinputdialog.h"
 #include "uiview.h"
 
 const std::pair<std::string, std::string> UiModel::s_ChatNone;
 
+static const std::string s_ProfilePictureLabel = "Profile picture";
+
 UiModel::UiModel()
 {
   m_View = std::make_shared<UiView>(this);
@@ -99,6 +104,8 @@ void UiModel::KeyHandler(wint_t p_Key)
 
   static wint_t keyForwardMsg = UiKeyConfig::GetKey("forward_msg");
   static wint_t keyGotoChat = UiKeyConfig::GetKey("goto_chat");
+  static wint_t keyEditProfile = UiKeyConfig::GetKey("edit_profile");
+  static wint_t keyChatInfo = UiKeyConfig::GetKey("chat_info");
 
   static wint_t keyToggleList = UiKeyConfig::GetKey("toggle_list");
   static wint_t keyToggleTop = UiKeyConfig::GetKey("toggle_top");
@@ -309,6 +316,14 @@ void UiModel::KeyHandler(wint_t p_Key)
   {
     GotoChat();
   }
+  else if (p_Key == keyEditProfile)
+  {
+    EditProfile();
+  }
+  else if (p_Key == keyChatInfo)
+  {
+    ShowChatInfo();
+  }
   else
   {
     EntryKeyHandler(p_Key);
@@ -986,16 +1001,22 @@ void UiModel::DownloadAttachment(const std::string& p_ProfileId, const std::stri
                                  DownloadFileAction p_DownloadFileAction)
 {
   // must be called with lock held
+  std::unordered_map<std::string, ChatMessage>& messages = m_Messages[p_ProfileId][p_ChatId];
+  auto mit = messages.find(p_MsgId);
+
   std::shared_ptr<DownloadFileRequest> downloadFileRequest = std::make_shared<DownloadFileRequest>();
   downloadFileRequest->chatId = p_ChatId;
   downloadFileRequest->msgId = p_MsgId;
   downloadFileRequest->fileId = p_FileId;
   downloadFileRequest->downloadFileAction = p_DownloadFileAction;
+  if (mit != messages.end())
+  {
+    downloadFileRequest->senderId = mit->second.senderId;
+    downloadFileRequest->isOutgoing = mit->second.isOutgoing;
+  }
 
   SendProtocolRequest(p_ProfileId, downloadFileRequest);
 
-  std::unordered_map<std::string, ChatMessage>& messages = m_Messages[p_ProfileId][p_ChatId];
-  auto mit = messages.find(p_MsgId);
   if (mit == messages.end()) return;
 
   if (mit->second.fileInfo.empty())
@@ -1308,6 +1329,14 @@ void UiModel::OpenMessageLink()
     SendProtocolRequest(profileId, createChatRequest);
     SetSelectMessageActive(false);
   }
+  else if (!msgUrls.empty() && HasProtocolFeature(profileId, FeatureResolveLinks))
+  {
+    // protocol opens chats for links it can resolve, other urls are opened upon failure
+    LOG_DEBUG("resolve links");
+    std::shared_ptr<ResolveLinksRequest> resolveLinksRequest = std::make_shared<ResolveLinksRequest>();
+    resolveLinksRequest->text = mit->second.text;
+    SendProtocolRequest(profileId, resolveLinksRequest);
+  }
   else if (!msgUrls.empty())
   {
     for (const auto& msgUrl : msgUrls)
@@ -1689,7 +1718,13 @@ void UiModel::MessageHandler(std::shared_ptr<ServiceMessage> p_ServiceMessage)
             }
             else
             {
-              messages[chatMessage.id] = chatMessage;
+              // keep edit details, not included in updated message
+              ChatMessage& message = messages[chatMessage.id];
+              std::vector<std::string> editHistory = message.editHistory;
+              int64_t timeEdited = message.timeEdited;
+              message = chatMessage;
+              message.editHistory = editHistory;
+              message.timeEdited = timeEdited;
             }
 
             if (newMessagesNotify->sequence)
@@ -1866,6 +1901,28 @@ void UiModel::MessageHandler(std::shared_ptr<ServiceMessage> p_ServiceMessage)
       }
       break;
 
+    case NewMessageEditNotifyType:
+      {
+        std::shared_ptr<NewMessageEditNotify> newMessageEditNotify =
+          std::static_pointer_cast<NewMessageEditNotify>(p_ServiceMessage);
+        std::string chatId = newMessageEditNotify->chatId;
+        std::string msgId = newMessageEditNotify->msgId;
+        LOG_TRACE("new edit time for %s is %lld", msgId.c_str(), newMessageEditNotify->timeEdited);
+        std::unordered_map<std::string, ChatMessage>& messages = m_Messages[profileId][chatId];
+        auto mit = messages.find(msgId);
+        if (mit != messages.end())
+        {
+          mit->second.timeEdited = newMessageEditNotify->timeEdited;
+          if (!newMessageEditNotify->priorText.empty())
+          {
+            mit->second.editHistory.push_back(newMessageEditNotify->priorText);
+          }
+        }
+
+        UpdateHistory();
+      }
+      break;
+
     case NewMessageFileNotifyType:
       {
         std::shared_ptr<NewMessageFileNotify> newMessageFileNotify = std::static_pointer_cast<NewMessageFileNotify>(
@@ -1931,9 +1988,11 @@ void UiModel::MessageHandler(std::shared_ptr<ServiceMessage> p_ServiceMessage)
         std::shared_ptr<ReceiveTypingNotify> receiveTypingNotify = std::static_pointer_cast<ReceiveTypingNotify>(
           p_ServiceMessage);
         bool isTyping = receiveTypingNotify->isTyping;
+        bool isRecordingAudio = receiveTypingNotify->isRecordingAudio;
         std::string chatId = receiveTypingNotify->chatId;
         std::string userId = receiveTypingNotify->userId;
-        LOG_TRACE("received user %s in chat %s is %s", userId.c_str(), chatId.c_str(), (isTyping ? "typing" : "idle"));
+        LOG_TRACE("received user %s in chat %s is %s", userId.c_str(), chatId.c_str(),
+                  (isTyping ? (isRecordingAudio ? "recording audio" : "typing") : "idle"));
         if (isTyping)
         {
           m_UsersTyping[profileId][chatId].insert(userId);
@@ -1942,6 +2001,15 @@ void UiModel::MessageHandler(std::shared_ptr<ServiceMessage> p_ServiceMessage)
         {
           m_UsersTyping[profileId][chatId].erase(userId);
         }
+
+        if (isTyping && isRecordingAudio)
+        {
+          m_UsersRecordingAudio[profileId][chatId].insert(userId);
+        }
+        else
+        {
+          m_UsersRecordingAudio[profileId][chatId].erase(userId);
+        }
         UpdateStatus();
       }
       break;
@@ -1973,11 +2041,30 @@ void UiModel::MessageHandler(std::shared_ptr<ServiceMessage> p_ServiceMessage)
           const ChatInfo& chatInfo = createChatNotify->chatInfo;
           LOG_TRACE("chat created %s", chatInfo.id.c_str());
           m_ChatInfos[profileId][chatInfo.id] = chatInfo;
+
+          // name unnamed contacts by their verified business name
+          if (!createChatNotify->verifiedName.empty())
+          {
+            ContactInfo& contactInfo = m_ContactInfos[profileId][chatInfo.id];
+            if (contactInfo.name.empty() || (contactInfo.name == contactInfo.phone))
+            {
+              contactInfo.id = chatInfo.id;
+              contactInfo.name = createChatNotify->verifiedName;
+              m_ContactInfosUpdateTime = TimeUtil::GetCurrentTimeMSec();
+            }
+          }
           if (m_ChatSet[profileId].insert(chatInfo.id).second)
           {
             m_ChatVec.push_back(std::make_pair(profileId, chatInfo.id));
           }
 
+          std::wstring& entryStr = m_EntryStr[profileId][chatInfo.id];
+          if (!createChatNotify->entryText.empty() && entryStr.empty())
+          {
+            entryStr = StrUtil::ToWString(createChatNotify->entryText);
+            m_EntryPos[profileId][chatInfo.id] = entryStr.size();
+          }
+
           m_CurrentChatIndex = 0;
           m_CurrentChat.first = profileId;
           m_CurrentChat.second = chatInfo.id;
@@ -2071,6 +2158,86 @@ void UiModel::MessageHandler(std::shared_ptr<ServiceMessage> p_ServiceMessage)
       }
       break;
 
+    case ConnErrorNotifyType:
+      {
+        std::shared_ptr<ConnErrorNotify> connErrorNotify =
+          std::static_pointer_cast<ConnErrorNotify>(p_ServiceMessage);
+        LOG_WARNING("connection error %s", connErrorNotify->message.c_str());
+        m_ConnErrors.push_back(connErrorNotify);
+      }
+      break;
+
+    case ErrorNotifyType:
+      {
+        std::shared_ptr<ErrorNotify> errorNotify = std::static_pointer_cast<ErrorNotify>(p_ServiceMessage);
+        LOG_WARNING("error %s", errorNotify->message.c_str());
+        m_Errors.push_back(errorNotify);
+      }
+      break;
+
+    case ProfileSettingNotifyType:
+      {
+        std::shared_ptr<ProfileSettingNotify> profileSettingNotify =
+          std::static_pointer_cast<ProfileSettingNotify>(p_ServiceMessage);
+        const ProfileSetting& profileSetting = profileSettingNotify->profileSetting;
+        LOG_TRACE("profile setting %s = %s", profileSetting.key.c_str(), profileSetting.value.c_str());
+        std::vector<ProfileSetting>& profileSettings = m_ProfileSettings[profileId];
+        auto it = std::find_if(profileSettings.begin(), profileSettings.end(),
+                               [&](const ProfileSetting& p_ProfileSetting)
+        {
+          return p_ProfileSetting.key == profileSetting.key;
+        });
+        if (it != profileSettings.end())
+        {
+          *it = profileSetting;
+        }
+        else
+        {
+          profileSettings.push_back(profileSetting);
+        }
+
+        m_ProfileSettingsUpdateTime = TimeUtil::GetCurrentTimeMSec();
+      }
+      break;
+
+    case NewProfilePictureNotifyType:
+      {
+        std::shared_ptr<NewProfilePictureNotify> newProfilePictureNotify =
+          std::static_pointer_cast<NewProfilePictureNotify>(p_ServiceMessage);
+        LOG_TRACE("profile picture %s path %s", newProfilePictureNotify->chatId.c_str(),
+                  newProfilePictureNotify->filePath.c_str());
+        m_ProfilePictures[profileId][newProfilePictureNotify->chatId] = newProfilePictureNotify->filePath;
+        m_ChatDetailsUpdateTime = TimeUtil::GetCurrentTimeMSec();
+      }
+      break;
+
+    case UserDetailsNotifyType:
+      {
+        std::shared_ptr<UserDetailsNotify> userDetailsNotify =
+          std::static_pointer_cast<UserDetailsNotify>(p_ServiceMessage);
+        LOG_TRACE("user details %s count %d", userDetailsNotify->userId.c_str(), userDetailsNotify->details.size());
+        m_UserDetails[profileId][userDetailsNotify->userId] = userDetailsNotify->details;
+        m_ChatDetailsUpdateTime = TimeUtil::GetCurrentTimeMSec();
+      }
+      break;
+
+    case ResolveLinksNotifyType:
+      {
+        std::shared_ptr<ResolveLinksNotify> resolveLinksNotify =
+          std::static_pointer_cast<ResolveLinksNotify>(p_ServiceMessage);
+        if (!resolveLinksNotify->success)
+        {
+          LOG_TRACE("links not resolved");
+          std::vector<std::string> msgUrls = StrUtil::ExtractUrlsFromStr(resolveLinksNotify->text);
+          for (const auto& msgUrl : msgUrls)
+          {
+            LOG_DEBUG("open url %s", msgUrl.c_str());
+            OpenLink(msgUrl);
+          }
+        }
+      }
+      break;
+
     case RequestAppExitNotifyType:
       {
         std::shared_ptr<RequestAppExitNotify> requestAppExitNotify =
@@ -2158,6 +2325,16 @@ bool UiModel::Process()
     HandleProtocolUiControl(lock);
   }
 
+  if (!m_ConnErrors.empty())
+  {
+    HandleConnErrors();
+  }
+
+  if (!m_Errors.empty())
+  {
+    HandleErrors();
+  }
+
   if (m_TriggerTerminalBell)
   {
     m_TriggerTerminalBell = false;
@@ -2363,6 +2540,7 @@ std::string UiModel::GetChatStatus(const std::string& p_ProfileId, const std::st
 {
   std::string chatStatus;
   const std::set<std::string>& usersTyping = m_UsersTyping[p_ProfileId][p_ChatId];
+  const std::set<std::string>& usersRecordingAudio = m_UsersRecordingAudio[p_ProfileId][p_ChatId];
   const ContactInfo& contactInfo = m_ContactInfos[p_ProfileId][p_ChatId];
   const ChatInfo& chatInfo = m_ChatInfos[p_ProfileId][p_ChatId];
 
@@ -2383,14 +2561,15 @@ std::string UiModel::GetChatStatus(const std::string& p_ProfileId, const std::st
     else
     {
       std::string userId = *usersTyping.begin();
+      const std::string activity = usersRecordingAudio.count(userId) ? "recording audio" : "typing";
       if (userId == p_ChatId)
       {
-        chatStatus = "typing";
+        chatStatus = activity;
       }
       else
       {
         std::string userName = GetContactName(p_ProfileId, userId);
-        chatStatus = userName + " is typing";
+        chatStatus = userName + " is " + activity;
       }
     }
   }
@@ -2476,6 +2655,7 @@ void UiModel::OnCurrentChatChanged()
   RequestMessagesNextChat();
   RequestUserStatusCurrentChat();
   RequestUserStatusNextChat();
+  RequestUserStatusVisibleChats();
   ProtocolSetCurrentChat();
 }
 
@@ -2564,6 +2744,25 @@ void UiModel::RequestUserStatusNextChat()
   RequestUserStatus(nextChat);
 }
 
+void UiModel::RequestUserStatusVisibleChats()
+{
+  if (m_ChatVec.empty()) return;
+
+  // same range as shown in list view
+  const int index = std::max(0, m_CurrentChatIndex);
+  const int height = m_View->GetListLines();
+  const int count = m_ChatVec.size();
+  const int offset = std::min(std::max(0, index - ((height - 1) / 2)), std::max(0, count - height));
+  const int last = std::min((height + offset), count);
+  for (int i = offset; i < last; ++i)
+  {
+    const std::pair<std::string, std::string>& chat = m_ChatVec.at(i);
+    if (!HasProtocolFeature(chat.first, FeatureStatusVisibleChats)) continue;
+
+    RequestUserStatus(chat);
+  }
+}
+
 void UiModel::RequestUserStatus(const std::pair<std::string, std::string>& p_Chat)
 {
   static std::set<std::pair<std::string, std::string>> requestedStatuses;
@@ -2694,6 +2893,54 @@ int64_t UiModel::GetContactInfosUpdateTime()
   return m_ContactInfosUpdateTime;
 }
 
+std::vector<ProfileSetting> UiModel::GetProfileSettings(const std::string& p_ProfileId)
+{
+  std::unique_lock<std::mutex> lock(m_ModelMutex);
+  return m_ProfileSettings[p_ProfileId];
+}
+
+int64_t UiModel::GetProfileSettingsUpdateTime()
+{
+  std::unique_lock<std::mutex> lock(m_ModelMutex);
+  return m_ProfileSettingsUpdateTime;
+}
+
+std::vector<std::pair<std::string, std::string>> UiModel::GetChatDetails(const std::string& p_ProfileId,
+                                                                         const std::string& p_ChatId)
+{
+  std::unique_lock<std::mutex> lock(m_ModelMutex);
+  std::vector<std::pair<std::string, std::string>> chatDetails;
+  chatDetails.push_back(std::make_pair("Name", GetContactListName(p_ProfileId, p_ChatId, true /*p_AllowId*/)));
+
+  const std::string phone = GetContactPhone(p_ProfileId, p_ChatId);
+  if (!phone.empty())
+  {
+    chatDetails.push_back(std::make_pair("Phone", phone));
+  }
+
+  if (m_ContactInfos[p_ProfileId][p_ChatId].isBlocked)
+  {
+    chatDetails.push_back(std::make_pair("Blocked", "yes"));
+  }
+
+  const std::vector<std::pair<std::string, std::string>>& userDetails = m_UserDetails[p_ProfileId][p_ChatId];
+  chatDetails.insert(chatDetails.end(), userDetails.begin(), userDetails.end());
+
+  const std::string& picturePath = m_ProfilePictures[p_ProfileId][p_ChatId];
+  if (!picturePath.empty())
+  {
+    chatDetails.push_back(std::make_pair(s_ProfilePictureLabel, picturePath));
+  }
+
+  return chatDetails;
+}
+
+int64_t UiModel::GetChatDetailsUpdateTime()
+{
+  std::unique_lock<std::mutex> lock(m_ModelMutex);
+  return m_ChatDetailsUpdateTime;
+}
+
 std::pair<std::string, std::string>& UiModel::GetCurrentChat()
 {
   return m_CurrentChat;
@@ -3543,6 +3790,40 @@ void UiModel::HandleProtocolUiControl(std::unique_lock<std::mutex>& lock)
   LOG_TRACE("handle protocol ui control end");
 }
 
+void UiModel::HandleConnErrors()
+{
+  std::vector<std::shared_ptr<ConnErrorNotify>> connErrors;
+  connErrors.swap(m_ConnErrors);
+  for (const auto& connErrorNotify : connErrors)
+  {
+    const std::string& profileId = connErrorNotify->profileId;
+    const std::string title = "Connection Error - " + GetProfileDisplayName(profileId);
+    if (connErrorNotify->isReconnectable)
+    {
+      if (MessageDialog(title, connErrorNotify->message + "\n\nReconnect now?", 0.8, 9))
+      {
+        std::shared_ptr<ReinitRequest> reinitRequest = std::make_shared<ReinitRequest>();
+        SendProtocolRequest(profileId, reinitRequest);
+      }
+    }
+    else
+    {
+      MessageDialog(title, connErrorNotify->message, 0.8, 7);
+    }
+  }
+}
+
+void UiModel::HandleErrors()
+{
+  std::vector<std::shared_ptr<ErrorNotify>> errors;
+  errors.swap(m_Errors);
+  for (const auto& errorNotify : errors)
+  {
+    const std::string title = "Error - " + GetProfileDisplayName(errorNotify->profileId);
+    MessageDialog(title, errorNotify->message, 0.8, 7);
+  }
+}
+
 void UiModel::React()
 {
   if (!GetSelectMessageActive() || GetEditMessageActive()) return;
@@ -3820,22 +4101,35 @@ void UiModel::ForwardMessage()
                   selectedChatListItem.chatId.c_str());
     }
 
-    std::shared_ptr<SendMessageRequest> sendMessageRequest =
-      std::make_shared<SendMessageRequest>();
-
-    // prepare a new FileInfo struct if original message has a file
-    if (!message.fileInfo.empty())
+    if ((selectedChatListItem.profileId == profileId) && HasProtocolFeature(profileId, FeatureForwardMessages))
     {
-      FileInfo fileInfo = ProtocolUtil::FileInfoFromHex(message.fileInfo);
-      fileInfo.fileType = FileUtil::GetMimeType(fileInfo.filePath);
-      sendMessageRequest->chatMessage.fileInfo = ProtocolUtil::FileInfoToHex(fileInfo);
+      // forward natively within same profile, reusing uploaded media
+      std::shared_ptr<ForwardMessageRequest> forwardMessageRequest = std::make_shared<ForwardMessageRequest>();
+      forwardMessageRequest->chatId = chatId;
+      forwardMessageRequest->msgId = message.id;
+      forwardMessageRequest->chatMessage = message;
+      forwardMessageRequest->toChatIds = { selectedChatListItem.chatId };
+      SendProtocolRequest(profileId, forwardMessageRequest);
     }
+    else
+    {
+      std::shared_ptr<SendMessageRequest> sendMessageRequest =
+        std::make_shared<SendMessageRequest>();
 
-    // copy text and use selected chat
-    sendMessageRequest->chatMessage.text = message.text;
-    sendMessageRequest->chatId = selectedChatListItem.chatId;
+      // prepare a new FileInfo struct if original message has a file
+      if (!message.fileInfo.empty())
+      {
+        FileInfo fileInfo = ProtocolUtil::FileInfoFromHex(message.fileInfo);
+        fileInfo.fileType = FileUtil::GetMimeType(fileInfo.filePath);
+        sendMessageRequest->chatMessage.fileInfo = ProtocolUtil::FileInfoToHex(fileInfo);
+      }
 
-    SendProtocolRequest(selectedChatListItem.profileId, sendMessageRequest);
+      // copy text and use selected chat
+      sendMessageRequest->chatMessage.text = message.text;
+      sendMessageRequest->chatId = selectedChatListItem.chatId;
+
+      SendProtocolRequest(selectedChatListItem.profileId, sendMessageRequest);
+    }
 
     // reset message offset and selection mode
     m_MessageOffset[profileId][chatId] = 0;
@@ -3902,6 +4196,166 @@ void UiModel::GotoChat()
   ReinitView();
 }
 
+void UiModel::EditProfile()
+{
+  std::string profileId;
+
+  {
+    std::unique_lock<std::mutex> lock(m_ModelMutex);
+    if (GetEditMessageActive()) return;
+
+    // prefer profile of current chat, otherwise first profile supporting it
+    profileId = m_CurrentChat.first;
+    if (!m_Protocols.count(profileId) || !HasProtocolFeature(profileId, FeatureProfileSettings))
+    {
+      profileId.clear();
+      for (const auto& protocol : m_Protocols)
+      {
+        if (protocol.second->HasFeature(FeatureProfileSettings))
+        {
+          profileId = protocol.first;
+          break;
+        }
+      }
+    }
+
+    if (profileId.empty())
+    {
+      LOG_DEBUG("profile settings not supported");
+      return;
+    }
+
+    std::shared_ptr<GetProfileSettingsRequest> getProfileSettingsRequest =
+      std::make_shared<GetProfileSettingsRequest>();
+    SendProtocolRequest(profileId, getProfileSettingsRequest);
+  }
+
+  const std::string title = "Edit Profile" + (IsMultipleProfiles() ? " - " + GetProfileDisplayName(profileId) : "");
+  while (true)
+  {
+    UiDialogParams params(m_View.get(), this, title, 0.75, 0.65);
+    UiProfileDialog dialog(params, profileId);
+    if (!dialog.Run()) break;
+
+    ProfileSetting profileSetting = dialog.GetSelectedProfileSetting();
+    std::string value;
+    bool isEdited = false;
+    if (profileSetting.type == ProfileSettingTypeOption)
+    {
+      UiDialogParams optionParams(m_View.get(), this, profileSetting.label, 0.5, 0.5);
+      UiOptionListDialog optionDialog(optionParams, profileSetting.options, profileSetting.value);
+      if (optionDialog.Run())
+      {
+        value = optionDialog.GetSelectedOption();
+        isEdited = true;
+      }
+    }
+    else if (profileSetting.type == ProfileSettingTypeFile)
+    {
+      static const std::string actionView = "View";
+      static const std::string actionChange = "Change";
+      static const std::string actionRemove = "Remove";
+      const std::vector<std::string> actions = profileSetting.value.empty()
+        ? std::vector<std::string>({ actionChange })
+        : std::vector<std::string>({ actionView, actionChange, actionRemove });
+      UiDialogParams actionParams(m_View.get(), this, profileSetting.label, 0.5, 0.5);
+      UiOptionListDialog actionDialog(actionParams, actions);
+      if (actionDialog.Run())
+      {
+        const std::string action = actionDialog.GetSelectedOption();
+        if (action == actionView)
+        {
+          OpenAttachment(profileSetting.value);
+        }
+        else if (action == actionChange)
+        {
+          UiDialogParams fileParams(m_View.get(), this, profileSetting.label, 0.75, 0.65);
+          UiFileListDialog fileDialog(fileParams, FileUtil::GetCurrentWorkingDir());
+          if (fileDialog.Run())
+          {
+            value = fileDialog.GetSelectedPath();
+            isEdited = true;
+          }
+        }
+        else if (action == actionRemove)
+        {
+          value = "";
+          isEdited = true;
+        }
+      }
+    }
+    else
+    {
+      UiDialogParams textParams(m_View.get(), this, profileSetting.label, 0.75, 5);
+      UiTextInputDialog textInputDialog(textParams, "Text: ", profileSetting.value);
+      if (textInputDialog.Run())
+      {
+        value = textInputDialog.GetInput();
+        isEdited = true;
+      }
+    }
+
+    if (isEdited && (value != profileSetting.value))
+    {
+      std::unique_lock<std::mutex> lock(m_ModelMutex);
+      std::shared_ptr<SetProfileSettingRequest> setProfileSettingRequest =
+        std::make_shared<SetProfileSettingRequest>();
+      setProfileSettingRequest->key = profileSetting.key;
+      setProfileSettingRequest->value = value;
+      SendProtocolRequest(profileId, setProfileSettingRequest);
+    }
+  }
+
+  ReinitView();
+}
+
+void UiModel::ShowChatInfo()
+{
+  std::string profileId;
+  std::string chatId;
+
+  {
+    std::unique_lock<std::mutex> lock(m_ModelMutex);
+    if (GetEditMessageActive()) return;
+
+    profileId = m_CurrentChat.first;
+    chatId = m_CurrentChat.second;
+    if (chatId.empty()) return;
+
+    if (HasProtocolFeature(profileId, FeatureProfilePictures))
+    {
+      std::shared_ptr<GetProfilePictureRequest> getProfilePictureRequest =
+        std::make_shared<GetProfilePictureRequest>();
+      getProfilePictureRequest->chatId = chatId;
+      SendProtocolRequest(profileId, getProfilePictureRequest);
+    }
+
+    if (HasProtocolFeature(profileId, FeatureUserDetails))
+    {
+      std::shared_ptr<DeferGetUserDetailsRequest> deferGetUserDetailsRequest =
+        std::make_shared<DeferGetUserDetailsRequest>();
+      deferGetUserDetailsRequest->userIds = std::vector<std::string>({ chatId });
+      SendProtocolRequest(profileId, deferGetUserDetailsRequest);
+    }
+  }
+
+  while (true)
+  {
+    UiDialogParams params(m_View.get(), this, "Chat Info", 0.75, 0.65);
+    UiChatInfoDialog dialog(params, profileId, chatId);
+    if (!dialog.Run()) break;
+
+    // open profile picture when selected, other details are informational only
+    std::pair<std::string, std::string> chatDetail = dialog.GetSelectedChatDetail();
+    if (chatDetail.first == s_ProfilePictureLabel)
+    {
+      OpenAttachment(chatDetail.second);
+    }
+  }
+
+  ReinitView();
+}
+
 void UiModel::AddQuoteFromSelectedMessage(ChatMessage& p_ChatMessage)
 {
   // must be called with lock held
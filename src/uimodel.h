@@ -84,6 +84,11 @@ public:
   std::vector<std::pair<std::string, std::string>>& GetChatVecLock();
   std::unordered_map<std::string, std::unordered_map<std::string, ContactInfo>> GetContactInfos();
   int64_t GetContactInfosUpdateTime();
+  std::vector<ProfileSetting> GetProfileSettings(const std::string& p_ProfileId);
+  int64_t GetProfileSettingsUpdateTime();
+  std::vector<std::pair<std::string, std::string>> GetChatDetails(const std::string& p_ProfileId,
+                                                                  const std::string& p_ChatId);
+  int64_t GetChatDetailsUpdateTime();
   std::pair<std::string, std::string>& GetCurrentChat();
   int& GetCurrentChatIndex();
 
@@ -130,6 +135,7 @@ private:
   void RequestMessages(const std::string& p_ProfileId, const std::string& p_ChatId);
   void RequestUserStatusCurrentChat();
   void RequestUserStatusNextChat();
+  void RequestUserStatusVisibleChats();
   void RequestUserStatus(const std::pair<std::string, std::string>& p_Chat);
   void ProtocolSetCurrentChat();
   int GetHistoryLines();
@@ -164,6 +170,8 @@ private:
   void EntryConvertEmojiEnabled();
   void SetProtocolUiControl(const std::string& p_ProfileId, bool& p_IsTakeControl);
   void HandleProtocolUiControl(std::unique_lock<std::mutex>& p_Lock);
+  void HandleConnErrors();
+  void HandleErrors();
   void React();
   void Find();
   void FindNext();
@@ -173,6 +181,8 @@ private:
   bool IsChatForceHidden(const std::string& p_ChatId);
   bool IsChatForceMuted(const std::string& p_ChatId);
   void GotoChat();
+  void EditProfile();
+  void ShowChatInfo();
   void AddQuoteFromSelectedMessage(ChatMessage& p_ChatMessage);
 
 private:
@@ -187,6 +197,12 @@ private:
   std::unordered_map<std::string, std::unordered_map<std::string, ChatInfo>> m_ChatInfos;
   std::unordered_map<std::string, std::unordered_map<std::string, ContactInfo>> m_ContactInfos;
   int64_t m_ContactInfosUpdateTime = 0;
+  std::unordered_map<std::string, std::vector<ProfileSetting>> m_ProfileSettings;
+  int64_t m_ProfileSettingsUpdateTime = 0;
+  std::unordered_map<std::string, std::unordered_map<std::string, std::string>> m_ProfilePictures;
+  std::unordered_map<std::string,
+                     std::unordered_map<std::string, std::vector<std::pair<std::string, std::string>>>> m_UserDetails;
+  int64_t m_ChatDetailsUpdateTime = 0;
 
   std::pair<std::string, std::string> m_CurrentChat;
   int m_CurrentChatIndex = -1;
@@ -194,6 +210,8 @@ private:
 
   std::string m_EditMessageId;
   std::string m_ProtocolUiControl;
+  std::vector<std::shared_ptr<ConnErrorNotify>> m_ConnErrors;
+  std::vector<std::shared_ptr<ErrorNotify>> m_Errors;
   std::string m_FindText;
 
   std::unordered_map<std::string, std::unordered_map<std::string, std::vector<std::string>>> m_MessageVec;
@@ -212,6 +230,7 @@ private:
   std::unordered_map<std::string, std::unordered_map<std::string, int>> m_EntryPos;
 
   std::unordered_map<std::string, std::unordered_map<std::string, std::set<std::string>>> m_UsersTyping;
+  std::unordered_map<std::string, std::unordered_map<std::string, std::set<std::string>>> m_UsersRecordingAudio;
   std::unordered_map<std::string, std::unordered_map<std::string, bool>> m_UserOnline;
   std::unordered_map<std::string, std::unordered_map<std::string, int64_t>> m_UserTimeSeen;
 
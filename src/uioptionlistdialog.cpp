@@ -0,0 +1,71 @@
+// uioptionlistdialog.cpp
+//
+// Copyright (c) 2024 Kristofer Berggren
+// All rights reserved.
+//
+// nchat is distributed under the MIT license, see LICENSE for details.
+
+#include "uioptionlistdialog.h"
+
+#include "strutil.h"
+
+UiOptionListDialog::UiOptionListDialog(const UiDialogParams& p_Params, const std::vector<std::string>& p_Options,
+                                       const std::string& p_DefaultOption /*= ""*/)
+  : UiListDialog(p_Params, false /*p_ShadeHidden*/)
+  , m_Options(p_Options)
+{
+  UpdateList();
+
+  for (size_t i = 0; i < m_OptionVec.size(); ++i)
+  {
+    if (m_OptionVec.at(i) == p_DefaultOption)
+    {
+      m_Index = i;
+      break;
+    }
+  }
+}
+
+UiOptionListDialog::~UiOptionListDialog()
+{
+}
+
+std::string UiOptionListDialog::GetSelectedOption()
+{
+  return m_SelectedOption;
+}
+
+void UiOptionListDialog::OnSelect()
+{
+  if (m_OptionVec.empty()) return;
+
+  m_SelectedOption = m_OptionVec[m_Index];
+  m_Result = true;
+  m_Running = false;
+}
+
+void UiOptionListDialog::OnBack()
+{
+}
+
+bool UiOptionListDialog::OnTimer()
+{
+  return false;
+}
+
+void UiOptionListDialog::UpdateList()
+{
+  m_Index = 0;
+  m_Items.clear();
+  m_OptionVec.clear();
+
+  for (const auto& option : m_Options)
+  {
+    if (m_FilterStr.empty() ||
+        (StrUtil::ToLower(option).find(StrUtil::ToLower(StrUtil::ToString(m_FilterStr))) != std::string::npos))
+    {
+      m_Items.push_back(StrUtil::TrimPadWString(StrUtil::ToWString(option), m_W));
+      m_OptionVec.push_back(option);
+    }
+  }
+}
@@ -0,0 +1,35 @@
+// uioptionlistdialog.h
+//
+// Copyright (c) 2024 Kristofer Berggren
+// All rights reserved.
+//
+// nchat is distributed under the MIT license, see LICENSE for details.
+
+#pragma once
+
+#include <string>
+#include <vector>
+
+#include "uilistdialog.h"
+
+class UiOptionListDialog : public UiListDialog
+{
+public:
+  UiOptionListDialog(const UiDialogParams& p_Params, const std::vector<std::string>& p_Options,
+                     const std::string& p_DefaultOption = "");
+  virtual ~UiOptionListDialog();
+
+  std::string GetSelectedOption();
+
+protected:
+  virtual void OnSelect();
+  virtual void OnBack();
+  virtual bool OnTimer();
+
+  void UpdateList();
+
+private:
+  std::vector<std::string> m_Options;
+  std::vector<std::string> m_OptionVec;
+  std::string m_SelectedOption;
+};
@@ -0,0 +1,83 @@
+// uiprofiledialog.cpp
+//
+// Copyright (c) 2024 Kristofer Berggren
+// All rights reserved.
+//
+// nchat is distributed under the MIT license, see LICENSE for details.
+
+#include "uiprofiledialog.h"
+
+#include <algorithm>
+
+#include "strutil.h"
+#include "uimodel.h"
+
+UiProfileDialog::UiProfileDialog(const UiDialogParams& p_Params, const std::string& p_ProfileId)
+  : UiListDialog(p_Params, false /*p_ShadeHidden*/)
+  , m_ProfileId(p_ProfileId)
+{
+  UpdateList();
+}
+
+UiProfileDialog::~UiProfileDialog()
+{
+}
+
+ProfileSetting UiProfileDialog::GetSelectedProfileSetting()
+{
+  return m_SelectedProfileSetting;
+}
+
+void UiProfileDialog::OnSelect()
+{
+  if (m_ProfileSettingVec.empty()) return;
+
+  m_SelectedProfileSetting = m_ProfileSettingVec[m_Index];
+  m_Result = true;
+  m_Running = false;
+}
+
+void UiProfileDialog::OnBack()
+{
+}
+
+bool UiProfileDialog::OnTimer()
+{
+  int64_t modelProfileSettingsUpdateTime = m_Model->GetProfileSettingsUpdateTime();
+  if (m_DialogProfileSettingsUpdateTime != modelProfileSettingsUpdateTime)
+  {
+    int index = m_Index;
+    UpdateList();
+    m_Index = std::min(index, std::max((int)m_Items.size() - 1, 0));
+    return true;
+  }
+
+  return false;
+}
+
+void UiProfileDialog::UpdateList()
+{
+  int64_t modelProfileSettingsUpdateTime = m_Model->GetProfileSettingsUpdateTime();
+  if (m_DialogProfileSettingsUpdateTime != modelProfileSettingsUpdateTime)
+  {
+    m_DialogProfileSettingsUpdateTime = modelProfileSettingsUpdateTime;
+    m_DialogProfileSettings = m_Model->GetProfileSettings(m_ProfileId);
+  }
+
+  m_Index = 0;
+  m_Items.clear();
+  m_ProfileSettingVec.clear();
+
+  for (const auto& profileSetting : m_DialogProfileSettings)
+  {
+    if (m_FilterStr.empty() ||
+        (StrUtil::ToLower(profileSetting.label).find(StrUtil::ToLower(StrUtil::ToString(m_FilterStr))) !=
+         std::string::npos))
+    {
+      const bool isFileNone = (profileSetting.type == ProfileSettingTypeFile) && profileSetting.value.empty();
+      const std::string item = profileSetting.label + ": " + (isFileNone ? "none" : profileSetting.value);
+      m_Items.push_back(StrUtil::TrimPadWString(StrUtil::ToWString(item), m_W));
+      m_ProfileSettingVec.push_back(profileSetting);
+    }
+  }
+}
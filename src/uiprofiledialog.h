@@ -0,0 +1,37 @@
+// uiprofiledialog.h
+//
+// Copyright (c) 2024 Kristofer Berggren
+// All rights reserved.
+//
+// nchat is distributed under the MIT license, see LICENSE for details.
+
+#pragma once
+
+#include <string>
+#include <vector>
+
+#include "protocol.h"
+#include "uilistdialog.h"
+
+class UiProfileDialog : public UiListDialog
+{
+public:
+  UiProfileDialog(const UiDialogParams& p_Params, const std::string& p_ProfileId);
+  virtual ~UiProfileDialog();
+
+  ProfileSetting GetSelectedProfileSetting();
+
+protected:
+  virtual void OnSelect();
+  virtual void OnBack();
+  virtual bool OnTimer();
+
+  void UpdateList();
+
+private:
+  std::string m_ProfileId;
+  std::vector<ProfileSetting> m_DialogProfileSettings;
+  int64_t m_DialogProfileSettingsUpdateTime = 0;
+  std::vector<ProfileSetting> m_ProfileSettingVec;
+  ProfileSetting m_SelectedProfileSetting;
+};
@@ -26,6 +26,11 @@ void UiTopView::Draw()
   m_Dirty |= (status != lastStatus);
   lastStatus = status;
 
+  static int32_t lastProgress = -1;
+  int32_t progress = Status::GetProgress();
+  m_Dirty |= (progress != lastProgress);
+  lastProgress = progress;
+
   if (!m_Enabled || !m_Dirty) return;
   m_Dirty = false;
 
@@ -204,6 +204,11 @@ int UiView::GetHistoryLines()
   return m_UiHistoryView->H();
 }
 
+int UiView::GetListLines()
+{
+  return m_UiListView->H();
+}
+
 int UiView::GetEntryWidth()
 {
   return m_UiEntryView->W();
@@ -43,6 +43,7 @@ public:
   void SetEntryDirty(bool p_Dirty);
   int GetHistoryShowCount();
   int GetHistoryLines();
+  int GetListLines();
   int GetEntryWidth();
   int GetScreenWidth();
   int GetScreenHeight();